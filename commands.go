@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"gopkg.in/yaml.v3"
+)
+
+// runCommand runs a subcommand that does not start the server. It returns
+// false when args is not a subcommand.
+func runCommand(args []string) (exitCode int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	switch args[0] {
+	case "validate":
+		return runValidate(args[1:], os.Stdout, os.Stderr), true
+	case "show-config":
+		return runShowConfig(args[1:], os.Stdout, os.Stderr), true
+	case "schema":
+		return runSchema(args[1:], os.Stdout, os.Stderr), true
+	default:
+		return 0, false
+	}
+}
+
+// runValidate loads the configuration and checks the model commands, model
+// files and ports. All problems are reported at once to errOut, the summary is
+// written to out.
+func runValidate(args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	configPath := flags.String("config", "config.yaml", "config file name")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	conf, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error loading config: %v\n", err)
+		return 1
+	}
+
+	problems := validateConfig(conf)
+	for _, problem := range problems {
+		fmt.Fprintln(errOut, problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "%s: %d problem(s) found\n", *configPath, len(problems))
+		return 1
+	}
+
+	fmt.Fprintf(out, "%s: OK, %d models\n", *configPath, len(conf.Models))
+	return 0
+}
+
+// flags of inference servers that take a model file
+var modelFileFlags = map[string]bool{
+	"-m":               true,
+	"--model":          true,
+	"-md":              true,
+	"--model-draft":    true,
+	"--mmproj":         true,
+	"--lora":           true,
+	"--control-vector": true,
+}
+
+// validateConfig returns the problems found in conf: missing executables and
+// model files sorted by model ID, missing discovery directories and port
+// collisions
+func validateConfig(conf config.Config) []string {
+	modelIDs := make([]string, 0, len(conf.Models))
+	for modelID := range conf.Models {
+		modelIDs = append(modelIDs, modelID)
+	}
+	sort.Strings(modelIDs)
+
+	var problems []string
+	for _, modelID := range modelIDs {
+		modelConfig := conf.Models[modelID]
+		if modelConfig.IsRemote() {
+			continue
+		}
+
+		args, err := modelConfig.SanitizedCommand()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("model %s: cmd: %v", modelID, err))
+			continue
+		}
+
+		if _, err := exec.LookPath(args[0]); err != nil {
+			problems = append(problems, fmt.Sprintf("model %s: cmd: executable %s not found", modelID, args[0]))
+		}
+
+		// paths in container commands are inside the container
+		switch strings.TrimSuffix(filepath.Base(args[0]), ".exe") {
+		case "docker", "podman", "nerdctl":
+			continue
+		}
+		for _, file := range modelFiles(args[1:]) {
+			if _, err := os.Stat(file); err != nil {
+				problems = append(problems, fmt.Sprintf("model %s: cmd: model file %s not found", modelID, file))
+			}
+		}
+	}
+
+	for i, discovery := range conf.Discovery {
+		if _, err := os.Stat(discovery.Dir); err != nil {
+			problems = append(problems, fmt.Sprintf("discovery[%d]: dir %s not found", i, discovery.Dir))
+		}
+	}
+
+	return append(problems, portCollisions(conf, modelIDs)...)
+}
+
+// modelFiles returns the model file paths in args, values of modelFileFlags
+// and arguments ending in .gguf
+func modelFiles(args []string) []string {
+	var files []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if name, value, found := strings.Cut(arg, "="); found && modelFileFlags[name] {
+			files = append(files, value)
+		} else if modelFileFlags[arg] && i+1 < len(args) {
+			i++
+			if looksLikeFile(args[i]) {
+				files = append(files, args[i])
+			}
+		} else if strings.HasSuffix(strings.ToLower(arg), ".gguf") {
+			files = append(files, arg)
+		}
+	}
+	return files
+}
+
+// looksLikeFile is false for values like Hugging Face repository IDs
+func looksLikeFile(value string) bool {
+	switch strings.ToLower(filepath.Ext(value)) {
+	case ".gguf", ".bin", ".safetensors":
+		return true
+	}
+	return filepath.IsAbs(value) || strings.HasPrefix(value, "./") || strings.HasPrefix(value, "../")
+}
+
+// portCollisions returns the models that listen on the same port and can run
+// at the same time. Models in the same swap group never run together.
+func portCollisions(conf config.Config, modelIDs []string) []string {
+	groupOf := make(map[string]string)
+	for groupID, group := range conf.Groups {
+		for _, member := range group.Members {
+			groupOf[member] = groupID
+		}
+	}
+
+	var problems []string
+	portUsers := make(map[string][]string)
+	for _, modelID := range modelIDs {
+		modelConfig := conf.Models[modelID]
+		if modelConfig.IsRemote() {
+			continue
+		}
+		proxyURL, err := url.Parse(modelConfig.Proxy)
+		if err != nil || proxyURL.Port() == "" {
+			continue
+		}
+		hostPort := net.JoinHostPort(proxyURL.Hostname(), proxyURL.Port())
+
+		for _, otherID := range portUsers[hostPort] {
+			sameSwapGroup := groupOf[modelID] == groupOf[otherID] && conf.Groups[groupOf[modelID]].Swap
+			if !sameSwapGroup {
+				problems = append(problems, fmt.Sprintf("model %s: proxy: %s is also used by model %s", modelID, hostPort, otherID))
+			}
+		}
+		portUsers[hostPort] = append(portUsers[hostPort], modelID)
+	}
+	return problems
+}
+
+// expandedConfig is the configuration after macros, ports and groups are
+// resolved, with the aliases of all models
+type expandedConfig struct {
+	config.Config `yaml:",inline"`
+	Aliases       map[string]string `yaml:"aliases"`
+}
+
+// redacted replaces secrets in the output of show-config
+const redacted = "<redacted>"
+
+// headers whose values are credentials
+var secretHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+}
+
+// names of environment variables and command flags whose values are
+// credentials, e.g. HF_TOKEN or --api-key
+var secretNameRegex = regexp.MustCompile(`(?i)key|token|secret|password`)
+
+// values of the secret flags in a command, --api-key value or --api-key=value
+var secretFlagRegex = regexp.MustCompile(`(?i)(\s-{1,2}[\w-]*(?:key|token|secret|password)[\w-]*)(=|\s+)([^\s-]\S*)`)
+
+// redactSecrets replaces the API keys, webhook secrets, credential headers,
+// secret environment variables and secret command flags in conf, which can come
+// from ${env.NAME} or ${file:path} macros
+func redactSecrets(conf *config.Config) {
+	for i := range conf.ConfigAPI.APIKeys {
+		conf.ConfigAPI.APIKeys[i] = redacted
+	}
+	for i := range conf.Notifications {
+		if conf.Notifications[i].Secret != "" {
+			conf.Notifications[i].Secret = redacted
+		}
+		redactHeaders(conf.Notifications[i].Headers)
+	}
+	for _, peer := range conf.Peers {
+		redactHeaders(peer.Headers)
+	}
+	for modelID, modelConfig := range conf.Models {
+		redactHeaders(modelConfig.Headers)
+		for i, env := range modelConfig.Env {
+			if name, _, found := strings.Cut(env, "="); found && secretNameRegex.MatchString(name) {
+				modelConfig.Env[i] = name + "=" + redacted
+			}
+		}
+		modelConfig.Cmd = secretFlagRegex.ReplaceAllString(modelConfig.Cmd, "${1}${2}"+redacted)
+		modelConfig.CmdStop = secretFlagRegex.ReplaceAllString(modelConfig.CmdStop, "${1}${2}"+redacted)
+		conf.Models[modelID] = modelConfig
+	}
+}
+
+func redactHeaders(headers map[string]string) {
+	for name := range headers {
+		if secretHeaders[strings.ToLower(name)] {
+			headers[name] = redacted
+		}
+	}
+}
+
+// runShowConfig prints the fully expanded configuration as YAML or JSON,
+// secrets are redacted. Errors are written to errOut.
+func runShowConfig(args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("show-config", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	configPath := flags.String("config", "config.yaml", "config file name")
+	format := flags.String("format", "yaml", "output format: yaml or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "yaml" && *format != "json" {
+		fmt.Fprintf(errOut, "Error: --format must be yaml or json, got: %s\n", *format)
+		return 2
+	}
+
+	conf, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error loading config: %v\n", err)
+		return 1
+	}
+	redactSecrets(&conf)
+
+	expanded := expandedConfig{Config: conf, Aliases: make(map[string]string)}
+	for modelID, modelConfig := range conf.Models {
+		for _, alias := range modelConfig.Aliases {
+			expanded.Aliases[alias] = modelID
+		}
+	}
+
+	data, err := yaml.Marshal(expanded)
+	if err == nil && *format == "json" {
+		// through YAML so the keys are the same as in the configuration file
+		var generic any
+		if err = yaml.Unmarshal(data, &generic); err == nil {
+			data, err = json.MarshalIndent(generic, "", "  ")
+			data = append(data, '\n')
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "Error encoding config: %v\n", err)
+		return 1
+	}
+
+	out.Write(data)
+	return 0
+}
+
+// runSchema prints the JSON Schema of the configuration file, errors are
+// written to errOut
+func runSchema(args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	schema, err := config.Schema()
+	if err != nil {
+		fmt.Fprintf(errOut, "Error generating schema: %v\n", err)
+		return 1
+	}
+
+	out.Write(schema)
+	return 0
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if !assert.NoError(t, os.WriteFile(path, []byte(content), 0644)) {
+		t.FailNow()
+	}
+	return path
+}
+
+func TestRunValidate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a posix shell as the model command")
+	}
+
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.gguf")
+	assert.NoError(t, os.WriteFile(modelFile, nil, 0644))
+	docker := filepath.Join(dir, "docker")
+	assert.NoError(t, os.WriteFile(docker, []byte("#!/bin/sh\n"), 0755))
+
+	configPath := writeTestConfig(t, `
+models:
+  ok:
+    cmd: sh -m `+modelFile+` --port ${PORT}
+  missing-binary:
+    cmd: no-such-llama-server --port ${PORT}
+  missing-file:
+    cmd: sh --model=/no/such/model.gguf --mmproj ./no-such-mmproj.gguf --port ${PORT}
+  hf-repo:
+    cmd: sh --model Qwen/Qwen3-8B --port ${PORT}
+  container:
+    cmd: `+docker+` run -p ${PORT}:8080 -v /models:/models server -m /models/x.gguf
+  fixed-a:
+    cmd: sh
+    proxy: http://127.0.0.1:9000
+  fixed-b:
+    cmd: sh
+    proxy: http://127.0.0.1:9000
+  fixed-c:
+    cmd: sh
+    proxy: http://127.0.0.1:9000
+  remote:
+    proxy: https://api.example.com
+discovery:
+  - dir: /no/such/models
+    model:
+      cmd: sh --port ${PORT} -m ${MODEL_PATH}
+groups:
+  together:
+    swap: false
+    members: [fixed-a, fixed-b]
+  swapped:
+    members: [fixed-c]
+`)
+
+	// problems are written to errOut, the summary to out
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 1, runValidate([]string{"--config", configPath}, &out, &errOut))
+	assert.Equal(t, []string{
+		"model missing-binary: cmd: executable no-such-llama-server not found",
+		"model missing-file: cmd: model file /no/such/model.gguf not found",
+		"model missing-file: cmd: model file ./no-such-mmproj.gguf not found",
+		"discovery[0]: dir /no/such/models not found",
+		"model fixed-b: proxy: 127.0.0.1:9000 is also used by model fixed-a",
+		"model fixed-c: proxy: 127.0.0.1:9000 is also used by model fixed-a",
+		"model fixed-c: proxy: 127.0.0.1:9000 is also used by model fixed-b",
+	}, strings.Split(strings.TrimSpace(errOut.String()), "\n"))
+	assert.Equal(t, configPath+": 7 problem(s) found\n", out.String())
+
+	out.Reset()
+	errOut.Reset()
+	configPath = writeTestConfig(t, "models:\n  ok:\n    cmd: sh -m "+modelFile+" --port ${PORT}\n")
+	assert.Equal(t, 0, runValidate([]string{"--config", configPath}, &out, &errOut))
+	assert.Equal(t, configPath+": OK, 1 models\n", out.String())
+	assert.Empty(t, errOut.String())
+
+	out.Reset()
+	configPath = writeTestConfig(t, "models:\n  bad:\n    cmd: server --port ${PORT} ${nope}\n")
+	assert.Equal(t, 1, runValidate([]string{"--config", configPath}, &out, &errOut))
+	assert.Equal(t, "Error loading config: unknown macro '${nope}' found in bad.cmd\n", errOut.String())
+	assert.Empty(t, out.String())
+}
+
+func TestRunShowConfig(t *testing.T) {
+	configPath := writeTestConfig(t, `
+startPort: 9000
+macros:
+  "server": "llama-server --port ${PORT}"
+models:
+  llama:
+    cmd: ${server} -m llama.gguf
+    aliases: [gpt-4o-mini]
+    env:
+      - HF_TOKEN=hf-env-value
+      - CUDA_VISIBLE_DEVICES=0
+    headers:
+      Authorization: "Bearer upstream-key"
+      X-Request-Source: llama-swap
+  secured:
+    cmd: |
+      llama-server --port ${PORT}
+      --api-key server-key --hf-token=hf-flag-value --no-webui
+configAPI:
+  apiKeys: ["admin-key"]
+notifications:
+  - webhook: http://localhost:9999/events
+    secret: webhook-secret
+`)
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, runShowConfig([]string{"--config", configPath, "--format", "json"}, &out, &errOut))
+
+	var shown struct {
+		Aliases map[string]string `json:"aliases"`
+		Groups  map[string]struct {
+			Members []string `json:"members"`
+		} `json:"groups"`
+		Models map[string]struct {
+			Cmd   string `json:"cmd"`
+			Proxy string `json:"proxy"`
+		} `json:"models"`
+	}
+	if !assert.NoError(t, json.Unmarshal(out.Bytes(), &shown)) {
+		return
+	}
+	assert.Equal(t, map[string]string{"gpt-4o-mini": "llama"}, shown.Aliases)
+	assert.Equal(t, []string{"llama", "secured"}, shown.Groups["(default)"].Members)
+	assert.Equal(t, "llama-server --port 9000 -m llama.gguf", shown.Models["llama"].Cmd)
+	assert.Equal(t, "http://localhost:9000", shown.Models["llama"].Proxy)
+
+	out.Reset()
+	assert.Equal(t, 0, runShowConfig([]string{"--config", configPath}, &out, &errOut))
+	assert.Contains(t, out.String(), "cmd: llama-server --port 9000 -m llama.gguf\n")
+	assert.Contains(t, out.String(), "gpt-4o-mini: llama\n")
+	assert.Contains(t, out.String(), "X-Request-Source: llama-swap\n")
+
+	// secrets are not shown
+	for _, secret := range []string{"upstream-key", "admin-key", "webhook-secret", "hf-env-value", "server-key", "hf-flag-value"} {
+		assert.NotContains(t, out.String(), secret)
+	}
+	assert.Contains(t, out.String(), "secret: <redacted>\n")
+	assert.Contains(t, out.String(), "HF_TOKEN=<redacted>\n")
+	assert.Contains(t, out.String(), "CUDA_VISIBLE_DEVICES=0\n")
+	assert.Contains(t, out.String(), "--api-key <redacted> --hf-token=<redacted> --no-webui")
+	assert.Empty(t, errOut.String())
+
+	// errors are written to errOut
+	out.Reset()
+	assert.Equal(t, 2, runShowConfig([]string{"--config", configPath, "--format", "toml"}, &out, &errOut))
+	assert.Empty(t, out.String())
+	assert.Equal(t, "Error: --format must be yaml or json, got: toml\n", errOut.String())
+}
+
+func TestRunSchema(t *testing.T) {
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, runSchema(nil, &out, &errOut))
+
+	schema, err := config.Schema()
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(schema), out.String())
+	}
+	assert.True(t, json.Valid(out.Bytes()))
+}
@@ -8,11 +8,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
 	"github.com/mostlygeek/llama-swap/event"
 	"github.com/mostlygeek/llama-swap/proxy"
@@ -26,11 +24,20 @@ var (
 )
 
 func main() {
+	// validate and show-config do not start the server
+	if exitCode, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(exitCode)
+	}
+
 	// Define a command-line flag for the port
 	configPath := flag.String("config", "config.yaml", "config file name")
 	listenStr := flag.String("listen", ":8080", "listen ip/port")
 	showVersion := flag.Bool("version", false, "show version of build")
 	watchConfig := flag.Bool("watch-config", false, "Automatically reload config file on change")
+	tlsCertFile := flag.String("tls-cert", "", "TLS certificate file, enables HTTPS when set with --tls-key")
+	tlsKeyFile := flag.String("tls-key", "", "TLS private key file")
+	tlsClientCAFile := flag.String("tls-client-ca", "", "CA bundle to verify client certificates against (mutual TLS)")
+	tlsRedirectListen := flag.String("tls-redirect-listen", "", "optional ip/port for a plain HTTP listener that redirects to HTTPS")
 
 	flag.Parse() // Parse the command-line flags
 
@@ -39,12 +46,39 @@ func main() {
 		os.Exit(0)
 	}
 
-	conf, err := config.LoadConfig(*configPath)
+	// changes made through /api/config are kept by the editor across reloads
+	configEditor := config.NewEditor(*configPath)
+	conf, err := configEditor.Load()
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
+	// the tls keys of the config are used for flags that are not set
+	for _, setting := range []struct {
+		flag  *string
+		value string
+	}{
+		{tlsCertFile, conf.TLS.CertFile},
+		{tlsKeyFile, conf.TLS.KeyFile},
+		{tlsClientCAFile, conf.TLS.ClientCAFile},
+		{tlsRedirectListen, conf.TLS.RedirectListen},
+	} {
+		if *setting.flag == "" {
+			*setting.flag = setting.value
+		}
+	}
+
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		fmt.Println("Error: --tls-cert and --tls-key (tls.certFile and tls.keyFile) must be set together")
+		os.Exit(1)
+	}
+
+	if *tlsCertFile == "" && (*tlsClientCAFile != "" || *tlsRedirectListen != "") {
+		fmt.Println("Error: --tls-client-ca and --tls-redirect-listen require --tls-cert and --tls-key")
+		os.Exit(1)
+	}
+
 	if len(conf.Profiles) > 0 {
 		fmt.Println("WARNING: Profile functionality has been removed in favor of Groups. See the README for more information.")
 	}
@@ -57,26 +91,50 @@ func main() {
 
 	// Setup channels for server management
 	exitChan := make(chan struct{})
-	sigChan := make(chan os.Signal, 1)
+	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
 
 	// Create server with initial handler
 	srv := &http.Server{
 		Addr: *listenStr,
 	}
 
+	// optional TLS support, certificates are reloaded automatically when rotated
+	var redirectSrv *http.Server
+	useTLS := *tlsCertFile != ""
+	if useTLS {
+		reloader, err := newCertReloader(*tlsCertFile, *tlsKeyFile, *tlsClientCAFile)
+		if err != nil {
+			fmt.Printf("Error loading TLS certificates: %v\n", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+
+		if *tlsRedirectListen != "" {
+			redirectSrv = &http.Server{
+				Addr:    *tlsRedirectListen,
+				Handler: httpsRedirectHandler(*listenStr),
+			}
+		}
+	}
+
 	// Support for watching config and reloading when it changes
 	reloadProxyManager := func() {
 		if currentPM, ok := srv.Handler.(*proxy.ProxyManager); ok {
-			conf, err = config.LoadConfig(*configPath)
+			conf, err = configEditor.Load()
 			if err != nil {
 				fmt.Printf("Warning, unable to reload configuration: %v\n", err)
 				return
 			}
 
+			// unlike a shutdown, a reload does not drain and reject new requests
 			fmt.Println("Configuration Changed")
 			currentPM.Shutdown()
-			srv.Handler = proxy.New(conf)
+			pm := proxy.New(conf)
+			pm.SetConfigEditor(configEditor)
+			srv.Handler = pm
 			fmt.Println("Configuration Reloaded")
 
 			// wait a few seconds and tell any UI to reload
@@ -86,98 +144,116 @@ func main() {
 				})
 			})
 		} else {
-			conf, err = config.LoadConfig(*configPath)
+			conf, err = configEditor.Load()
 			if err != nil {
 				fmt.Printf("Error, unable to load configuration: %v\n", err)
 				os.Exit(1)
 			}
-			srv.Handler = proxy.New(conf)
+			pm := proxy.New(conf)
+			pm.SetConfigEditor(configEditor)
+			srv.Handler = pm
 		}
 	}
 
 	// load the initial proxy manager
 	reloadProxyManager()
 	debouncedReload := debounce(time.Second, reloadProxyManager)
-	if *watchConfig {
-		defer event.On(func(e proxy.ConfigFileChangedEvent) {
-			if e.ReloadingState == proxy.ReloadingStateStart {
-				debouncedReload()
-			}
-		})()
-
-		fmt.Println("Watching Configuration for changes")
-		go func() {
-			absConfigPath, err := filepath.Abs(*configPath)
-			if err != nil {
-				fmt.Printf("Error getting absolute path for watching config file: %v\n", err)
-				return
-			}
-			watcher, err := fsnotify.NewWatcher()
-			if err != nil {
-				fmt.Printf("Error creating file watcher: %v. File watching disabled.\n", err)
-				return
-			}
+	defer event.On(func(e proxy.ConfigFileChangedEvent) {
+		if e.ReloadingState == proxy.ReloadingStateStart {
+			debouncedReload()
+		}
+	})()
 
-			configDir := filepath.Dir(absConfigPath)
-			err = watcher.Add(configDir)
-			if err != nil {
-				fmt.Printf("Error adding config path directory (%s) to watcher: %v. File watching disabled.", configDir, err)
-				return
-			}
+	// reload on SIGHUP, with or without --watch-config
+	go func() {
+		for range reloadChan {
+			fmt.Println("Received SIGHUP, reloading configuration")
+			event.Emit(proxy.ConfigFileChangedEvent{
+				ReloadingState: proxy.ReloadingStateStart,
+			})
+		}
+	}()
 
-			defer watcher.Close()
-			for {
-				select {
-				case changeEvent := <-watcher.Events:
-					if changeEvent.Name == absConfigPath && (changeEvent.Has(fsnotify.Write) || changeEvent.Has(fsnotify.Create) || changeEvent.Has(fsnotify.Remove)) {
-						event.Emit(proxy.ConfigFileChangedEvent{
-							ReloadingState: proxy.ReloadingStateStart,
-						})
-					} else if changeEvent.Name == filepath.Join(configDir, "..data") && changeEvent.Has(fsnotify.Create) {
-						// the change for k8s configmap
-						event.Emit(proxy.ConfigFileChangedEvent{
-							ReloadingState: proxy.ReloadingStateStart,
-						})
-					}
-
-				case err := <-watcher.Errors:
-					log.Printf("File watcher error: %v", err)
-				}
-			}
-		}()
+	if *watchConfig {
+		fmt.Println("Watching Configuration for changes")
+		go watchConfigFiles(*configPath)
 	}
 
-	// shutdown on signal
+	// shutdown on signal, a second signal skips waiting for in-flight requests
 	go func() {
 		sig := <-sigChan
 		fmt.Printf("Received signal %v, shutting down...\n", sig)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-		defer cancel()
 
 		if pm, ok := srv.Handler.(*proxy.ProxyManager); ok {
-			pm.Shutdown()
+			drainProxyManager(pm, sigChan)
+			// with a stateFile, ready models keep running for the next start
+			pm.Detach()
 		} else {
 			fmt.Println("srv.Handler is not of type *proxy.ProxyManager")
 		}
 
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
 		if err := srv.Shutdown(ctx); err != nil {
 			fmt.Printf("Server shutdown error: %v\n", err)
 		}
+		if redirectSrv != nil {
+			redirectSrv.Shutdown(ctx)
+		}
 		close(exitChan)
 	}()
 
 	// Start server
-	fmt.Printf("llama-swap listening on %s\n", *listenStr)
+	if useTLS {
+		fmt.Printf("llama-swap listening on %s (https)\n", *listenStr)
+	} else {
+		fmt.Printf("llama-swap listening on %s\n", *listenStr)
+	}
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if useTLS {
+			// certificates are provided by srv.TLSConfig
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Fatal server error: %v\n", err)
 		}
 	}()
 
+	if redirectSrv != nil {
+		fmt.Printf("llama-swap redirecting http on %s to https\n", *tlsRedirectListen)
+		go func() {
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Fatal redirect server error: %v\n", err)
+			}
+		}()
+	}
+
 	// Wait for exit signal
 	<-exitChan
 }
 
+// drainProxyManager waits for in-flight requests to finish, up to the
+// configured drainTimeout. A signal on interrupt ends the wait early.
+func drainProxyManager(pm *proxy.ProxyManager, interrupt <-chan os.Signal) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case sig := <-interrupt:
+			fmt.Printf("Received signal %v, not waiting for in-flight requests\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pm.Drain(ctx)
+}
+
 func debounce(interval time.Duration, f func()) func() {
 	var timer *time.Timer
 	return func() {
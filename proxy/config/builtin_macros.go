@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var (
+	// ${env.NAME}, ${env.NAME:-default} and ${file:/path/to/file}
+	builtinMacroRegex = regexp.MustCompile(`\$\{(?:env\.([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?|file:([^}]+))\}`)
+)
+
+// hostMacros describe the host llama-swap is running on. User defined macros
+// with the same name take precedence.
+func hostMacros() MacroList {
+	hostname, _ := os.Hostname()
+	return MacroList{
+		{Name: "HOSTNAME", Value: hostname},
+		{Name: "OS", Value: runtime.GOOS},
+		{Name: "ARCH", Value: runtime.GOARCH},
+	}
+}
+
+// unresolvedMacroError is returned when an env or file macro has no value
+type unresolvedMacroError struct {
+	macro  string
+	reason string
+}
+
+func (e *unresolvedMacroError) Error() string {
+	return fmt.Sprintf("macro '%s': %s", e.macro, e.reason)
+}
+
+// expandBuiltinMacros replaces the env and file macros in s. Environment
+// variables without a default must be set, a default is used when the
+// variable is unset or empty. Trailing newlines are removed from files.
+func expandBuiltinMacros(s string) (string, error) {
+	var err error
+	expanded := builtinMacroRegex.ReplaceAllStringFunc(s, func(macro string) string {
+		if err != nil {
+			return macro
+		}
+
+		match := builtinMacroRegex.FindStringSubmatch(macro)
+		if path := match[3]; path != "" {
+			data, readErr := os.ReadFile(path)
+			if readErr != nil {
+				err = &unresolvedMacroError{macro: macro, reason: readErr.Error()}
+				return macro
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+
+		name, fallback := match[1], match[2]
+		value, found := os.LookupEnv(name)
+		if fallback != "" {
+			if value == "" {
+				return strings.TrimPrefix(fallback, ":-")
+			}
+			return value
+		}
+		if !found {
+			err = &unresolvedMacroError{macro: macro, reason: fmt.Sprintf("environment variable %s is not set", name)}
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// expandBuiltinMacrosInValue replaces the env and file macros in the strings
+// of nested values like metadata and filters.setParams
+func expandBuiltinMacrosInValue(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return expandBuiltinMacros(v)
+	case map[string]any:
+		newMap := make(map[string]any, len(v))
+		for key, val := range v {
+			newVal, err := expandBuiltinMacrosInValue(val)
+			if err != nil {
+				return nil, err
+			}
+			newMap[key] = newVal
+		}
+		return newMap, nil
+	case []any:
+		newSlice := make([]any, len(v))
+		for i, val := range v {
+			newVal, err := expandBuiltinMacrosInValue(val)
+			if err != nil {
+				return nil, err
+			}
+			newSlice[i] = newVal
+		}
+		return newSlice, nil
+	default:
+		return value, nil
+	}
+}
+
+// expandModelBuiltinMacros replaces the env and file macros in every model
+// field that supports macros
+func expandModelBuiltinMacros(modelId string, modelConfig *ModelConfig) error {
+	err := forEachMacroField(modelConfig, func(fieldName, value string) (string, error) {
+		expanded, err := expandBuiltinMacros(value)
+		if err != nil {
+			return "", unresolvedMacroFieldError(modelId, fieldName, err)
+		}
+		return expanded, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return forEachMacroMap(modelConfig, func(fieldName string, value map[string]any) (map[string]any, error) {
+		expanded, err := expandBuiltinMacrosInValue(value)
+		if err != nil {
+			return nil, unresolvedMacroFieldError(modelId, fieldName, err)
+		}
+		return expanded.(map[string]any), nil
+	})
+}
+
+func unresolvedMacroFieldError(modelId, fieldName string, err error) error {
+	if unresolved, ok := err.(*unresolvedMacroError); ok {
+		return fmt.Errorf("unresolved macro '%s' found in %s.%s: %s", unresolved.macro, modelId, fieldName, unresolved.reason)
+	}
+	return err
+}
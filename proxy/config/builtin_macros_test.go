@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_EnvAndFileMacros(t *testing.T) {
+	t.Setenv("LLAMA_SWAP_TEST_MODELS", "/srv/models")
+	t.Setenv("LLAMA_SWAP_TEST_EMPTY", "")
+	secretFile := filepath.Join(t.TempDir(), "api-key")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("sk-secret\n"), 0600))
+
+	content := `
+macros:
+  "models": "${env.LLAMA_SWAP_TEST_MODELS}"
+models:
+  test:
+    cmd: server -m ${models}/model.gguf --threads ${env.LLAMA_SWAP_TEST_UNSET:-8} --alias ${env.LLAMA_SWAP_TEST_EMPTY:-none}
+    proxy: http://localhost:8080
+    headers:
+      Authorization: "Bearer ${file:` + secretFile + `}"
+    metadata:
+      host: "${HOSTNAME}"
+      platform: "${OS}/${ARCH}"
+      nested: ["${env.LLAMA_SWAP_TEST_MODELS}"]
+`
+
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	model := config.Models["test"]
+	assert.Equal(t, "server -m /srv/models/model.gguf --threads 8 --alias none", model.Cmd)
+	assert.Equal(t, "Bearer sk-secret", model.Headers["Authorization"])
+	assert.Equal(t, hostname, model.Metadata["host"])
+	assert.Equal(t, runtime.GOOS+"/"+runtime.GOARCH, model.Metadata["platform"])
+	assert.Equal(t, []any{"/srv/models"}, model.Metadata["nested"])
+}
+
+func TestConfig_HostMacrosCanBeOverridden(t *testing.T) {
+	content := `
+macros:
+  "HOSTNAME": "gpu-box"
+models:
+  test:
+    cmd: server --alias ${HOSTNAME}
+    proxy: http://localhost:8080
+`
+
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, "server --alias gpu-box", config.Models["test"].Cmd)
+}
+
+func TestConfig_UnresolvedBuiltinMacros(t *testing.T) {
+	missingFile := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name  string
+		model string
+		err   string
+	}{
+		{
+			name:  "unset env",
+			model: "cmd: server --key ${env.LLAMA_SWAP_TEST_UNSET}",
+			err:   "unresolved macro '${env.LLAMA_SWAP_TEST_UNSET}' found in test.cmd: environment variable LLAMA_SWAP_TEST_UNSET is not set",
+		},
+		{
+			name:  "missing file",
+			model: "cmd: server\n    headers:\n      x-api-key: ${file:" + missingFile + "}",
+			err:   "unresolved macro '${file:" + missingFile + "}' found in test.headers.x-api-key: open " + missingFile,
+		},
+		{
+			name:  "nested value",
+			model: "cmd: server\n    metadata:\n      key: [\"${env.LLAMA_SWAP_TEST_UNSET}\"]",
+			err:   "unresolved macro '${env.LLAMA_SWAP_TEST_UNSET}' found in test.metadata: environment variable LLAMA_SWAP_TEST_UNSET is not set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfigFromReader(strings.NewReader("models:\n  test:\n    proxy: http://localhost:8080\n    " + tt.model + "\n"))
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
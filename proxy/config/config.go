@@ -1,9 +1,12 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
@@ -51,6 +54,20 @@ func (ml *MacroList) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// MarshalYAML writes the macros as a mapping in definition order
+func (ml MacroList) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, entry := range ml {
+		var key, value yaml.Node
+		key.SetString(entry.Name)
+		if err := value.Encode(entry.Value); err != nil {
+			return nil, fmt.Errorf("failed to encode macro value for '%s': %w", entry.Name, err)
+		}
+		node.Content = append(node.Content, &key, &value)
+	}
+	return node, nil
+}
+
 // Get retrieves a macro value by name
 func (ml MacroList) Get(name string) (any, bool) {
 	for _, entry := range ml {
@@ -75,6 +92,17 @@ type GroupConfig struct {
 	Exclusive  bool     `yaml:"exclusive"`
 	Persistent bool     `yaml:"persistent"`
 	Members    []string `yaml:"members"`
+
+	// defaults for the members, see applyGroupDefaults
+	UnloadAfter      int          `yaml:"ttl"`
+	Env              []string     `yaml:"env"`
+	Macros           MacroList    `yaml:"macros"`
+	ConcurrencyLimit int          `yaml:"concurrencyLimit"`
+	Filters          ModelFilters `yaml:"filters"`
+
+	// IdleTTL unloads all members together when none of them has handled a
+	// request for this many seconds
+	IdleTTL int `yaml:"idleTtl"`
 }
 
 var (
@@ -102,12 +130,104 @@ func (c *GroupConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 type HooksConfig struct {
 	OnStartup HookOnStartup `yaml:"on_startup"`
+
+	// cron style actions
+	Schedule []ScheduledHook `yaml:"schedule"`
+
+	// actions run when events happen
+	OnModelReady   []HookAction `yaml:"on_model_ready"`
+	OnModelStopped []HookAction `yaml:"on_model_stopped"`
+	OnIdle         []HookAction `yaml:"on_idle"`
+	OnCrash        []HookAction `yaml:"on_crash"`
 }
 
 type HookOnStartup struct {
 	Preload []string `yaml:"preload"`
 }
 
+// HookAction runs a command or calls a webhook with the event payload as JSON
+type HookAction struct {
+	Exec    string `yaml:"exec"`
+	Webhook string `yaml:"webhook"`
+
+	// only run for events of these models, empty means all models
+	Models []string `yaml:"models"`
+
+	// on_idle only: seconds without requests before the action runs
+	After int `yaml:"after"`
+}
+
+// ScheduledHook runs at the times matching Cron, e.g. "0 8 * * 1-5"
+type ScheduledHook struct {
+	Cron string `yaml:"cron"`
+
+	Preload   []string `yaml:"preload"`
+	Unload    []string `yaml:"unload"`
+	UnloadAll bool     `yaml:"unloadAll"`
+
+	HookAction `yaml:",inline"`
+}
+
+// default seconds without requests for on_idle actions
+const DefaultIdleAfter = 300
+
+// RateLimitConfig limits how many requests and tokens each client can use. Clients
+// are identified by the keyBy setting, see ClientIdentityValid
+type RateLimitConfig struct {
+	KeyBy             string `yaml:"keyBy"`
+	RequestsPerMinute int    `yaml:"requestsPerMinute"`
+	TokensPerHour     int    `yaml:"tokensPerHour"`
+	TokensPerDay      int    `yaml:"tokensPerDay"`
+}
+
+// Enabled returns true if any limit is set
+func (r RateLimitConfig) Enabled() bool {
+	return r.RequestsPerMinute > 0 || r.TokensPerHour > 0 || r.TokensPerDay > 0
+}
+
+// ClientIdentityValid checks the value used to identify clients. Valid values are:
+// "" or "apiKey" (API key, falling back to client IP), "ip", or "header:<name>"
+func ClientIdentityValid(keyBy string) bool {
+	switch {
+	case keyBy == "", keyBy == "apiKey", keyBy == "ip":
+		return true
+	case strings.HasPrefix(keyBy, "header:"):
+		return strings.TrimSpace(strings.TrimPrefix(keyBy, "header:")) != ""
+	default:
+		return false
+	}
+}
+
+// UsageConfig controls how token usage is attributed to users and persisted
+type UsageConfig struct {
+	// same values as RateLimitConfig.KeyBy
+	KeyBy string `yaml:"keyBy"`
+
+	// file where the usage totals are persisted, disabled when empty
+	File string `yaml:"file"`
+}
+
+// PeerConfig is another llama-swap instance whose models are served through this one
+type PeerConfig struct {
+	URL string `yaml:"url"`
+
+	// added to requests sent to the peer, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+}
+
+// TLSConfig enables HTTPS, the matching command line flags take precedence.
+// Relative paths are resolved against the directory of the configuration file.
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// CA bundle to verify client certificates against (mutual TLS)
+	ClientCAFile string `yaml:"clientCAFile"`
+
+	// optional ip/port for a plain HTTP listener that redirects to HTTPS
+	RedirectListen string `yaml:"redirectListen"`
+}
+
 type Config struct {
 	HealthCheckTimeout int                    `yaml:"healthCheckTimeout"`
 	LogRequests        bool                   `yaml:"logRequests"`
@@ -123,11 +243,50 @@ type Config struct {
 	// map aliases to actual model IDs
 	aliases map[string]string
 
+	// files merged into this configuration, only used by LoadConfig
+	Include []string `yaml:"include"`
+
 	// automatic port assignments
 	StartPort int `yaml:"startPort"`
 
+	// seconds to wait for in-flight requests on shutdown
+	DrainTimeout int `yaml:"drainTimeout"`
+
+	// running processes are recorded here and adopted after a restart, disabled when empty
+	StateFile string `yaml:"stateFile"`
+
+	// parent cgroup for the per model cgroups used by resources limits
+	CgroupRoot string `yaml:"cgroupRoot"`
+
 	// hooks, see: #209
 	Hooks HooksConfig `yaml:"hooks"`
+
+	// per client request and token limits
+	RateLimits RateLimitConfig `yaml:"rateLimits"`
+
+	// usage accounting per user
+	Usage UsageConfig `yaml:"usage"`
+
+	// virtual models that route requests to real models, key is the router ID
+	Routers map[string]RouterConfig `yaml:"routers"`
+
+	// other llama-swap instances, key is the peer ID
+	Peers map[string]PeerConfig `yaml:"peers"`
+
+	// lifecycle events delivered to webhooks and commands
+	Notifications []NotificationConfig `yaml:"notifications"`
+
+	// reject unknown keys, e.g. a misspelled ttl
+	Strict bool `yaml:"strict"`
+
+	// runtime changes to models and groups through /api/config
+	ConfigAPI ConfigAPIConfig `yaml:"configAPI"`
+
+	// models generated from the GGUF files in directories
+	Discovery []DiscoveryConfig `yaml:"discovery"`
+
+	// HTTPS, changes require a restart
+	TLS TLSConfig `yaml:"tls"`
 }
 
 func (c *Config) RealModelName(search string) (string, bool) {
@@ -148,33 +307,79 @@ func (c *Config) FindConfig(modelName string) (ModelConfig, string, bool) {
 	}
 }
 
+// defaultConfig returns the configuration values used for missing keys
+func defaultConfig() Config {
+	return Config{
+		HealthCheckTimeout: 120,
+		StartPort:          5800,
+		LogLevel:           "info",
+		MetricsMaxInMemory: 1000,
+		DrainTimeout:       30,
+		CgroupRoot:         DefaultCgroupRoot,
+	}
+}
+
 func LoadConfig(path string) (Config, error) {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return Config{}, err
 	}
-	defer file.Close()
-	return LoadConfigFromReader(file)
+	return loadConfigData(path, data)
+}
+
+// loadConfigData loads data, the contents of the configuration file at path,
+// with its included files
+func loadConfigData(path string, data []byte) (Config, error) {
+	merged, err := mergeIncludes(path, data)
+	if err != nil {
+		return Config{}, err
+	}
+	return loadConfigFromReader(bytes.NewReader(merged), filepath.Dir(path))
 }
 
 func LoadConfigFromReader(r io.Reader) (Config, error) {
+	return loadConfigFromReader(r, "")
+}
+
+// resolvePaths makes the relative file and directory paths of the
+// configuration relative to dir, the directory of the configuration file
+func (c *Config) resolvePaths(dir string) {
+	paths := []*string{&c.TLS.CertFile, &c.TLS.KeyFile, &c.TLS.ClientCAFile}
+	for i := range c.Discovery {
+		paths = append(paths, &c.Discovery[i].Dir)
+	}
+
+	for _, path := range paths {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+}
+
+// loadConfigFromReader loads the configuration, relative paths are resolved
+// against dir when it is set
+func loadConfigFromReader(r io.Reader, dir string) (Config, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
 		return Config{}, err
 	}
 
-	// default configuration values
-	config := Config{
-		HealthCheckTimeout: 120,
-		StartPort:          5800,
-		LogLevel:           "info",
-		MetricsMaxInMemory: 1000,
-	}
+	config := defaultConfig()
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
 		return Config{}, err
 	}
 
+	if config.Strict {
+		// decode again now that strict mode is known
+		config = defaultConfig()
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil {
+			return Config{}, err
+		}
+	}
+
 	if config.HealthCheckTimeout < 15 {
 		// set a minimum of 15 seconds
 		config.HealthCheckTimeout = 15
@@ -184,14 +389,39 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 		return Config{}, fmt.Errorf("startPort must be greater than 1")
 	}
 
-	// Populate the aliases map
-	config.aliases = make(map[string]string)
-	for modelName, modelConfig := range config.Models {
-		for _, alias := range modelConfig.Aliases {
-			if _, found := config.aliases[alias]; found {
-				return Config{}, fmt.Errorf("duplicate alias %s found in model: %s", alias, modelName)
+	if config.DrainTimeout < 0 {
+		return Config{}, fmt.Errorf("drainTimeout must be greater than or equal to 0")
+	}
+
+	if !ClientIdentityValid(config.RateLimits.KeyBy) {
+		return Config{}, fmt.Errorf("rateLimits.keyBy must be one of apiKey, ip or header:<name>, got: %s", config.RateLimits.KeyBy)
+	}
+	if !ClientIdentityValid(config.Usage.KeyBy) {
+		return Config{}, fmt.Errorf("usage.keyBy must be one of apiKey, ip or header:<name>, got: %s", config.Usage.KeyBy)
+	}
+	for i, key := range config.ConfigAPI.APIKeys {
+		expanded, err := expandBuiltinMacros(key)
+		if err != nil {
+			if unresolved, ok := err.(*unresolvedMacroError); ok {
+				return Config{}, fmt.Errorf("unresolved macro '%s' found in configAPI.apiKeys[%d]: %s", unresolved.macro, i, unresolved.reason)
 			}
-			config.aliases[alias] = modelName
+			return Config{}, err
+		}
+		if strings.TrimSpace(expanded) == "" {
+			return Config{}, fmt.Errorf("configAPI.apiKeys[%d] must not be empty", i)
+		}
+		config.ConfigAPI.APIKeys[i] = expanded
+	}
+	if config.RateLimits.RequestsPerMinute < 0 || config.RateLimits.TokensPerHour < 0 || config.RateLimits.TokensPerDay < 0 {
+		return Config{}, fmt.Errorf("rateLimits values must be greater than or equal to 0")
+	}
+
+	for peerID, peer := range config.Peers {
+		if peer.URL == "" {
+			return Config{}, fmt.Errorf("peer %s: url is required", peerID)
+		}
+		if u, err := url.Parse(peer.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("peer %s: url must be an http or https URL, got: %s", peerID, peer.URL)
 		}
 	}
 
@@ -208,6 +438,20 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 		}
 	}
 
+	if dir != "" {
+		config.resolvePaths(dir)
+	}
+
+	// generated models go through the same macro substitution and validation
+	if err := discoverModels(&config); err != nil {
+		return Config{}, err
+	}
+
+	// group defaults are substituted like the members' own settings
+	if err := applyGroupDefaults(&config); err != nil {
+		return Config{}, err
+	}
+
 	// Get and sort all model IDs first, makes testing more consistent
 	modelIds := make([]string, 0, len(config.Models))
 	for modelId := range config.Models {
@@ -230,28 +474,7 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 			}
 		}
 
-		// Merge global config and model macros. Model macros take precedence
-		mergedMacros := make(MacroList, 0, len(config.Macros)+len(modelConfig.Macros))
-		mergedMacros = append(mergedMacros, MacroEntry{Name: "MODEL_ID", Value: modelId})
-
-		// Add global macros first
-		mergedMacros = append(mergedMacros, config.Macros...)
-
-		// Add model macros (can override global)
-		for _, entry := range modelConfig.Macros {
-			// Remove any existing global macro with same name
-			found := false
-			for i, existing := range mergedMacros {
-				if existing.Name == entry.Name {
-					mergedMacros[i] = entry // Override
-					found = true
-					break
-				}
-			}
-			if !found {
-				mergedMacros = append(mergedMacros, entry)
-			}
-		}
+		mergedMacros := config.modelMacros(modelId, modelConfig)
 
 		// First pass: Substitute user-defined macros in reverse order (LIFO - last defined first)
 		// This allows later macros to reference earlier ones
@@ -260,29 +483,28 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 			macroSlug := fmt.Sprintf("${%s}", entry.Name)
 			macroStr := fmt.Sprintf("%v", entry.Value)
 
-			// Substitute in command fields
-			modelConfig.Cmd = strings.ReplaceAll(modelConfig.Cmd, macroSlug, macroStr)
-			modelConfig.CmdStop = strings.ReplaceAll(modelConfig.CmdStop, macroSlug, macroStr)
-			modelConfig.Proxy = strings.ReplaceAll(modelConfig.Proxy, macroSlug, macroStr)
-			modelConfig.CheckEndpoint = strings.ReplaceAll(modelConfig.CheckEndpoint, macroSlug, macroStr)
-			modelConfig.Filters.StripParams = strings.ReplaceAll(modelConfig.Filters.StripParams, macroSlug, macroStr)
-
-			// Substitute in metadata (recursive)
-			if len(modelConfig.Metadata) > 0 {
-				var err error
-				result, err := substituteMacroInValue(modelConfig.Metadata, entry.Name, entry.Value)
-				if err != nil {
-					return Config{}, fmt.Errorf("model %s metadata: %s", modelId, err.Error())
-				}
-				modelConfig.Metadata = result.(map[string]any)
+			replaceMacroFields(&modelConfig, macroSlug, macroStr)
+
+			// Substitute in metadata and param filters (recursive)
+			if err := substituteMacroInModelMaps(&modelConfig, entry.Name, entry.Value); err != nil {
+				return Config{}, fmt.Errorf("model %s %s", modelId, err.Error())
 			}
 		}
 
+		// Second pass: substitute the env and file macros, also when used in the
+		// value of a user-defined macro
+		if err := expandModelBuiltinMacros(modelId, &modelConfig); err != nil {
+			return Config{}, err
+		}
+
 		// Final pass: check if PORT macro is needed after macro expansion
 		// ${PORT} is a resource on the local machine so a new port is only allocated
 		// if it is required in either cmd or proxy keys
 		cmdHasPort := strings.Contains(modelConfig.Cmd, "${PORT}")
 		proxyHasPort := strings.Contains(modelConfig.Proxy, "${PORT}")
+		if modelConfig.IsRemote() && proxyHasPort {
+			return Config{}, fmt.Errorf("model %s: proxy must be set to the remote server when cmd is empty", modelId)
+		}
 		if cmdHasPort || proxyHasPort { // either has it
 			if !cmdHasPort && proxyHasPort { // but both don't have it
 				return Config{}, fmt.Errorf("model %s: proxy uses ${PORT} but cmd does not - ${PORT} is only available when used in cmd", modelId)
@@ -293,33 +515,24 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 			macroSlug := "${PORT}"
 			macroStr := fmt.Sprintf("%v", nextPort)
 
-			modelConfig.Cmd = strings.ReplaceAll(modelConfig.Cmd, macroSlug, macroStr)
-			modelConfig.CmdStop = strings.ReplaceAll(modelConfig.CmdStop, macroSlug, macroStr)
-			modelConfig.Proxy = strings.ReplaceAll(modelConfig.Proxy, macroSlug, macroStr)
+			replaceMacroFields(&modelConfig, macroSlug, macroStr)
 
-			// Substitute PORT in metadata
-			if len(modelConfig.Metadata) > 0 {
-				var err error
-				result, err := substituteMacroInValue(modelConfig.Metadata, portEntry.Name, portEntry.Value)
-				if err != nil {
-					return Config{}, fmt.Errorf("model %s metadata: %s", modelId, err.Error())
-				}
-				modelConfig.Metadata = result.(map[string]any)
+			// Substitute PORT in metadata and param filters
+			if err := substituteMacroInModelMaps(&modelConfig, portEntry.Name, portEntry.Value); err != nil {
+				return Config{}, fmt.Errorf("model %s %s", modelId, err.Error())
 			}
 
+			mergedMacros = append(mergedMacros, portEntry)
 			nextPort++
 		}
 
-		// make sure there are no unknown macros that have not been replaced
-		fieldMap := map[string]string{
-			"cmd":                 modelConfig.Cmd,
-			"cmdStop":             modelConfig.CmdStop,
-			"proxy":               modelConfig.Proxy,
-			"checkEndpoint":       modelConfig.CheckEndpoint,
-			"filters.stripParams": modelConfig.Filters.StripParams,
+		// Expressions like ${= slots * ctx_per_slot}, after ${PORT} so it can be used
+		if err := evaluateModelExpressions(modelId, &modelConfig, mergedMacros); err != nil {
+			return Config{}, err
 		}
 
-		for fieldName, fieldValue := range fieldMap {
+		// make sure there are no unknown macros that have not been replaced
+		err = forEachMacroField(&modelConfig, func(fieldName, fieldValue string) (string, error) {
 			matches := macroPatternRegex.FindAllStringSubmatch(fieldValue, -1)
 			for _, match := range matches {
 				macroName := match[1]
@@ -328,18 +541,97 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 				}
 				// Reserved macros are always valid (they should have been substituted already)
 				if macroName == "PORT" || macroName == "MODEL_ID" {
-					return Config{}, fmt.Errorf("macro '${%s}' should have been substituted in %s.%s", macroName, modelId, fieldName)
+					return "", fmt.Errorf("macro '${%s}' should have been substituted in %s.%s", macroName, modelId, fieldName)
 				}
 				// Any other macro is unknown
-				return Config{}, fmt.Errorf("unknown macro '${%s}' found in %s.%s", macroName, modelId, fieldName)
+				return "", fmt.Errorf("unknown macro '${%s}' found in %s.%s", macroName, modelId, fieldName)
 			}
+			return fieldValue, nil
+		})
+		if err != nil {
+			return Config{}, err
 		}
 
-		// Check for unknown macros in metadata
-		if len(modelConfig.Metadata) > 0 {
-			if err := validateMetadataForUnknownMacros(modelConfig.Metadata, modelId); err != nil {
-				return Config{}, err
+		switch modelConfig.Filters.ThinkTags {
+		case "", "extract", "strip":
+		default:
+			return Config{}, fmt.Errorf("model %s filters.thinkTags must be extract or strip, got: %s", modelId, modelConfig.Filters.ThinkTags)
+		}
+
+		// compile the content replacement patterns once, for all requests
+		for i := range modelConfig.Filters.ReplaceContent {
+			replacement := &modelConfig.Filters.ReplaceContent[i]
+			if replacement.Pattern == "" {
+				return Config{}, fmt.Errorf("model %s filters.replaceContent[%d]: pattern is required", modelId, i)
+			}
+			re, err := regexp.Compile(replacement.Pattern)
+			if err != nil {
+				return Config{}, fmt.Errorf("model %s filters.replaceContent[%d]: invalid pattern: %s", modelId, i, err.Error())
+			}
+			replacement.regexp = re
+		}
+
+		if err := modelConfig.Resources.Validate(); err != nil {
+			return Config{}, fmt.Errorf("model %s resources.%v", modelId, err)
+		}
+
+		// Check for unknown macros in metadata and param filters
+		err = forEachMacroMap(&modelConfig, func(fieldName string, value map[string]any) (map[string]any, error) {
+			return value, validateNestedForUnknownMacros(value, modelId, fieldName)
+		})
+		if err != nil {
+			return Config{}, err
+		}
+
+		config.Models[modelId] = modelConfig
+	}
+
+	// Populate the aliases map, after macros are substituted in the aliases
+	config.aliases = make(map[string]string)
+	for _, modelId := range modelIds {
+		for _, alias := range config.Models[modelId].Aliases {
+			if _, found := config.aliases[alias]; found {
+				return Config{}, fmt.Errorf("duplicate alias %s found in model: %s", alias, modelId)
+			}
+			config.aliases[alias] = modelId
+		}
+	}
+
+	for _, modelId := range modelIds {
+		modelConfig := config.Models[modelId]
+
+		// validate traffic splitting and mirroring, targets are stored as real model IDs
+		splitTotal := 0
+		for i, split := range modelConfig.SplitTraffic {
+			realName, found := config.RealModelName(split.Model)
+			if !found {
+				return Config{}, fmt.Errorf("model %s splitTraffic[%d]: unknown model %s", modelId, i, split.Model)
+			}
+			if realName == modelId {
+				return Config{}, fmt.Errorf("model %s splitTraffic[%d]: can not split traffic to itself", modelId, i)
+			}
+			if split.Percent < 0 {
+				return Config{}, fmt.Errorf("model %s splitTraffic[%d]: percent must be greater than or equal to 0", modelId, i)
+			}
+			modelConfig.SplitTraffic[i].Model = realName
+			splitTotal += split.Percent
+		}
+		if splitTotal > 100 {
+			return Config{}, fmt.Errorf("model %s splitTraffic: percent total must not be more than 100, got: %d", modelId, splitTotal)
+		}
+
+		if modelConfig.Mirror.Model != "" {
+			realName, found := config.RealModelName(modelConfig.Mirror.Model)
+			if !found {
+				return Config{}, fmt.Errorf("model %s mirror: unknown model %s", modelId, modelConfig.Mirror.Model)
 			}
+			if realName == modelId {
+				return Config{}, fmt.Errorf("model %s mirror: can not mirror to itself", modelId)
+			}
+			if modelConfig.Mirror.Percent < 0 || modelConfig.Mirror.Percent > 100 {
+				return Config{}, fmt.Errorf("model %s mirror: percent must be between 0 and 100, got: %d", modelId, modelConfig.Mirror.Percent)
+			}
+			modelConfig.Mirror.Model = realName
 		}
 
 		config.Models[modelId] = modelConfig
@@ -365,6 +657,18 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 		}
 	}
 
+	if err := validateRouters(&config); err != nil {
+		return Config{}, err
+	}
+
+	if err := validateHooks(&config); err != nil {
+		return Config{}, err
+	}
+
+	if err := validateNotifications(&config); err != nil {
+		return Config{}, err
+	}
+
 	// clean up hooks preload
 	if len(config.Hooks.OnStartup.Preload) > 0 {
 		var toPreload []string
@@ -384,6 +688,99 @@ func LoadConfigFromReader(r io.Reader) (Config, error) {
 	return config, nil
 }
 
+// validateHooks checks the scheduled and event hooks. Model IDs and aliases
+// are replaced with the real model ID.
+func validateHooks(config *Config) error {
+	realModelNames := func(field string, models []string) ([]string, error) {
+		result := make([]string, 0, len(models))
+		for _, model := range models {
+			realName, found := config.RealModelName(strings.TrimSpace(model))
+			if !found {
+				return nil, fmt.Errorf("%s: unknown model %s", field, model)
+			}
+			result = append(result, realName)
+		}
+		return result, nil
+	}
+
+	validateAction := func(field string, action *HookAction, required bool) error {
+		if action.Exec == "" && action.Webhook == "" {
+			if required {
+				return fmt.Errorf("%s: exec or webhook is required", field)
+			}
+			return nil
+		}
+		if action.Exec != "" {
+			if _, err := SanitizeCommand(action.Exec); err != nil {
+				return fmt.Errorf("%s: invalid exec: %s", field, err.Error())
+			}
+		}
+		if action.Webhook != "" {
+			if u, err := url.Parse(action.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("%s: webhook must be an http or https URL, got: %s", field, action.Webhook)
+			}
+		}
+		if action.After < 0 {
+			return fmt.Errorf("%s: after must be greater than or equal to 0", field)
+		}
+
+		models, err := realModelNames(field+".models", action.Models)
+		if err != nil {
+			return err
+		}
+		action.Models = models
+		return nil
+	}
+
+	for i := range config.Hooks.Schedule {
+		hook := &config.Hooks.Schedule[i]
+		field := fmt.Sprintf("hooks.schedule[%d]", i)
+		if _, err := ParseCron(hook.Cron); err != nil {
+			return fmt.Errorf("%s: invalid cron %q: %s", field, hook.Cron, err.Error())
+		}
+		if len(hook.Preload) == 0 && len(hook.Unload) == 0 && !hook.UnloadAll && hook.Exec == "" && hook.Webhook == "" {
+			return fmt.Errorf("%s: preload, unload, unloadAll, exec or webhook is required", field)
+		}
+
+		var err error
+		if hook.Preload, err = realModelNames(field+".preload", hook.Preload); err != nil {
+			return err
+		}
+		if hook.Unload, err = realModelNames(field+".unload", hook.Unload); err != nil {
+			return err
+		}
+		if err := validateAction(field, &hook.HookAction, false); err != nil {
+			return err
+		}
+	}
+
+	eventHooks := []struct {
+		name    string
+		actions []HookAction
+	}{
+		{"on_model_ready", config.Hooks.OnModelReady},
+		{"on_model_stopped", config.Hooks.OnModelStopped},
+		{"on_idle", config.Hooks.OnIdle},
+		{"on_crash", config.Hooks.OnCrash},
+	}
+	for _, eventHook := range eventHooks {
+		for i := range eventHook.actions {
+			field := fmt.Sprintf("hooks.%s[%d]", eventHook.name, i)
+			if err := validateAction(field, &eventHook.actions[i], true); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range config.Hooks.OnIdle {
+		if config.Hooks.OnIdle[i].After == 0 {
+			config.Hooks.OnIdle[i].After = DefaultIdleAfter
+		}
+	}
+
+	return nil
+}
+
 // rewrites the yaml to include a default group with any orphaned models
 func AddDefaultGroupToConfig(config Config) Config {
 
@@ -511,20 +908,21 @@ func validateMacro(name string, value any) error {
 	return nil
 }
 
-// validateMetadataForUnknownMacros recursively checks for any remaining macro references in metadata
-func validateMetadataForUnknownMacros(value any, modelId string) error {
+// validateNestedForUnknownMacros recursively checks for any remaining macro references in
+// nested values like metadata and filters.setParams
+func validateNestedForUnknownMacros(value any, modelId string, fieldName string) error {
 	switch v := value.(type) {
 	case string:
 		matches := macroPatternRegex.FindAllStringSubmatch(v, -1)
 		for _, match := range matches {
 			macroName := match[1]
-			return fmt.Errorf("model %s metadata: unknown macro '${%s}'", modelId, macroName)
+			return fmt.Errorf("model %s %s: unknown macro '${%s}'", modelId, fieldName, macroName)
 		}
 		return nil
 
 	case map[string]any:
 		for _, val := range v {
-			if err := validateMetadataForUnknownMacros(val, modelId); err != nil {
+			if err := validateNestedForUnknownMacros(val, modelId, fieldName); err != nil {
 				return err
 			}
 		}
@@ -532,7 +930,7 @@ func validateMetadataForUnknownMacros(value any, modelId string) error {
 
 	case []any:
 		for _, val := range v {
-			if err := validateMetadataForUnknownMacros(val, modelId); err != nil {
+			if err := validateNestedForUnknownMacros(val, modelId, fieldName); err != nil {
 				return err
 			}
 		}
@@ -544,6 +942,135 @@ func validateMetadataForUnknownMacros(value any, modelId string) error {
 	}
 }
 
+// modelMacros merges the global and model macros of a model. Model macros
+// take precedence.
+func (c *Config) modelMacros(modelId string, modelConfig ModelConfig) MacroList {
+	mergedMacros := make(MacroList, 0, len(c.Macros)+len(modelConfig.Macros))
+	mergedMacros = append(mergedMacros, MacroEntry{Name: "MODEL_ID", Value: modelId})
+	mergedMacros = append(mergedMacros, hostMacros()...)
+
+	// Add global macros first
+	mergedMacros = append(mergedMacros, c.Macros...)
+
+	// Add model macros (can override global)
+	for _, entry := range modelConfig.Macros {
+		// Remove any existing global macro with same name
+		found := false
+		for i, existing := range mergedMacros {
+			if existing.Name == entry.Name {
+				mergedMacros[i] = entry // Override
+				found = true
+				break
+			}
+		}
+		if !found {
+			mergedMacros = append(mergedMacros, entry)
+		}
+	}
+	return mergedMacros
+}
+
+// macroField is a string field of a model that supports macros
+type macroField struct {
+	name  string
+	value *string
+}
+
+// forEachMacroField calls fn with the name and value of every string field of a
+// model that supports macros and stores the returned value. The macro passes
+// all use it so they cover the same fields. Stops at the first error.
+func forEachMacroField(modelConfig *ModelConfig, fn func(field, value string) (string, error)) error {
+	fields := []macroField{
+		{"cmd", &modelConfig.Cmd},
+		{"cmdStop", &modelConfig.CmdStop},
+		{"proxy", &modelConfig.Proxy},
+		{"checkEndpoint", &modelConfig.CheckEndpoint},
+		{"filters.stripParams", &modelConfig.Filters.StripParams},
+		{"filters.prependSystemPrompt", &modelConfig.Filters.PrependSystemPrompt},
+		{"filters.appendSystemPrompt", &modelConfig.Filters.AppendSystemPrompt},
+		{"name", &modelConfig.Name},
+		{"description", &modelConfig.Description},
+		{"useModelName", &modelConfig.UseModelName},
+	}
+	for i := range modelConfig.Env {
+		fields = append(fields, macroField{fmt.Sprintf("env[%d]", i), &modelConfig.Env[i]})
+	}
+	for i := range modelConfig.Aliases {
+		fields = append(fields, macroField{fmt.Sprintf("aliases[%d]", i), &modelConfig.Aliases[i]})
+	}
+	for i := range modelConfig.Filters.ReplaceContent {
+		fields = append(fields, macroField{fmt.Sprintf("filters.replaceContent[%d].replacement", i), &modelConfig.Filters.ReplaceContent[i].Replacement})
+	}
+
+	for _, field := range fields {
+		value, err := fn(field.name, *field.value)
+		if err != nil {
+			return err
+		}
+		*field.value = value
+	}
+
+	headers := make([]string, 0, len(modelConfig.Headers))
+	for name := range modelConfig.Headers {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+	for _, name := range headers {
+		value, err := fn("headers."+name, modelConfig.Headers[name])
+		if err != nil {
+			return err
+		}
+		modelConfig.Headers[name] = value
+	}
+	return nil
+}
+
+// forEachMacroMap calls fn with the name and value of every non-empty nested
+// map field of a model that supports macros and stores the returned value:
+// metadata, filters.setParams and filters.defaultParams. Stops at the first
+// error.
+func forEachMacroMap(modelConfig *ModelConfig, fn func(field string, value map[string]any) (map[string]any, error)) error {
+	fields := []struct {
+		name  string
+		value *map[string]any
+	}{
+		{"metadata", &modelConfig.Metadata},
+		{"filters.setParams", &modelConfig.Filters.SetParams},
+		{"filters.defaultParams", &modelConfig.Filters.DefaultParams},
+	}
+	for _, field := range fields {
+		if len(*field.value) == 0 {
+			continue
+		}
+		value, err := fn(field.name, *field.value)
+		if err != nil {
+			return err
+		}
+		*field.value = value
+	}
+	return nil
+}
+
+// replaceMacroFields replaces macroSlug with macroStr in every string field
+// that supports macros
+func replaceMacroFields(modelConfig *ModelConfig, macroSlug, macroStr string) {
+	forEachMacroField(modelConfig, func(_, value string) (string, error) {
+		return strings.ReplaceAll(value, macroSlug, macroStr), nil
+	})
+}
+
+// substituteMacroInModelMaps substitutes a single macro in the nested map fields of a
+// model: metadata, filters.setParams and filters.defaultParams
+func substituteMacroInModelMaps(modelConfig *ModelConfig, macroName string, macroValue any) error {
+	return forEachMacroMap(modelConfig, func(fieldName string, value map[string]any) (map[string]any, error) {
+		result, err := substituteMacroInValue(value, macroName, macroValue)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", fieldName, err.Error())
+		}
+		return result.(map[string]any), nil
+	})
+}
+
 // substituteMacroInValue recursively substitutes a single macro in a value structure
 // This is called once per macro, allowing LIFO substitution order
 func substituteMacroInValue(value any, macroName string, macroValue any) (any, error) {
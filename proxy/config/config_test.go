@@ -1,6 +1,7 @@
 package config
 
 import (
+	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
@@ -176,6 +177,30 @@ models:
 
 	})
 
+	t.Run("${PORT} in every field that supports macros", func(t *testing.T) {
+		content := `
+models:
+  model1:
+    cmd: svr --port ${PORT}
+    checkEndpoint: /health?port=${PORT}
+    aliases: ["model-${PORT}"]
+    headers:
+      X-Port: "${PORT}"
+`
+		config, err := LoadConfigFromReader(strings.NewReader(content))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		model := config.Models["model1"]
+		assert.Equal(t, "/health?port=5800", model.CheckEndpoint)
+		assert.Equal(t, []string{"model-5800"}, model.Aliases)
+		assert.Equal(t, "5800", model.Headers["X-Port"])
+		realName, found := config.RealModelName("model-5800")
+		assert.True(t, found)
+		assert.Equal(t, "model1", realName)
+	})
+
 	t.Run("Proxy value required if no ${PORT} in cmd", func(t *testing.T) {
 		content := `
 models:
@@ -761,3 +786,324 @@ models:
 		})
 	}
 }
+
+func TestConfig_RateLimitsKeyBy(t *testing.T) {
+	for _, keyBy := range []string{"apiKey", "ip", "header:X-User"} {
+		config, err := LoadConfigFromReader(strings.NewReader("rateLimits:\n  keyBy: " + keyBy + "\n  requestsPerMinute: 10\n"))
+		if assert.NoError(t, err, keyBy) {
+			assert.Equal(t, keyBy, config.RateLimits.KeyBy)
+			assert.True(t, config.RateLimits.Enabled())
+		}
+	}
+
+	_, err := LoadConfigFromReader(strings.NewReader("rateLimits:\n  keyBy: cookie\n"))
+	assert.ErrorContains(t, err, "rateLimits.keyBy must be one of")
+
+	_, err = LoadConfigFromReader(strings.NewReader("rateLimits:\n  tokensPerDay: -1\n"))
+	assert.ErrorContains(t, err, "rateLimits values must be greater than or equal to 0")
+}
+
+func TestConfig_Routers(t *testing.T) {
+	content := `
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    aliases: [m1]
+  model2:
+    cmd: path/to/cmd --port ${PORT}
+routers:
+  auto:
+    matchPrefixes: ["gpt-", "gpt-4"]
+    rules:
+      - model: m1
+        hasImages: true
+    default: model2
+`
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	router := config.Routers["auto"]
+	assert.Equal(t, "model1", router.Rules[0].Model, "aliases resolve to the real model")
+	assert.True(t, *router.Rules[0].HasImages)
+	assert.Nil(t, router.Rules[0].HasTools)
+	assert.Equal(t, "model2", router.Default)
+
+	for _, model := range []string{"auto", "gpt-4o", "gpt-3.5-turbo"} {
+		id, _, found := config.FindRouter(model)
+		assert.True(t, found, model)
+		assert.Equal(t, "auto", id)
+	}
+	_, _, found := config.FindRouter("llama")
+	assert.False(t, found)
+
+	tests := []struct {
+		name    string
+		routers string
+		err     string
+	}{
+		{"shadows a model", "routers:\n  m1:\n    default: model1\n", "router m1: ID is already used by a model or alias"},
+		{"unknown model", "routers:\n  auto:\n    rules:\n      - model: nope\n", "router auto rules[0]: unknown model nope"},
+		{"missing model", "routers:\n  auto:\n    rules:\n      - hasTools: true\n", "router auto rules[0]: model is required"},
+		{"unknown default", "routers:\n  auto:\n    default: nope\n", "router auto: unknown default model nope"},
+		{"empty router", "routers:\n  auto: {}\n", "router auto: rules or default is required"},
+	}
+	models := content[:strings.Index(content, "routers:")]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfigFromReader(strings.NewReader(models + tt.routers))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestConfig_SplitTrafficAndMirror(t *testing.T) {
+	models := `
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    aliases: [m1]
+  model2:
+    cmd: path/to/cmd --port ${PORT}
+  model3:
+    cmd: path/to/cmd --port ${PORT}
+`
+	config, err := LoadConfigFromReader(strings.NewReader(models + `
+  primary:
+    cmd: path/to/cmd --port ${PORT}
+    splitTraffic:
+      - model: m1
+        percent: 10
+      - model: model2
+        percent: 5
+    mirror:
+      model: model3
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	primary := config.Models["primary"]
+	assert.Equal(t, []TrafficSplit{{Model: "model1", Percent: 10}, {Model: "model2", Percent: 5}}, primary.SplitTraffic)
+	assert.Equal(t, MirrorConfig{Model: "model3", Percent: 100}, primary.Mirror, "mirror percent defaults to 100")
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"unknown split model", "    splitTraffic: [{model: nope, percent: 10}]\n", "model primary splitTraffic[0]: unknown model nope"},
+		{"split to itself", "    splitTraffic: [{model: primary, percent: 10}]\n", "model primary splitTraffic[0]: can not split traffic to itself"},
+		{"split over 100", "    splitTraffic: [{model: model1, percent: 60}, {model: model2, percent: 60}]\n", "model primary splitTraffic: percent total must not be more than 100, got: 120"},
+		{"unknown mirror model", "    mirror: {model: nope}\n", "model primary mirror: unknown model nope"},
+		{"mirror to itself", "    mirror: {model: primary}\n", "model primary mirror: can not mirror to itself"},
+		{"mirror percent", "    mirror: {model: model1, percent: 101}\n", "model primary mirror: percent must be between 0 and 100, got: 101"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfigFromReader(strings.NewReader(models + "  primary:\n    cmd: path/to/cmd --port ${PORT}\n" + tt.config))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestConfig_Peers(t *testing.T) {
+	config, err := LoadConfigFromReader(strings.NewReader(`
+peers:
+  gpu2:
+    url: http://10.0.0.2:8080
+    headers:
+      Authorization: Bearer peer-key
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, PeerConfig{
+			URL:     "http://10.0.0.2:8080",
+			Headers: map[string]string{"Authorization": "Bearer peer-key"},
+		}, config.Peers["gpu2"])
+	}
+
+	_, err = LoadConfigFromReader(strings.NewReader("peers:\n  gpu2:\n    headers: {}\n"))
+	assert.EqualError(t, err, "peer gpu2: url is required")
+
+	_, err = LoadConfigFromReader(strings.NewReader("peers:\n  gpu2:\n    url: 10.0.0.2:8080\n"))
+	assert.EqualError(t, err, "peer gpu2: url must be an http or https URL, got: 10.0.0.2:8080")
+}
+
+func TestConfig_ScheduledAndEventHooks(t *testing.T) {
+	config, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    aliases: [m1]
+  model2:
+    cmd: path/to/cmd --port ${PORT}
+hooks:
+  schedule:
+    - cron: "0 8 * * mon-fri"
+      preload: [m1]
+    - cron: "0 20 * * *"
+      unloadAll: true
+      webhook: http://localhost:9000/unloaded
+  on_model_ready:
+    - exec: notify-send ready
+      models: [m1, model2]
+  on_idle:
+    - webhook: https://example.com/idle
+  on_crash:
+    - exec: ./restart.sh
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	hooks := config.Hooks
+	if assert.Len(t, hooks.Schedule, 2) {
+		assert.Equal(t, []string{"model1"}, hooks.Schedule[0].Preload)
+		assert.True(t, hooks.Schedule[1].UnloadAll)
+		assert.Equal(t, "http://localhost:9000/unloaded", hooks.Schedule[1].Webhook)
+	}
+	assert.Equal(t, []HookAction{{Exec: "notify-send ready", Models: []string{"model1", "model2"}}}, hooks.OnModelReady)
+	assert.Equal(t, []HookAction{{Webhook: "https://example.com/idle", Models: []string{}, After: DefaultIdleAfter}}, hooks.OnIdle)
+	assert.Equal(t, "./restart.sh", hooks.OnCrash[0].Exec)
+
+	tests := []struct {
+		name  string
+		hooks string
+		err   string
+	}{
+		{"invalid cron", "schedule:\n    - cron: \"0 25 * * *\"\n      unloadAll: true", `hooks.schedule[0]: invalid cron "0 25 * * *": hour: value 25 out of range 0-23`},
+		{"no schedule action", "schedule:\n    - cron: \"0 8 * * *\"", "hooks.schedule[0]: preload, unload, unloadAll, exec or webhook is required"},
+		{"unknown preload", "schedule:\n    - cron: \"0 8 * * *\"\n      preload: [nope]", "hooks.schedule[0].preload: unknown model nope"},
+		{"no event action", "on_crash:\n    - models: [model1]", "hooks.on_crash[0]: exec or webhook is required"},
+		{"invalid webhook", "on_idle:\n    - webhook: localhost:9000", "hooks.on_idle[0]: webhook must be an http or https URL, got: localhost:9000"},
+		{"unknown model", "on_model_stopped:\n    - exec: echo\n      models: [nope]", "hooks.on_model_stopped[0].models: unknown model nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfigFromReader(strings.NewReader("models:\n  model1:\n    cmd: path/to/cmd --port ${PORT}\nhooks:\n  " + tt.hooks + "\n"))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestConfig_Notifications(t *testing.T) {
+	config, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    aliases: [m1]
+notifications:
+  - webhook: https://example.com/llama-swap
+    secret: s3cret
+    events: [process_crashed, health_check_failed]
+    models: [m1]
+  - exec: ./notify.sh
+    retries: 0
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if assert.Len(t, config.Notifications, 2) {
+		webhook := config.Notifications[0]
+		assert.Equal(t, "s3cret", webhook.Secret)
+		assert.Equal(t, 3, webhook.Retries)
+		assert.Equal(t, []string{"model1"}, webhook.Models)
+		assert.True(t, webhook.Wants(NotifyProcessCrashed, "model1"))
+		assert.False(t, webhook.Wants(NotifyProcessCrashed, "model2"))
+		assert.False(t, webhook.Wants(NotifyProcessStateChanged, "model1"))
+
+		exec := config.Notifications[1]
+		assert.Equal(t, 0, exec.Retries)
+		assert.True(t, exec.Wants(NotifyConfigChanged, ""))
+	}
+
+	tests := []struct {
+		name         string
+		notification string
+		err          string
+	}{
+		{"no target", "events: [config_changed]", "notifications[0]: webhook or exec is required"},
+		{"invalid webhook", "webhook: example.com", "notifications[0]: webhook must be an http or https URL, got: example.com"},
+		{"unknown event", "exec: ./notify.sh\n    events: [ready]", "notifications[0]: unknown event ready, must be one of: process_state_changed, model_preloaded, config_changed, process_crashed, health_check_failed"},
+		{"unknown model", "exec: ./notify.sh\n    models: [nope]", "notifications[0]: unknown model nope"},
+		{"negative retries", "webhook: http://localhost\n    retries: -1", "notifications[0]: retries must be greater than or equal to 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfigFromReader(strings.NewReader("notifications:\n  - " + tt.notification + "\n"))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestConfig_DrainTimeout(t *testing.T) {
+	config, err := LoadConfigFromReader(strings.NewReader(``))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 30, config.DrainTimeout)
+	}
+
+	config, err = LoadConfigFromReader(strings.NewReader(`drainTimeout: 0`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, config.DrainTimeout)
+	}
+
+	_, err = LoadConfigFromReader(strings.NewReader(`drainTimeout: -1`))
+	assert.EqualError(t, err, "drainTimeout must be greater than or equal to 0")
+}
+
+func TestConfig_Strict(t *testing.T) {
+	content := `
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    tll: 60
+`
+	// unknown keys are ignored by default
+	_, err := LoadConfigFromReader(strings.NewReader(content))
+	assert.NoError(t, err)
+
+	_, err = LoadConfigFromReader(strings.NewReader("strict: true\n" + content))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line 6: field tll not found")
+	}
+
+	_, err = LoadConfigFromReader(strings.NewReader("strict: true\nstartPrt: 9000\n"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line 2: field startPrt not found")
+	}
+
+	// the legacy filters.strip_params is still accepted
+	config, err := LoadConfigFromReader(strings.NewReader(`
+strict: true
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    filters:
+      strip_params: temperature
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "temperature", config.Models["model1"].Filters.StripParams)
+	}
+}
+
+func TestLoadConfig_TLSPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": `
+tls:
+  certFile: tls/cert.pem
+  keyFile: key.pem
+  redirectListen: ":8081"
+`,
+	})
+
+	config, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, TLSConfig{
+			CertFile:       filepath.Join(dir, "tls", "cert.pem"),
+			KeyFile:        filepath.Join(dir, "key.pem"),
+			RedirectListen: ":8081",
+		}, config.TLS)
+	}
+}
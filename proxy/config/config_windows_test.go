@@ -153,8 +153,10 @@ groups:
 	}
 
 	expected := Config{
-		LogLevel:  "info",
-		StartPort: 5800,
+		LogLevel:     "info",
+		StartPort:    5800,
+		DrainTimeout: 30,
+		CgroupRoot:   DefaultCgroupRoot,
 		Macros: MacroList{
 			{"svr-path", "path/to/server"},
 		},
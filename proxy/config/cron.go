@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five field cron expression:
+// minute hour day-of-month month day-of-week
+type CronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	// cron matches either day field when both are restricted
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// names that can be used in the month and day-of-week fields
+var (
+	cronMonthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronWeekdayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// ParseCron parses a cron expression like "0 8 * * 1-5". Fields support
+// *, numbers, ranges (1-5), lists (1,3,5), steps (*/15, 0-30/10) and
+// three letter month and day names. Day-of-week 0 and 7 are Sunday.
+func ParseCron(expr string) (CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return CronSchedule{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	var schedule CronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return CronSchedule{}, fmt.Errorf("minute: %w", err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return CronSchedule{}, fmt.Errorf("hour: %w", err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return CronSchedule{}, fmt.Errorf("day of month: %w", err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return CronSchedule{}, fmt.Errorf("month: %w", err)
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return CronSchedule{}, fmt.Errorf("day of week: %w", err)
+	}
+
+	// 7 is also Sunday
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+
+	schedule.daysRestricted = fields[2] != "*"
+	schedule.weekdaysRestricted = fields[4] != "*"
+	return schedule, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(startPart, min, max, names); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseCronValue(endPart, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// 5/10 means from 5 to max every 10
+				end = max
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	n, found := names[strings.ToLower(value)]
+	if !found {
+		var err error
+		if n, err = strconv.Atoi(value); err != nil {
+			return 0, fmt.Errorf("invalid value %q", value)
+		}
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", n, min, max)
+	}
+	return n, nil
+}
+
+// Matches returns true if the schedule runs in the minute of t
+func (s CronSchedule) Matches(t time.Time) bool {
+	if s.minutes&(1<<uint(t.Minute())) == 0 ||
+		s.hours&(1<<uint(t.Hour())) == 0 ||
+		s.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dayMatch := s.days&(1<<uint(t.Day())) != 0
+	weekdayMatch := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.daysRestricted && s.weekdaysRestricted {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
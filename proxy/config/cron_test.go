@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		matches []string
+		misses  []string
+	}{
+		{
+			// weekdays at 08:00
+			expr:    "0 8 * * 1-5",
+			matches: []string{"2025-06-02 08:00", "2025-06-06 08:00"},
+			misses:  []string{"2025-06-07 08:00", "2025-06-02 08:01", "2025-06-02 09:00"},
+		},
+		{
+			expr:    "*/15 * * * *",
+			matches: []string{"2025-06-02 10:00", "2025-06-02 10:45"},
+			misses:  []string{"2025-06-02 10:10"},
+		},
+		{
+			expr:    "30 1 * jan,dec sun",
+			matches: []string{"2025-01-05 01:30", "2025-12-07 01:30"},
+			misses:  []string{"2025-01-06 01:30", "2025-06-01 01:30"},
+		},
+		{
+			// 7 is Sunday
+			expr:    "0 0 * * 7",
+			matches: []string{"2025-06-01 00:00"},
+			misses:  []string{"2025-06-02 00:00"},
+		},
+		{
+			// either day field matches when both are set
+			expr:    "0 12 1 * mon",
+			matches: []string{"2025-06-01 12:00", "2025-06-02 12:00"},
+			misses:  []string{"2025-06-03 12:00"},
+		},
+		{
+			expr:    "5/20 0-6/3 * * *",
+			matches: []string{"2025-06-02 00:05", "2025-06-02 03:25", "2025-06-02 06:45"},
+			misses:  []string{"2025-06-02 01:05", "2025-06-02 00:15", "2025-06-02 09:05"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, ts := range tt.matches {
+				tm, _ := time.ParseInLocation("2006-01-02 15:04", ts, time.Local)
+				assert.True(t, schedule.Matches(tm), ts)
+			}
+			for _, ts := range tt.misses {
+				tm, _ := time.ParseInLocation("2006-01-02 15:04", ts, time.Local)
+				assert.False(t, schedule.Matches(tm), ts)
+			}
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"* * * *":       "expected 5 fields, got 4",
+		"60 * * * *":    "minute: value 60 out of range 0-59",
+		"* * 0 * *":     "day of month: value 0 out of range 1-31",
+		"* * * foo *":   `month: invalid value "foo"`,
+		"* * * * 5-1":   `day of week: invalid range "5-1"`,
+		"*/0 * * * *":   `minute: invalid step "0"`,
+		"* 1,,2 * * * ": `hour: invalid value ""`,
+	}
+	for expr, expected := range tests {
+		_, err := ParseCron(expr)
+		assert.EqualError(t, err, expected, expr)
+	}
+}
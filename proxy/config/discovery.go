@@ -0,0 +1,258 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mostlygeek/llama-swap/proxy/gguf"
+	"gopkg.in/yaml.v3"
+)
+
+// DiscoveryConfig generates a model for each GGUF file in a directory
+type DiscoveryConfig struct {
+	Dir string `yaml:"dir"`
+
+	// also scan subdirectories, the model ID includes the subdirectory
+	Recursive bool `yaml:"recursive"`
+
+	// settings of the generated models. ${MODEL_PATH}, ${MODEL_NAME} and
+	// ${MMPROJ} are replaced in all values.
+	Model ModelConfig `yaml:"model"`
+
+	// the model mapping, decoded again for each file so the generated
+	// models do not share slices and maps
+	template *yaml.Node
+}
+
+func (d *DiscoveryConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawDiscoveryConfig DiscoveryConfig
+	var raw rawDiscoveryConfig
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	// decoded again as nodes, a map so strict mode does not reject the keys
+	var nodes map[string]yaml.Node
+	if err := unmarshal(&nodes); err != nil {
+		return err
+	}
+
+	*d = DiscoveryConfig(raw)
+	if template, found := nodes["model"]; found {
+		d.template = &template
+	}
+	return nil
+}
+
+// discoveredFile is a model file found in a discovery directory
+type discoveredFile struct {
+	id     string
+	name   string
+	path   string
+	mmproj string
+}
+
+// discoverModels adds the models generated from the discovery directories.
+// Models defined in the configuration take precedence: files are skipped when
+// the ID or an alias is already used, or when they are the model file of a model.
+func discoverModels(config *Config) error {
+	if len(config.Discovery) == 0 {
+		return nil
+	}
+	if config.Models == nil {
+		config.Models = make(map[string]ModelConfig)
+	}
+
+	used := make(map[string]bool)
+	modelFiles := make(map[string]bool)
+	for modelID, modelConfig := range config.Models {
+		used[modelID] = true
+		for _, alias := range modelConfig.Aliases {
+			used[alias] = true
+		}
+		if modelFile := config.expandedModelFile(modelID, modelConfig); modelFile != "" {
+			absFile, _ := filepath.Abs(modelFile)
+			modelFiles[absFile] = true
+		}
+	}
+
+	for i, discovery := range config.Discovery {
+		if discovery.Dir == "" {
+			return fmt.Errorf("discovery[%d]: dir is required", i)
+		}
+
+		files, err := scanModelFiles(discovery.Dir, discovery.Recursive)
+		if err != nil {
+			return fmt.Errorf("discovery[%d]: %v", i, err)
+		}
+
+		for _, file := range files {
+			absPath, _ := filepath.Abs(file.path)
+			if used[file.id] || modelFiles[absPath] {
+				continue
+			}
+
+			modelConfig, err := discovery.generateModel(file)
+			if err != nil {
+				return fmt.Errorf("discovery[%d] %s: %v", i, file.path, err)
+			}
+			if modelConfig.IsRemote() {
+				return fmt.Errorf("discovery[%d]: model.cmd is required", i)
+			}
+
+			config.Models[file.id] = modelConfig
+			used[file.id] = true
+		}
+	}
+	return nil
+}
+
+// generateModel decodes the model template with the macros of file replaced
+func (d DiscoveryConfig) generateModel(file discoveredFile) (ModelConfig, error) {
+	mmproj := ""
+	if file.mmproj != "" {
+		mmproj = "--mmproj " + file.mmproj
+	}
+	replacer := strings.NewReplacer(
+		"${MODEL_PATH}", file.path,
+		"${MODEL_NAME}", file.name,
+		"${MMPROJ}", mmproj,
+	)
+
+	var modelConfig ModelConfig
+	if d.template == nil {
+		return modelConfig, nil
+	}
+	template := copyNode(d.template)
+	replaceInScalars(template, replacer)
+	err := template.Decode(&modelConfig)
+	return modelConfig, err
+}
+
+// scanModelFiles returns the model files in dir sorted by path. Only the first
+// file of split models is returned and mmproj files are attached to the
+// models in the same directory. A missing dir has no model files.
+func scanModelFiles(dir string, recursive bool) ([]discoveredFile, error) {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		// e.g. a network share that is not mounted yet, see validate
+		return nil, nil
+	}
+
+	var files []discoveredFile
+	mmprojs := make(map[string]string) // directory -> mmproj file
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && (!recursive || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !strings.EqualFold(filepath.Ext(name), ".gguf") {
+			return nil
+		}
+		if strings.Contains(strings.ToLower(name), "mmproj") {
+			if _, found := mmprojs[filepath.Dir(path)]; !found {
+				mmprojs[filepath.Dir(path)] = path
+			}
+			return nil
+		}
+
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		if base, shard, _, ok := gguf.SplitName(name); ok {
+			if shard != 1 {
+				return nil
+			}
+			stem = base
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Join(filepath.Dir(path), stem))
+		if err != nil {
+			return err
+		}
+		files = append(files, discoveredFile{id: filepath.ToSlash(rel), name: stem, path: path})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range files {
+		files[i].mmproj = mmprojs[filepath.Dir(files[i].path)]
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// expandedModelFile returns the model file of a model with the macros in its
+// cmd expanded, e.g. -m ${models}/model.gguf. Invalid macros are reported when
+// the model is loaded.
+func (c *Config) expandedModelFile(modelID string, modelConfig ModelConfig) string {
+	macros := c.modelMacros(modelID, modelConfig)
+	cmd := StripComments(modelConfig.Cmd)
+	for i := len(macros) - 1; i >= 0; i-- {
+		cmd = strings.ReplaceAll(cmd, fmt.Sprintf("${%s}", macros[i].Name), fmt.Sprintf("%v", macros[i].Value))
+	}
+	if expanded, err := expandBuiltinMacros(cmd); err == nil {
+		cmd = expanded
+	}
+	env := &exprEnv{macros: macros, resolving: make(map[string]bool)}
+	if expanded, err := env.expandString(cmd, false); err == nil {
+		cmd = expanded
+	}
+	modelConfig.Cmd = cmd
+	return modelConfig.ModelFile()
+}
+
+// DiscoveryDirs returns the directories scanned for models, including the
+// subdirectories of recursive discovery
+func (c Config) DiscoveryDirs() []string {
+	var dirs []string
+	for _, discovery := range c.Discovery {
+		if !discovery.Recursive {
+			dirs = append(dirs, discovery.Dir)
+			continue
+		}
+		filepath.WalkDir(discovery.Dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.IsDir() {
+				if path != discovery.Dir && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+	}
+	return dirs
+}
+
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
+
+func replaceInScalars(node *yaml.Node, replacer *strings.Replacer) {
+	if node.Kind == yaml.ScalarNode {
+		node.Value = replacer.Replace(node.Value)
+	}
+	for _, child := range node.Content {
+		replaceInScalars(child, replacer)
+	}
+}
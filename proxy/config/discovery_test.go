@@ -0,0 +1,182 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Discovery(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"Qwen3-8B-Q4_K_M.gguf":                   "",
+		"big/GLM-4.5-Q4_K_M-00001-of-00003.gguf": "",
+		"big/GLM-4.5-Q4_K_M-00002-of-00003.gguf": "",
+		"big/GLM-4.5-Q4_K_M-00003-of-00003.gguf": "",
+		"vision/gemma-3-4b-it-Q4_K_M.gguf":       "",
+		"vision/mmproj-F16.gguf":                 "",
+		"llama-3.1-8b.gguf":                      "",
+		"notes.txt":                              "",
+		".partial.gguf":                          "",
+	})
+
+	content := `
+macros:
+  "server": "llama-server --port ${PORT}"
+models:
+  # explicit models take precedence
+  llama:
+    cmd: ${server} -m ` + filepath.Join(dir, "llama-3.1-8b.gguf") + ` --ctx-size 32768
+discovery:
+  - dir: ` + dir + `
+    recursive: true
+    model:
+      cmd: ${server} -m ${MODEL_PATH} ${MMPROJ}
+      name: ${MODEL_NAME}
+      aliases: ["${MODEL_NAME}-latest"]
+      ttl: 300
+`
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	modelIDs := make([]string, 0, len(config.Models))
+	for modelID := range config.Models {
+		modelIDs = append(modelIDs, modelID)
+	}
+	assert.ElementsMatch(t, []string{"llama", "Qwen3-8B-Q4_K_M", "big/GLM-4.5-Q4_K_M", "vision/gemma-3-4b-it-Q4_K_M"}, modelIDs)
+
+	qwen := config.Models["Qwen3-8B-Q4_K_M"]
+	assert.Equal(t, "llama-server --port 5800 -m "+filepath.Join(dir, "Qwen3-8B-Q4_K_M.gguf")+" ", qwen.Cmd)
+	assert.Equal(t, "Qwen3-8B-Q4_K_M", qwen.Name)
+	assert.Equal(t, []string{"Qwen3-8B-Q4_K_M-latest"}, qwen.Aliases)
+	assert.Equal(t, 300, qwen.UnloadAfter)
+	assert.Equal(t, "http://localhost:5800", qwen.Proxy)
+
+	// the first shard of split models
+	assert.Contains(t, config.Models["big/GLM-4.5-Q4_K_M"].Cmd, filepath.Join(dir, "big", "GLM-4.5-Q4_K_M-00001-of-00003.gguf"))
+	assert.Equal(t, "GLM-4.5-Q4_K_M", config.Models["big/GLM-4.5-Q4_K_M"].Name)
+
+	// mmproj files are used by the models in the same directory
+	assert.Contains(t, config.Models["vision/gemma-3-4b-it-Q4_K_M"].Cmd, "--mmproj "+filepath.Join(dir, "vision", "mmproj-F16.gguf"))
+
+	realName, found := config.RealModelName("Qwen3-8B-Q4_K_M-latest")
+	assert.True(t, found)
+	assert.Equal(t, "Qwen3-8B-Q4_K_M", realName)
+	assert.Contains(t, config.Groups[DEFAULT_GROUP_ID].Members, "Qwen3-8B-Q4_K_M")
+}
+
+func TestConfig_DiscoveryExplicitID(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"qwen.gguf":        "",
+		"sub/skipped.gguf": "",
+	})
+
+	config, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  qwen:
+    cmd: server --port ${PORT} -m /elsewhere/qwen.gguf
+discovery:
+  - dir: ` + dir + `
+    model:
+      cmd: server --port ${PORT} -m ${MODEL_PATH}
+`))
+	if assert.NoError(t, err) {
+		assert.Len(t, config.Models, 1)
+		assert.Equal(t, "server --port 5800 -m /elsewhere/qwen.gguf", config.Models["qwen"].Cmd)
+		assert.ElementsMatch(t, []string{dir}, config.DiscoveryDirs())
+	}
+}
+
+func TestLoadConfig_DiscoveryRelativeDir(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": `
+models:
+  other:
+    cmd: server --port ${PORT} -m /backup` + filepath.Join(dir, "models", "qwen.gguf") + `
+discovery:
+  - dir: models
+    model:
+      cmd: server --port ${PORT} -m ${MODEL_PATH}
+`,
+		"models/qwen.gguf": "",
+	})
+
+	// the dir is relative to the configuration file, a model using another
+	// file whose path contains this one does not hide it
+	config, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "server --port 5801 -m "+filepath.Join(dir, "models", "qwen.gguf"), config.Models["qwen"].Cmd)
+		assert.Equal(t, []string{filepath.Join(dir, "models")}, config.DiscoveryDirs())
+	}
+}
+
+func TestLoadConfig_DiscoveryExpandedModelFile(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{"qwen.gguf": "", "llama.gguf": ""})
+
+	// the model file of a model is found after its macros are expanded
+	config, err := LoadConfigFromReader(strings.NewReader(`
+macros:
+  "models": ` + dir + `
+models:
+  chat:
+    cmd: server --port ${PORT} -m ${models}/qwen.gguf
+discovery:
+  - dir: ` + dir + `
+    model:
+      cmd: server --port ${PORT} -m ${MODEL_PATH}
+`))
+	if assert.NoError(t, err) {
+		assert.Len(t, config.Models, 2)
+		assert.Contains(t, config.Models, "chat")
+		assert.Contains(t, config.Models, "llama")
+	}
+}
+
+func TestLoadConfig_DiscoveryIncludedDir(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": "include:\n  - conf.d/*.yaml\n",
+		"conf.d/discovery.yaml": `
+discovery:
+  - dir: models
+    model:
+      cmd: server --port ${PORT} -m ${MODEL_PATH}
+`,
+		"conf.d/models/qwen.gguf": "",
+	})
+
+	// the dir is relative to the included file, like the include globs
+	config, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{filepath.Join(dir, "conf.d", "models")}, config.DiscoveryDirs())
+		assert.Equal(t, "server --port 5800 -m "+filepath.Join(dir, "conf.d", "models", "qwen.gguf"), config.Models["qwen"].Cmd)
+	}
+}
+
+func TestConfig_DiscoveryErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{"model.gguf": ""})
+
+	_, err := LoadConfigFromReader(strings.NewReader("discovery:\n  - model:\n      cmd: server\n"))
+	assert.EqualError(t, err, "discovery[0]: dir is required")
+
+	_, err = LoadConfigFromReader(strings.NewReader("discovery:\n  - dir: " + dir + "\n"))
+	assert.EqualError(t, err, "discovery[0]: model.cmd is required")
+
+	// a missing directory has no models
+	config, err := LoadConfigFromReader(strings.NewReader("discovery:\n  - dir: " + filepath.Join(dir, "missing") + "\n    model:\n      cmd: server\n"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, config.Models)
+	}
+
+	// template keys are checked in strict mode
+	_, err = LoadConfigFromReader(strings.NewReader("strict: true\ndiscovery:\n  - dir: " + dir + "\n    model:\n      cmd: server --port ${PORT}\n      tll: 5\n"))
+	assert.ErrorContains(t, err, "field tll not found")
+}
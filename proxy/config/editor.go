@@ -0,0 +1,196 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigAPIConfig enables the endpoints that change models and groups at runtime
+type ConfigAPIConfig struct {
+	// keys allowed to use the endpoints, the endpoints are disabled when empty
+	APIKeys []string `yaml:"apiKeys"`
+
+	// write changes to the configuration file, otherwise they are lost when
+	// the file changes or llama-swap restarts
+	WriteBack bool `yaml:"writeBack"`
+}
+
+// ErrNotInConfigFile is returned when a model or group to delete is not in the
+// main configuration file
+var ErrNotInConfigFile = errors.New("not found in the configuration file")
+
+// Editor changes the models and groups of the main configuration file. The
+// file is edited as a YAML node tree so its comments are kept. Changes are
+// kept in memory and written to the file when configAPI.writeBack is set.
+type Editor struct {
+	sync.Mutex
+	path string
+
+	// contents of the file when it was last read or written
+	fileData []byte
+
+	// contents of the file with the changes
+	data []byte
+}
+
+func NewEditor(path string) *Editor {
+	return &Editor{path: path}
+}
+
+// Load returns the configuration with the changes. Changes that were not
+// written are dropped when the file was modified since they were made.
+func (e *Editor) Load() (Config, error) {
+	e.Lock()
+	defer e.Unlock()
+
+	fileData, err := os.ReadFile(e.path)
+	if err != nil {
+		return Config{}, err
+	}
+	if e.data == nil || !bytes.Equal(fileData, e.fileData) {
+		e.fileData = fileData
+		e.data = fileData
+	}
+	return loadConfigData(e.path, e.data)
+}
+
+// Data returns the main configuration file with the changes
+func (e *Editor) Data() []byte {
+	e.Lock()
+	defer e.Unlock()
+	return bytes.Clone(e.data)
+}
+
+// SetModel adds or replaces the model with a YAML or JSON definition
+func (e *Editor) SetModel(modelID string, definition []byte) error {
+	return e.set("models", modelID, definition)
+}
+
+// DeleteModel removes the model from the main configuration file
+func (e *Editor) DeleteModel(modelID string) error {
+	return e.delete("models", modelID)
+}
+
+// SetGroup adds or replaces the group with a YAML or JSON definition
+func (e *Editor) SetGroup(groupID string, definition []byte) error {
+	return e.set("groups", groupID, definition)
+}
+
+// DeleteGroup removes the group from the main configuration file
+func (e *Editor) DeleteGroup(groupID string) error {
+	return e.delete("groups", groupID)
+}
+
+func (e *Editor) set(section, id string, definition []byte) error {
+	var value yaml.Node
+	if err := yaml.Unmarshal(definition, &value); err != nil {
+		return fmt.Errorf("%s.%s: %v", section, id, err)
+	}
+	if len(value.Content) == 0 || value.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s.%s: definition must be a mapping", section, id)
+	}
+	entry := value.Content[0]
+	// JSON definitions would otherwise be written in flow style
+	clearNodeStyle(entry)
+
+	return e.edit(func(root *yaml.Node) error {
+		mapping := sectionMapping(root, section)
+		if existing := mappingValue(mapping, id); existing != nil {
+			*existing = *entry
+		} else {
+			mapping.Content = append(mapping.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: id}, entry)
+		}
+		return nil
+	})
+}
+
+func (e *Editor) delete(section, id string) error {
+	return e.edit(func(root *yaml.Node) error {
+		mapping := mappingValue(root, section)
+		if mapping != nil && mapping.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(mapping.Content); i += 2 {
+				if mapping.Content[i].Value == id {
+					mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("%s.%s: %w", section, id, ErrNotInConfigFile)
+	})
+}
+
+// edit applies change to the main configuration file. The result is loaded
+// with the same rules as LoadConfig and discarded when it is not valid.
+func (e *Editor) edit(change func(root *yaml.Node) error) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.data == nil {
+		return errors.New("configuration not loaded")
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(e.data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("configuration must be a mapping")
+	}
+
+	if err := change(root); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	config, err := loadConfigData(e.path, data)
+	if err != nil {
+		return err
+	}
+
+	if config.ConfigAPI.WriteBack {
+		if err := WriteFileAtomic(e.path, data); err != nil {
+			return err
+		}
+		e.fileData = data
+	}
+	e.data = data
+	return nil
+}
+
+// sectionMapping returns the mapping of a top level key, it is created when
+// missing or empty
+func sectionMapping(root *yaml.Node, key string) *yaml.Node {
+	value := mappingValue(root, key)
+	if value == nil {
+		value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	} else if value.Tag == "!!null" {
+		*value = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return value
+}
+
+// clearNodeStyle uses the default block style for node and its children
+func clearNodeStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearNodeStyle(child)
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const editorTestConfig = `# llama-swap configuration
+macros:
+  "server": "llama-server --port ${PORT}"
+
+models:
+  # the main model
+  llama:
+    cmd: ${server} -m llama.gguf # fast
+`
+
+func TestEditor_SetModel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeConfigFiles(t, dir, map[string]string{"config.yaml": editorTestConfig})
+
+	editor := NewEditor(path)
+	_, err := editor.Load()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// JSON definitions are written as block YAML, comments are kept
+	assert.NoError(t, editor.SetModel("qwen", []byte(`{"cmd": "${server} -m qwen.gguf", "aliases": ["gpt-4o"], "ttl": 60}`)))
+	assert.Equal(t, `# llama-swap configuration
+macros:
+  "server": "llama-server --port ${PORT}"
+models:
+  # the main model
+  llama:
+    cmd: ${server} -m llama.gguf # fast
+  qwen:
+    cmd: ${server} -m qwen.gguf
+    aliases:
+      - gpt-4o
+    ttl: 60
+`, string(editor.Data()))
+
+	config, err := editor.Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "llama-server --port 5801 -m qwen.gguf", config.Models["qwen"].Cmd)
+		assert.Equal(t, 60, config.Models["qwen"].UnloadAfter)
+	}
+
+	// without writeBack the file is not changed
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, editorTestConfig, string(data))
+
+	// replacing a model
+	assert.NoError(t, editor.SetModel("llama", []byte("cmd: ${server} -m llama-q8.gguf\n")))
+	assert.Contains(t, string(editor.Data()), "  # the main model\n  llama:\n    cmd: ${server} -m llama-q8.gguf\n")
+
+	// invalid changes are rejected and not kept
+	before := editor.Data()
+	assert.EqualError(t, editor.SetModel("bad", []byte("cmd: server --port ${PORT} ${nope}\n")), "unknown macro '${nope}' found in bad.cmd")
+	assert.EqualError(t, editor.SetModel("bad", []byte("[1, 2]")), "models.bad: definition must be a mapping")
+	assert.Equal(t, before, editor.Data())
+
+	// changes are dropped when the file is modified
+	writeConfigFiles(t, dir, map[string]string{"config.yaml": "models:\n  other:\n    cmd: server --port ${PORT}\n"})
+	config, err = editor.Load()
+	if assert.NoError(t, err) {
+		assert.Len(t, config.Models, 1)
+		assert.Contains(t, config.Models, "other")
+	}
+}
+
+func TestEditor_WriteBack(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeConfigFiles(t, dir, map[string]string{"config.yaml": "configAPI:\n  writeBack: true\n" + editorTestConfig})
+
+	editor := NewEditor(path)
+	_, err := editor.Load()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, editor.SetGroup("fast", []byte("members: [llama]\nswap: false\n")))
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, string(editor.Data()), string(data))
+	assert.Contains(t, string(data), "    cmd: ${server} -m llama.gguf # fast\n")
+	assert.Contains(t, string(data), "groups:\n  fast:\n    members:\n      - llama\n    swap: false\n")
+
+	// written changes are kept by Load
+	config, err := editor.Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"llama"}, config.Groups["fast"].Members)
+	}
+
+	assert.NoError(t, editor.DeleteGroup("fast"))
+	assert.NoError(t, editor.DeleteModel("llama"))
+	assert.ErrorIs(t, editor.DeleteModel("llama"), ErrNotInConfigFile)
+
+	data, _ = os.ReadFile(path)
+	assert.NotContains(t, string(data), "llama.gguf")
+	assert.Contains(t, string(data), "# llama-swap configuration\n")
+}
+
+func TestEditor_ModelInIncludedFile(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": "include: [models.yaml]\n",
+		"models.yaml": "models:\n  llama:\n    cmd: server --port ${PORT}\n",
+	})
+
+	editor := NewEditor(filepath.Join(dir, "config.yaml"))
+	_, err := editor.Load()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// included files are not changed, the model is defined twice
+	err = editor.SetModel("llama", []byte("cmd: server --port ${PORT} -v\n"))
+	assert.ErrorContains(t, err, "duplicate models.llama in "+filepath.Join(dir, "models.yaml")+":2")
+	assert.ErrorIs(t, editor.DeleteModel("llama"), ErrNotInConfigFile)
+}
@@ -0,0 +1,778 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+Expressions start with =, e.g. ${= slots * ctx_per_slot}. Anything else in
+${...} is a macro reference or left alone, like the shell's ${VAR:-default},
+${f%.gguf} or ${V/x/y} in sh -c commands.
+
+	literals     4, 0.5, "text", true, false
+	macros       slots, ctx-per-slot (put spaces around subtraction: a - b)
+	arithmetic   + - * / %, integer division when both sides are integers
+	strings      + concatenates when either side is a string
+	comparison   == != < <= > >=
+	logic        && || !, "", 0 and false are false
+	conditional  cond ? a : b
+	default      a ?? b, b when macro a is not defined or empty
+
+Macro values that look like numbers are numbers, e.g. from ${env.SLOTS:-4}.
+*/
+
+// evaluateModelExpressions evaluates the expressions in every model field that
+// supports macros. Fields that are a single expression keep the type of the
+// result in metadata and param filters, like ${PORT} does.
+func evaluateModelExpressions(modelId string, modelConfig *ModelConfig, macros MacroList) error {
+	env := &exprEnv{macros: macros, resolving: make(map[string]bool)}
+
+	err := forEachMacroField(modelConfig, func(fieldName, value string) (string, error) {
+		expanded, err := env.expandString(value, false)
+		if err != nil {
+			return "", fmt.Errorf("%v in %s.%s", err, modelId, fieldName)
+		}
+		return expanded, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return forEachMacroMap(modelConfig, func(fieldName string, value map[string]any) (map[string]any, error) {
+		expanded, err := env.expandValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%v in %s.%s", err, modelId, fieldName)
+		}
+		return expanded.(map[string]any), nil
+	})
+}
+
+// exprEnv resolves the macros used in expressions
+type exprEnv struct {
+	macros MacroList
+
+	// macros being resolved, to detect cycles
+	resolving map[string]bool
+}
+
+// expandValue evaluates the expressions in the strings of nested values
+func (e *exprEnv) expandValue(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if start, end, found := nextExpression(v, 0); found && start == 0 && end == len(v) {
+			return e.evaluate(v[2 : end-1])
+		}
+		return e.expandString(v, false)
+	case map[string]any:
+		newMap := make(map[string]any, len(v))
+		for key, val := range v {
+			newVal, err := e.expandValue(val)
+			if err != nil {
+				return nil, err
+			}
+			newMap[key] = newVal
+		}
+		return newMap, nil
+	case []any:
+		newSlice := make([]any, len(v))
+		for i, val := range v {
+			newVal, err := e.expandValue(val)
+			if err != nil {
+				return nil, err
+			}
+			newSlice[i] = newVal
+		}
+		return newSlice, nil
+	default:
+		return value, nil
+	}
+}
+
+// expandString replaces the expressions in s with their results. When
+// references is set, ${name} references to macros and the env and file macros
+// are replaced too, this is used for the values of macros used in expressions.
+func (e *exprEnv) expandString(s string, references bool) (string, error) {
+	var b strings.Builder
+	pos := 0
+	for {
+		start, end, found := nextExpression(s, pos)
+		if !found {
+			break
+		}
+		result, err := e.evaluate(s[start+2 : end-1])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s[pos:start])
+		b.WriteString(formatExprValue(result))
+		pos = end
+	}
+	b.WriteString(s[pos:])
+
+	if !references {
+		return b.String(), nil
+	}
+
+	var err error
+	expanded := macroPatternRegex.ReplaceAllStringFunc(b.String(), func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		value, found, lookupErr := e.lookup(name)
+		if lookupErr != nil && err == nil {
+			err = lookupErr
+		}
+		if !found {
+			return ref
+		}
+		return formatExprValue(value)
+	})
+	if err != nil {
+		return "", err
+	}
+	return expandBuiltinMacros(expanded)
+}
+
+// lookup returns the value of a macro with its references and expressions
+// expanded. Strings that look like numbers are returned as numbers.
+func (e *exprEnv) lookup(name string) (any, bool, error) {
+	var value any
+	found := false
+	for _, entry := range e.macros {
+		if entry.Name == name {
+			value, found = entry.Value, true
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+
+	s, isString := value.(string)
+	if !isString {
+		return toExprValue(value), true, nil
+	}
+
+	if e.resolving[name] {
+		return nil, true, fmt.Errorf("macro '%s' references itself", name)
+	}
+	e.resolving[name] = true
+	defer delete(e.resolving, name)
+
+	expanded, err := e.expandString(s, true)
+	if err != nil {
+		return nil, true, err
+	}
+	if i, err := strconv.ParseInt(expanded, 10, 64); err == nil {
+		return i, true, nil
+	}
+	if f, err := strconv.ParseFloat(expanded, 64); err == nil && !strings.ContainsAny(expanded, "xXnN") {
+		return f, true, nil
+	}
+	return expanded, true, nil
+}
+
+// evaluate parses and evaluates the expression inside ${ and }, including the
+// leading =
+func (e *exprEnv) evaluate(source string) (any, error) {
+	p := &exprParser{source: source, pos: len(exprPrefix)}
+	p.next()
+	node, err := p.parseExpression()
+	if err == nil && p.err != nil {
+		err = p.err
+	}
+	if err == nil && p.token.kind != tokenEnd {
+		err = p.errorf("unexpected %s", p.token)
+	}
+	if err != nil {
+		return nil, &exprError{fmt.Sprintf("invalid expression '${%s}': %v", source, err), err}
+	}
+
+	result, err := node.eval(e)
+	var nested *exprError
+	if errors.As(err, &nested) {
+		// from an expression in the value of a macro
+		return nil, err
+	} else if err != nil {
+		return nil, &exprError{fmt.Sprintf("expression '${%s}': %v", source, err), err}
+	}
+	if n, ok := result.(int64); ok {
+		return int(n), nil
+	}
+	return result, nil
+}
+
+// exprError is the error of the innermost expression that failed
+type exprError struct {
+	message string
+	err     error
+}
+
+func (e *exprError) Error() string { return e.message }
+func (e *exprError) Unwrap() error { return e.err }
+
+// exprPrefix starts an expression inside ${ and }
+const exprPrefix = "="
+
+// nextExpression returns the position of the next ${= ...} expression in s at
+// or after pos. The closing } of the expression is found outside of strings.
+func nextExpression(s string, pos int) (start, end int, found bool) {
+	for {
+		i := strings.Index(s[pos:], "${")
+		if i < 0 {
+			return 0, 0, false
+		}
+		start = pos + i
+		if !strings.HasPrefix(s[start+2:], exprPrefix) {
+			pos = start + 2
+			continue
+		}
+
+		inString := false
+		end = -1
+		for j := start + 2; j < len(s); j++ {
+			if s[j] == '"' {
+				inString = !inString
+			} else if s[j] == '\\' && inString {
+				j++
+			} else if s[j] == '}' && !inString {
+				end = j + 1
+				break
+			}
+		}
+		if end < 0 {
+			// an unterminated string, reported by the parser
+			j := strings.IndexByte(s[start:], '}')
+			if j < 0 {
+				return 0, 0, false
+			}
+			end = start + j + 1
+		}
+		return start, end, true
+	}
+}
+
+func toExprValue(value any) any {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+func formatExprValue(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func exprTypeName(value any) string {
+	switch value.(type) {
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	default:
+		return value != nil
+	}
+}
+
+// tokens
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int // 1 based position in the expression
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.value)
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+var exprOperators = []string{"??", "==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "?", ":", "(", ")"}
+
+type exprParser struct {
+	source string
+	pos    int
+	token  token
+	err    error
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.token.pos)
+}
+
+// next reads the next token, lexing errors are kept in p.err
+func (p *exprParser) next() {
+	for p.pos < len(p.source) && unicode.IsSpace(rune(p.source[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	p.token = token{kind: tokenEnd, pos: start + 1}
+	if p.pos >= len(p.source) {
+		return
+	}
+
+	c := p.source[p.pos]
+	switch {
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.source) && (isIdentChar(p.source[p.pos]) || p.source[p.pos] == '.') {
+			p.pos++
+		}
+		text := p.source[start:p.pos]
+		p.token = token{kind: tokenNumber, text: text, pos: start + 1}
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			p.token.value = i
+		} else if f, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXnN_") {
+			p.token.value = f
+		} else if p.err == nil {
+			p.err = p.errorf("invalid number '%s'", text)
+		}
+
+	case c == '"':
+		var b strings.Builder
+		p.pos++
+		for p.pos < len(p.source) && p.source[p.pos] != '"' {
+			if p.source[p.pos] == '\\' && p.pos+1 < len(p.source) {
+				p.pos++
+			}
+			b.WriteByte(p.source[p.pos])
+			p.pos++
+		}
+		if p.pos >= len(p.source) && p.err == nil {
+			p.token.pos = start + 1
+			p.err = p.errorf("unterminated string")
+		}
+		p.pos++
+		p.token = token{kind: tokenString, text: p.source[start:min(p.pos, len(p.source))], value: b.String(), pos: start + 1}
+
+	case isIdentChar(c):
+		for p.pos < len(p.source) && isIdentChar(p.source[p.pos]) {
+			p.pos++
+		}
+		p.token = token{kind: tokenIdent, text: p.source[start:p.pos], pos: start + 1}
+
+	default:
+		for _, op := range exprOperators {
+			if strings.HasPrefix(p.source[p.pos:], op) {
+				p.pos += len(op)
+				p.token = token{kind: tokenOperator, text: op, pos: start + 1}
+				return
+			}
+		}
+		if p.err == nil {
+			p.err = p.errorf("unexpected character '%c'", c)
+		}
+		p.pos = len(p.source)
+		p.token = token{kind: tokenEnd, pos: start + 1}
+	}
+}
+
+// isIdentChar matches the characters of macro names
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *exprParser) isOperator(ops ...string) bool {
+	if p.token.kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if p.token.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// expression = default [ "?" expression ":" expression ]
+func (p *exprParser) parseExpression() (exprNode, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator("?") {
+		return cond, nil
+	}
+	p.next()
+	then, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator(":") {
+		return nil, p.errorf("expected ':' but found %s", p.token)
+	}
+	p.next()
+	otherwise, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return conditionalNode{cond, then, otherwise}, nil
+}
+
+// binary operators from the lowest precedence
+var exprPrecedence = [][]string{
+	{"??"},
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator(exprPrecedence[level]...) {
+		op := p.token
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op.text, op.pos, left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOperator("-", "!") {
+		op := p.token
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op.text, op.pos, operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	t := p.token
+	switch {
+	case t.kind == tokenNumber || t.kind == tokenString:
+		p.next()
+		return literalNode{t.value}, nil
+	case t.kind == tokenIdent && (t.text == "true" || t.text == "false"):
+		p.next()
+		return literalNode{t.text == "true"}, nil
+	case t.kind == tokenIdent:
+		p.next()
+		return identNode{t.text, t.pos}, nil
+	case p.isOperator("("):
+		p.next()
+		node, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(")") {
+			return nil, p.errorf("expected ')' but found %s", p.token)
+		}
+		p.next()
+		return node, nil
+	default:
+		return nil, p.errorf("expected a value but found %s", t)
+	}
+}
+
+// evaluation
+
+type exprNode interface {
+	eval(env *exprEnv) (any, error)
+}
+
+type literalNode struct{ value any }
+
+func (n literalNode) eval(*exprEnv) (any, error) { return n.value, nil }
+
+type identNode struct {
+	name string
+	pos  int
+}
+
+// errUndefinedMacro is used by ?? to fall back to the default
+var errUndefinedMacro = errors.New("undefined macro")
+
+func (n identNode) eval(env *exprEnv) (any, error) {
+	value, found, err := env.lookup(n.name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown macro '%s' at position %d: %w", n.name, n.pos, errUndefinedMacro)
+	}
+	return value, nil
+}
+
+type conditionalNode struct{ cond, then, otherwise exprNode }
+
+func (n conditionalNode) eval(env *exprEnv) (any, error) {
+	cond, err := n.cond.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(cond) {
+		return n.then.eval(env)
+	}
+	return n.otherwise.eval(env)
+}
+
+type unaryNode struct {
+	op      string
+	pos     int
+	operand exprNode
+}
+
+func (n unaryNode) eval(env *exprEnv) (any, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(value), nil
+	}
+	switch v := value.(type) {
+	case int64:
+		return -v, nil
+	case float64:
+		return -v, nil
+	default:
+		return nil, fmt.Errorf("operator '-' at position %d needs a number, got %s", n.pos, exprTypeName(value))
+	}
+}
+
+type binaryNode struct {
+	op          string
+	pos         int
+	left, right exprNode
+}
+
+func (n binaryNode) eval(env *exprEnv) (any, error) {
+	left, err := n.left.eval(env)
+
+	// the default operator and short circuit logic
+	switch n.op {
+	case "??":
+		if errors.Is(err, errUndefinedMacro) || (err == nil && left == "") {
+			return n.right.eval(env)
+		}
+		return left, err
+	case "&&", "||":
+		if err != nil {
+			return nil, err
+		}
+		if truthy(left) == (n.op == "||") {
+			return n.op == "||", nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(right), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==", "!=":
+		equal, err := n.compare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return (equal == 0) == (n.op == "=="), nil
+	case "<", "<=", ">", ">=":
+		if _, isBool := left.(bool); isBool {
+			return nil, n.typeError(left, right)
+		}
+		order, err := n.compare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return order < 0, nil
+		case "<=":
+			return order <= 0, nil
+		case ">":
+			return order > 0, nil
+		default:
+			return order >= 0, nil
+		}
+	}
+
+	_, leftString := left.(string)
+	_, rightString := right.(string)
+	if n.op == "+" && (leftString || rightString) {
+		return formatExprValue(left) + formatExprValue(right), nil
+	}
+
+	l, lok := left.(int64)
+	r, rok := right.(int64)
+	if lok && rok {
+		switch n.op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, fmt.Errorf("division by zero at position %d", n.pos)
+			}
+			if n.op == "/" {
+				return l / r, nil
+			}
+			return l % r, nil
+		}
+	}
+
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, n.typeError(left, right)
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero at position %d", n.pos)
+		}
+		return lf / rf, nil
+	default:
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero at position %d", n.pos)
+		}
+		return math.Mod(lf, rf), nil
+	}
+}
+
+// compare returns -1, 0 or 1, values of different types can not be compared
+func (n binaryNode) compare(left, right any) (int, error) {
+	if lf, ok := toFloat(left); ok {
+		if rf, ok := toFloat(right); ok {
+			switch {
+			case lf < rf:
+				return -1, nil
+			case lf > rf:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+	}
+	switch l := left.(type) {
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			if l == r {
+				return 0, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, n.typeError(left, right)
+}
+
+func (n binaryNode) typeError(left, right any) error {
+	return fmt.Errorf("operator '%s' at position %d can not be used with %s and %s", n.op, n.pos, exprTypeName(left), exprTypeName(right))
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_MacroExpressions(t *testing.T) {
+	t.Setenv("TEST_SLOTS", "4")
+
+	content := `
+startPort: 9000
+macros:
+  "slots": 2
+  "ctx-per-slot": 8192
+  "vision": ""
+  "server": "llama-server --port ${PORT}"
+models:
+  text:
+    # quoted, ": " is a mapping in plain YAML values
+    cmd: '${server} --parallel ${slots} --ctx-size ${= slots * ctx-per-slot} ${= vision ? "--mmproj " + vision : ""}'
+    name: '${= MODEL_ID + " (" + slots + " slots)"}'
+    metadata:
+      ctx: ${= slots * ctx-per-slot}
+      per_slot_k: ${=ctx-per-slot / 1024.0}
+      vision: ${= vision != ""}
+      note: "rpc on ${= PORT + 1000}"
+  vision:
+    macros:
+      "vision": "/models/mmproj.gguf"
+      "slots": ${env.TEST_SLOTS:-1}
+    cmd: '${server} --ctx-size ${= slots * ctx-per-slot} ${= vision ? "--mmproj " + vision : ""}'
+    filters:
+      setParams:
+        top_k: ${= draft ?? 40}
+`
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	text := config.Models["text"]
+	assert.Equal(t, "llama-server --port 9000 --parallel 2 --ctx-size 16384 ", text.Cmd)
+	assert.Equal(t, "text (2 slots)", text.Name)
+	assert.Equal(t, 16384, text.Metadata["ctx"])
+	assert.Equal(t, 8.0, text.Metadata["per_slot_k"])
+	assert.Equal(t, false, text.Metadata["vision"])
+	assert.Equal(t, "rpc on 10000", text.Metadata["note"])
+
+	// model macros override global ones, env macros are numbers
+	vision := config.Models["vision"]
+	assert.Equal(t, "llama-server --port 9001 --ctx-size 32768 --mmproj /models/mmproj.gguf", vision.Cmd)
+	assert.Equal(t, 40, vision.Filters.SetParams["top_k"])
+}
+
+func TestConfig_MacroExpressionsNotExpressions(t *testing.T) {
+	// only ${= ...} is an expression, shell parameter expansion is left alone
+	config, err := LoadConfigFromReader(strings.NewReader(`
+macros:
+  "slots": 2
+models:
+  test:
+    cmd: sh -c "llama-server --port ${PORT} --threads ${THREADS:-8} --ctx ${CTX:-4*1024} --parallel ${=slots*2}"
+  default:
+    cmd: sh -c "llama-server --port ${PORT} ${EXTRA:-a b}"
+  suffix:
+    cmd: sh -c "f=/models/qwen.gguf; llama-server --port ${PORT} --alias ${f%.gguf} --model-dir ${f% *}"
+  replace:
+    cmd: sh -c "llama-server --port ${PORT} --alias ${V/x/y}"
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `sh -c "llama-server --port 5803 --threads ${THREADS:-8} --ctx ${CTX:-4*1024} --parallel 4"`, config.Models["test"].Cmd)
+	assert.Equal(t, `sh -c "llama-server --port 5800 ${EXTRA:-a b}"`, config.Models["default"].Cmd)
+	assert.Equal(t, `sh -c "f=/models/qwen.gguf; llama-server --port 5802 --alias ${f%.gguf} --model-dir ${f% *}"`, config.Models["suffix"].Cmd)
+	assert.Equal(t, `sh -c "llama-server --port 5801 --alias ${V/x/y}"`, config.Models["replace"].Cmd)
+}
+
+func TestConfig_MacroExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		err  string
+	}{
+		{"incomplete", "${= slots * }", "invalid expression '${= slots * }': expected a value but found end of expression at position 11 in test.cmd"},
+		{"unbalanced", "${= (slots + 1 }", "invalid expression '${= (slots + 1 }': expected ')' but found end of expression at position 14 in test.cmd"},
+		{"trailing", "${= slots 2}", "invalid expression '${= slots 2}': unexpected '2' at position 9 in test.cmd"},
+		{"character", "${= slots @ 2}", "invalid expression '${= slots @ 2}': unexpected character '@' at position 9 in test.cmd"},
+		{"string", `${= "abc + 1}`, `invalid expression '${= "abc + 1}': unterminated string at position 3 in test.cmd`},
+		{"unknown", "${= nope + 1}", "expression '${= nope + 1}': unknown macro 'nope' at position 3: undefined macro in test.cmd"},
+		{"types", `${= name * 2}`, "expression '${= name * 2}': operator '*' at position 8 can not be used with string and integer in test.cmd"},
+		{"zero", "${= slots / 0}", "expression '${= slots / 0}': division by zero at position 9 in test.cmd"},
+		{"cycle", "${= loop + 1}", "expression '${= loop + 1}': macro 'loop' references itself in test.cmd"},
+		{"empty", "${=}", "invalid expression '${=}': expected a value but found end of expression at position 2 in test.cmd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+macros:
+  "slots": 2
+  "name": "qwen"
+  "loop": "${= loop + 1}"
+models:
+  test:
+    cmd: "server --port ${PORT} ` + strings.ReplaceAll(tt.cmd, `"`, `\"`) + `"
+`
+			_, err := LoadConfigFromReader(strings.NewReader(content))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
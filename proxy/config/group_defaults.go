@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// applyGroupDefaults copies the defaults of each group to its members. A
+// member's own ttl, concurrencyLimit, filter strings and macros take
+// precedence, env entries with the same name are replaced by the member's and
+// params and lists are merged.
+func applyGroupDefaults(config *Config) error {
+	groupIDs := make([]string, 0, len(config.Groups))
+	for groupID := range config.Groups {
+		groupIDs = append(groupIDs, groupID)
+	}
+	sort.Strings(groupIDs)
+
+	for _, groupID := range groupIDs {
+		group := config.Groups[groupID]
+
+		if group.IdleTTL < 0 {
+			return fmt.Errorf("group %s: idleTtl must be greater than or equal to 0", groupID)
+		}
+		for _, macro := range group.Macros {
+			if err := validateMacro(macro.Name, macro.Value); err != nil {
+				return fmt.Errorf("group %s: %s", groupID, err.Error())
+			}
+		}
+
+		for _, member := range group.Members {
+			modelConfig, found := config.Models[member]
+			if !found {
+				continue
+			}
+
+			if modelConfig.UnloadAfter == 0 {
+				modelConfig.UnloadAfter = group.UnloadAfter
+			}
+			if modelConfig.ConcurrencyLimit == 0 {
+				modelConfig.ConcurrencyLimit = group.ConcurrencyLimit
+			}
+			modelConfig.Env = mergeEnv(group.Env, modelConfig.Env)
+			modelConfig.Macros = mergeMacros(group.Macros, modelConfig.Macros)
+			modelConfig.Filters = mergeFilters(group.Filters, modelConfig.Filters)
+
+			config.Models[member] = modelConfig
+		}
+	}
+	return nil
+}
+
+// mergeEnv returns the group env followed by the model env, group entries
+// are dropped when the model sets the same name
+func mergeEnv(group, model []string) []string {
+	if len(group) == 0 {
+		return model
+	}
+
+	names := make(map[string]bool, len(model))
+	for _, entry := range model {
+		name, _, _ := strings.Cut(entry, "=")
+		names[name] = true
+	}
+
+	merged := make([]string, 0, len(group)+len(model))
+	for _, entry := range group {
+		if name, _, _ := strings.Cut(entry, "="); !names[name] {
+			merged = append(merged, entry)
+		}
+	}
+	return append(merged, model...)
+}
+
+// mergeMacros returns the group macros followed by the model macros so model
+// macros can use the group macros. Group macros the model defines are dropped.
+func mergeMacros(group, model MacroList) MacroList {
+	if len(group) == 0 {
+		return model
+	}
+
+	merged := make(MacroList, 0, len(group)+len(model))
+	for _, entry := range group {
+		if _, found := model.Get(entry.Name); !found {
+			merged = append(merged, entry)
+		}
+	}
+	return append(merged, model...)
+}
+
+// mergeFilters returns the model filters with the group filters as defaults
+func mergeFilters(group, model ModelFilters) ModelFilters {
+	merged := model
+
+	if group.StripParams != "" {
+		if model.StripParams != "" {
+			merged.StripParams = group.StripParams + "," + model.StripParams
+		} else {
+			merged.StripParams = group.StripParams
+		}
+	}
+	merged.SetParams = mergeParams(group.SetParams, model.SetParams)
+	merged.DefaultParams = mergeParams(group.DefaultParams, model.DefaultParams)
+
+	merged.MergeSystemMessages = group.MergeSystemMessages || model.MergeSystemMessages
+	merged.StripImages = group.StripImages || model.StripImages
+	if merged.PrependSystemPrompt == "" {
+		merged.PrependSystemPrompt = group.PrependSystemPrompt
+	}
+	if merged.AppendSystemPrompt == "" {
+		merged.AppendSystemPrompt = group.AppendSystemPrompt
+	}
+	if merged.ThinkTags == "" {
+		merged.ThinkTags = group.ThinkTags
+	}
+	if len(group.ReplaceContent) > 0 {
+		merged.ReplaceContent = append(append([]ContentReplacement{}, group.ReplaceContent...), model.ReplaceContent...)
+	}
+
+	return merged
+}
+
+// mergeParams returns a new map with the group params and the model params,
+// the model params take precedence
+func mergeParams(group, model map[string]any) map[string]any {
+	if len(group) == 0 {
+		return model
+	}
+
+	merged := make(map[string]any, len(group)+len(model))
+	for key, value := range group {
+		merged[key] = value
+	}
+	for key, value := range model {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_GroupDefaults(t *testing.T) {
+	content := `
+macros:
+  "server": "llama-server --port ${PORT}"
+  "ctx": 4096
+models:
+  a:
+    cmd: ${server} --ctx-size ${ctx} --device ${gpu}
+  b:
+    cmd: ${server} --ctx-size ${ctx}
+    ttl: 60
+    concurrencyLimit: 2
+    env:
+      - "CUDA_VISIBLE_DEVICES=1"
+    macros:
+      "ctx": 8192
+    filters:
+      stripParams: "top_k"
+      setParams:
+        temperature: 0.2
+      prependSystemPrompt: "Be brief."
+  other:
+    cmd: ${server}
+groups:
+  gpu0:
+    swap: false
+    members: ["a", "b"]
+    ttl: 300
+    idleTtl: 600
+    concurrencyLimit: 4
+    env:
+      - "CUDA_VISIBLE_DEVICES=0"
+      - "GGML_CUDA_NO_PINNED=1"
+    macros:
+      "gpu": "CUDA0"
+      "ctx": 16384
+    filters:
+      stripParams: "temperature"
+      setParams:
+        temperature: 0.7
+        top_p: 0.9
+      prependSystemPrompt: "You run on ${gpu}."
+      replaceContent:
+        - pattern: "foo"
+          replacement: "bar"
+`
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// group values are used when the member does not set them
+	a := config.Models["a"]
+	assert.Equal(t, "llama-server --port 5800 --ctx-size 16384 --device CUDA0", a.Cmd)
+	assert.Equal(t, 300, a.UnloadAfter)
+	assert.Equal(t, 4, a.ConcurrencyLimit)
+	assert.Equal(t, []string{"CUDA_VISIBLE_DEVICES=0", "GGML_CUDA_NO_PINNED=1"}, a.Env)
+	assert.Equal(t, map[string]any{"temperature": 0.7, "top_p": 0.9}, a.Filters.SetParams)
+	assert.Equal(t, "You run on CUDA0.", a.Filters.PrependSystemPrompt)
+	assert.Len(t, a.Filters.ReplaceContent, 1)
+
+	// the member's values take precedence
+	b := config.Models["b"]
+	assert.Equal(t, "llama-server --port 5801 --ctx-size 8192", b.Cmd)
+	assert.Equal(t, 60, b.UnloadAfter)
+	assert.Equal(t, 2, b.ConcurrencyLimit)
+	assert.Equal(t, []string{"GGML_CUDA_NO_PINNED=1", "CUDA_VISIBLE_DEVICES=1"}, b.Env)
+	assert.Equal(t, map[string]any{"temperature": 0.2, "top_p": 0.9}, b.Filters.SetParams)
+	assert.Equal(t, "Be brief.", b.Filters.PrependSystemPrompt)
+	stripParams, _ := b.Filters.SanitizedStripParams()
+	assert.Equal(t, []string{"temperature", "top_k"}, stripParams)
+
+	// models of other groups are not changed
+	other := config.Models["other"]
+	assert.Equal(t, 0, other.UnloadAfter)
+	assert.Empty(t, other.Env)
+	assert.Empty(t, other.Filters.SetParams)
+
+	assert.Equal(t, 600, config.Groups["gpu0"].IdleTTL)
+}
+
+func TestConfig_GroupDefaultsErrors(t *testing.T) {
+	_, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  a:
+    cmd: server --port ${PORT}
+groups:
+  g:
+    members: ["a"]
+    idleTtl: -1
+`))
+	assert.EqualError(t, err, "group g: idleTtl must be greater than or equal to 0")
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  a:
+    cmd: server --port ${PORT}
+groups:
+  g:
+    members: ["a"]
+    macros:
+      "PORT": 8080
+`))
+	assert.EqualError(t, err, "group g: macro name 'PORT' is reserved")
+}
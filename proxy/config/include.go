@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// top level keys where each file can add entries, an entry defined in two
+// files is an error
+var includeMergedMaps = map[string]bool{
+	"models":   true,
+	"groups":   true,
+	"profiles": true,
+	"routers":  true,
+	"peers":    true,
+	"macros":   true,
+}
+
+// IncludePatterns returns the include globs of the configuration file at
+// path, relative globs are resolved from the directory of the file
+func IncludePatterns(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return includePatterns(path, data)
+}
+
+// includePatterns returns the include globs of data, the contents of the
+// configuration file at path
+func includePatterns(path string, data []byte) ([]string, error) {
+	var config struct {
+		Include []string `yaml:"include"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	patterns := make([]string, len(config.Include))
+	for i, pattern := range config.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		patterns[i] = pattern
+	}
+	return patterns, nil
+}
+
+// mergeIncludes merges the files matching the include globs of data, the
+// contents of the configuration file at path, into it. Files are merged in the
+// order of the globs, and in lexical order for each glob.
+func mergeIncludes(path string, data []byte) ([]byte, error) {
+	patterns, err := includePatterns(path, data)
+	if err != nil || len(patterns) == 0 {
+		// errors are reported when the configuration is loaded
+		return data, nil
+	}
+
+	root, err := parseIncludeFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	merger := &includeMerger{root: root, locations: make(map[string]string)}
+	merger.track(path, root)
+	sources := []includeSource{{file: path, data: data}}
+
+	absPath, _ := filepath.Abs(path)
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %v", pattern, err)
+		}
+		if len(files) == 0 && !hasGlobMeta(pattern) {
+			return nil, fmt.Errorf("include %s: file not found", pattern)
+		}
+
+		for _, file := range files {
+			if absFile, _ := filepath.Abs(file); absFile == absPath {
+				continue
+			}
+
+			includeData, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("include %s: %v", file, err)
+			}
+			included, err := parseIncludeFile(file, includeData)
+			if err != nil {
+				return nil, err
+			}
+			resolveIncludedPaths(file, included)
+			if err := merger.merge(file, included); err != nil {
+				return nil, err
+			}
+			sources = append(sources, includeSource{file: file, data: includeData})
+		}
+	}
+
+	// the merged document has other line numbers, decoding each file on its
+	// own reports errors with the file and line where they are
+	var strict bool
+	if node := mappingValue(root, "strict"); node != nil {
+		node.Decode(&strict)
+	}
+	for _, source := range sources {
+		if err := decodeIncludeFile(source.data, strict); err != nil {
+			return nil, fmt.Errorf("%s: %v", source.file, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type includeSource struct {
+	file string
+	data []byte
+}
+
+// decodeIncludeFile decodes a single file of the configuration to find
+// invalid values and, in strict mode, unknown keys
+func decodeIncludeFile(data []byte, strict bool) error {
+	config := defaultConfig()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(strict)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// parseIncludeFile returns the top level mapping of a configuration file
+func parseIncludeFile(file string, data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(doc.Content) == 0 {
+		// empty file
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: configuration must be a mapping", file, root.Line)
+	}
+	return root, nil
+}
+
+// resolveIncludedPaths makes the relative paths in an included file absolute.
+// Like the include globs, they are relative to the directory of the file.
+func resolveIncludedPaths(file string, included *yaml.Node) {
+	var paths []*yaml.Node
+	if discovery := mappingValue(included, "discovery"); discovery != nil && discovery.Kind == yaml.SequenceNode {
+		for _, entry := range discovery.Content {
+			if entry.Kind == yaml.MappingNode {
+				paths = append(paths, mappingValue(entry, "dir"))
+			}
+		}
+	}
+	if tls := mappingValue(included, "tls"); tls != nil && tls.Kind == yaml.MappingNode {
+		for _, key := range []string{"certFile", "keyFile", "clientCAFile"} {
+			paths = append(paths, mappingValue(tls, key))
+		}
+	}
+
+	for _, node := range paths {
+		if node == nil || node.Kind != yaml.ScalarNode || node.Value == "" || filepath.IsAbs(node.Value) {
+			continue
+		}
+		if path, err := filepath.Abs(filepath.Join(filepath.Dir(file), node.Value)); err == nil {
+			node.Value = path
+		}
+	}
+}
+
+// includeMerger merges included files into root, remembering where each key
+// was defined to report duplicates
+type includeMerger struct {
+	root *yaml.Node
+
+	// "file:line" of each top level key and each entry of includeMergedMaps
+	locations map[string]string
+}
+
+func (m *includeMerger) track(file string, mapping *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		m.trackKey(file, mapping.Content[i], mapping.Content[i+1])
+	}
+}
+
+func (m *includeMerger) trackKey(file string, key, value *yaml.Node) {
+	m.locations[key.Value] = fmt.Sprintf("%s:%d", file, key.Line)
+	if includeMergedMaps[key.Value] && value.Kind == yaml.MappingNode {
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			entry := value.Content[j]
+			m.locations[key.Value+"."+entry.Value] = fmt.Sprintf("%s:%d", file, entry.Line)
+		}
+	}
+}
+
+func (m *includeMerger) merge(file string, included *yaml.Node) error {
+	for i := 0; i+1 < len(included.Content); i += 2 {
+		key, value := included.Content[i], included.Content[i+1]
+		location := fmt.Sprintf("%s:%d", file, key.Line)
+
+		if key.Value == "include" {
+			return fmt.Errorf("%s: include is only supported in the main configuration file", location)
+		}
+
+		existing := mappingValue(m.root, key.Value)
+		switch {
+		case existing == nil:
+			m.root.Content = append(m.root.Content, key, value)
+			m.trackKey(file, key, value)
+
+		case existing.Tag == "!!null":
+			// e.g. an empty models: in the main file
+			*existing = *value
+			m.trackKey(file, key, value)
+
+		case includeMergedMaps[key.Value] && existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				entry := value.Content[j]
+				path := key.Value + "." + entry.Value
+				if previous, found := m.locations[path]; found {
+					return fmt.Errorf("duplicate %s in %s:%d, already defined in %s", path, file, entry.Line, previous)
+				}
+				existing.Content = append(existing.Content, entry, value.Content[j+1])
+				m.locations[path] = fmt.Sprintf("%s:%d", file, entry.Line)
+			}
+
+		case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			existing.Content = append(existing.Content, value.Content...)
+
+		default:
+			return fmt.Errorf("duplicate %s in %s, already defined in %s", key.Value, location, m.locations[key.Value])
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in mapping, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
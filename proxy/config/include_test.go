@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFiles writes files, keyed by their path relative to dir
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+func TestLoadConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": `
+include:
+  - models.d/*.yaml
+  - hooks.yaml
+healthCheckTimeout: 30
+macros:
+  "server": "llama-server --port ${PORT}"
+models:
+  main:
+    cmd: ${server} -m main.gguf
+notifications:
+  - exec: ./notify-main.sh
+`,
+		"models.d/b.yaml": `
+models:
+  model-b:
+    cmd: ${server} -m b.gguf
+    aliases: [b]
+`,
+		"models.d/a.yaml": `
+macros:
+  "ctx": 8192
+models:
+  model-a:
+    cmd: ${server} -m a.gguf -c ${ctx}
+groups:
+  pair:
+    members: [model-a, b]
+notifications:
+  - exec: ./notify-a.sh
+`,
+		"models.d/empty.yaml": "",
+		"hooks.yaml": `
+hooks:
+  on_startup:
+    preload: [model-a]
+`,
+	})
+
+	config, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 30, config.HealthCheckTimeout)
+	assert.Len(t, config.Models, 3)
+	assert.Equal(t, "llama-server --port 5801 -m a.gguf -c 8192", config.Models["model-a"].Cmd)
+	assert.Equal(t, "llama-server --port 5802 -m b.gguf", config.Models["model-b"].Cmd)
+	assert.Equal(t, []string{"model-a", "b"}, config.Groups["pair"].Members)
+	assert.Equal(t, []string{"model-a"}, config.Hooks.OnStartup.Preload)
+
+	// files are merged in glob order: a.yaml before b.yaml
+	if assert.Len(t, config.Notifications, 2) {
+		assert.Equal(t, "./notify-main.sh", config.Notifications[0].Exec)
+		assert.Equal(t, "./notify-a.sh", config.Notifications[1].Exec)
+	}
+
+	patterns, err := IncludePatterns(filepath.Join(dir, "config.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "models.d", "*.yaml"), filepath.Join(dir, "hooks.yaml")}, patterns)
+}
+
+func TestLoadConfig_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name: "duplicate model",
+			files: map[string]string{
+				"config.yaml":       "include: [models.d/*.yaml]\nmodels:\n  llama:\n    cmd: server\n",
+				"models.d/dup.yaml": "\nmodels:\n  llama:\n    cmd: other\n",
+			},
+			err: "duplicate models.llama in {dir}/models.d/dup.yaml:3, already defined in {dir}/config.yaml:3",
+		},
+		{
+			name: "duplicate setting",
+			files: map[string]string{
+				"config.yaml": "include: [extra.yaml]\nstartPort: 9000\n",
+				"extra.yaml":  "startPort: 9100\n",
+			},
+			err: "duplicate startPort in {dir}/extra.yaml:1, already defined in {dir}/config.yaml:2",
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"config.yaml": "include: [missing.yaml]\n",
+			},
+			err: "include {dir}/missing.yaml: file not found",
+		},
+		{
+			name: "nested include",
+			files: map[string]string{
+				"config.yaml": "include: [extra.yaml]\n",
+				"extra.yaml":  "include: [more.yaml]\n",
+			},
+			err: "{dir}/extra.yaml:1: include is only supported in the main configuration file",
+		},
+		{
+			name: "unknown key in an included file",
+			files: map[string]string{
+				"config.yaml":     "strict: true\ninclude: [models.d/*.yaml]\nmodels:\n  a:\n    cmd: server\n",
+				"models.d/b.yaml": "\nmodels:\n  b:\n    cmd: server\n    tll: 60\n",
+			},
+			err: "{dir}/models.d/b.yaml: yaml: unmarshal errors:\n  line 5: field tll not found in type config.rawModelConfig",
+		},
+		{
+			name: "invalid value in an included file",
+			files: map[string]string{
+				"config.yaml": "include: [extra.yaml]\nmodels:\n  a:\n    cmd: server\n",
+				"extra.yaml":  "\n\nhealthCheckTimeout: soon\n",
+			},
+			err: "{dir}/extra.yaml: yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `soon` into int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, tt.files)
+			_, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+			assert.EqualError(t, err, strings.ReplaceAll(tt.err, "{dir}", dir))
+		})
+	}
+}
@@ -121,3 +121,77 @@ models:
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "UNDEFINED")
 }
+
+// Test macros in env, aliases, name, description and useModelName
+func TestConfig_MacrosInModelFields(t *testing.T) {
+	content := `
+startPort: 10000
+macros:
+  "gpu": 1
+  "cache": "/var/cache/llama"
+
+models:
+  test:
+    cmd: server --port ${PORT}
+    proxy: http://localhost:${PORT}
+    macros:
+      "family": "qwen3"
+    env:
+      - CUDA_VISIBLE_DEVICES=${gpu}
+      - LLAMA_CACHE=${cache}/${MODEL_ID}
+      - SERVER_PORT=${PORT}
+    aliases:
+      - ${family}-latest
+    name: "${family} on GPU ${gpu}"
+    description: "served by ${MODEL_ID} on port ${PORT}"
+    useModelName: "${family}:32b"
+    splitTraffic:
+      - model: other-latest
+        percent: 10
+
+  other:
+    cmd: server
+    proxy: http://localhost:8080
+    aliases:
+      - ${MODEL_ID}-latest
+`
+
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	model := config.Models["test"]
+	assert.Equal(t, []string{"CUDA_VISIBLE_DEVICES=1", "LLAMA_CACHE=/var/cache/llama/test", "SERVER_PORT=10000"}, model.Env)
+	assert.Equal(t, []string{"qwen3-latest"}, model.Aliases)
+	assert.Equal(t, "qwen3 on GPU 1", model.Name)
+	assert.Equal(t, "served by test on port 10000", model.Description)
+	assert.Equal(t, "qwen3:32b", model.UseModelName)
+	assert.Equal(t, "other", model.SplitTraffic[0].Model)
+
+	realName, found := config.RealModelName("qwen3-latest")
+	assert.True(t, found)
+	assert.Equal(t, "test", realName)
+}
+
+// Test unknown macros in the newly supported fields are reported
+func TestConfig_UnknownMacroInModelFields(t *testing.T) {
+	tests := []struct {
+		field string
+		err   string
+	}{
+		{"env: [\"GPU=${gpu}\"]", "unknown macro '${gpu}' found in test.env[0]"},
+		{"aliases: [\"${family}-latest\"]", "unknown macro '${family}' found in test.aliases[0]"},
+		{"name: \"${family}\"", "unknown macro '${family}' found in test.name"},
+		{"description: \"${family}\"", "unknown macro '${family}' found in test.description"},
+		{"useModelName: \"${family}\"", "unknown macro '${family}' found in test.useModelName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			content := "models:\n  test:\n    cmd: server\n    proxy: http://localhost:8080\n    " + tt.field + "\n"
+			_, err := LoadConfigFromReader(strings.NewReader(content))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package config
 
 import (
-	"errors"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"slices"
 	"strings"
@@ -18,6 +19,9 @@ type ModelConfig struct {
 	Unlisted      bool     `yaml:"unlisted"`
 	UseModelName  string   `yaml:"useModelName"`
 
+	// Headers are added to requests sent to the upstream server
+	Headers map[string]string `yaml:"headers"`
+
 	// #179 for /v1/models
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
@@ -35,6 +39,43 @@ type ModelConfig struct {
 	// Metadata: see #264
 	// Arbitrary metadata that can be exposed through the API
 	Metadata map[string]any `yaml:"metadata"`
+
+	// SplitTraffic sends a percentage of requests to candidate models
+	SplitTraffic []TrafficSplit `yaml:"splitTraffic"`
+
+	// Mirror copies requests to a shadow model in the background
+	Mirror MirrorConfig `yaml:"mirror"`
+
+	// Resources limits the memory, CPU and priority of the upstream process
+	Resources ResourceLimits `yaml:"resources"`
+}
+
+// TrafficSplit sends Percent of the requests for a model to Model instead
+type TrafficSplit struct {
+	Model   string `yaml:"model"`
+	Percent int    `yaml:"percent"`
+}
+
+// MirrorConfig copies Percent of the requests to a shadow model. The shadow
+// response is discarded but its metrics and output are recorded.
+type MirrorConfig struct {
+	Model   string `yaml:"model"`
+	Percent int    `yaml:"percent"`
+}
+
+// set default values for MirrorConfig
+func (m *MirrorConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawMirrorConfig MirrorConfig
+	defaults := rawMirrorConfig{
+		Percent: 100,
+	}
+
+	if err := unmarshal(&defaults); err != nil {
+		return err
+	}
+
+	*m = MirrorConfig(defaults)
+	return nil
 }
 
 func (m *ModelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -67,37 +108,108 @@ func (m *ModelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// IsRemote returns true for models without a cmd. They proxy to a server that
+// llama-swap does not start or stop.
+func (m ModelConfig) IsRemote() bool {
+	return strings.TrimSpace(m.Cmd) == ""
+}
+
 func (m *ModelConfig) SanitizedCommand() ([]string, error) {
 	return SanitizeCommand(m.Cmd)
 }
 
+// ModelFile returns the model file of cmd, the value of -m or --model. It is
+// empty for remote models and for container commands, their paths are inside
+// the container.
+func (m ModelConfig) ModelFile() string {
+	args, err := SanitizeCommand(m.Cmd)
+	if err != nil || len(args) == 0 {
+		return ""
+	}
+	switch strings.TrimSuffix(filepath.Base(args[0]), ".exe") {
+	case "docker", "podman", "nerdctl":
+		return ""
+	}
+
+	for i := 1; i < len(args); i++ {
+		if name, value, found := strings.Cut(args[i], "="); found && (name == "-m" || name == "--model") {
+			return value
+		} else if (args[i] == "-m" || args[i] == "--model") && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
 // ModelFilters see issue #174
 type ModelFilters struct {
 	StripParams string `yaml:"stripParams"`
+
+	// SetParams are always set in the request body, overriding client values.
+	// DefaultParams are only set when the client did not send the key.
+	// Keys are JSON paths, e.g. chat_template_kwargs.enable_thinking
+	SetParams     map[string]any `yaml:"setParams"`
+	DefaultParams map[string]any `yaml:"defaultParams"`
+
+	// Filters for the chat messages array. System messages are merged first
+	// and the prepended/appended system prompt is applied to the result.
+	MergeSystemMessages bool                 `yaml:"mergeSystemMessages"`
+	PrependSystemPrompt string               `yaml:"prependSystemPrompt"`
+	AppendSystemPrompt  string               `yaml:"appendSystemPrompt"`
+	StripImages         bool                 `yaml:"stripImages"`
+	ReplaceContent      []ContentReplacement `yaml:"replaceContent"`
+
+	// ThinkTags handles <think>...</think> in the response content.
+	// "extract" moves it to reasoning_content, "strip" removes it.
+	ThinkTags string `yaml:"thinkTags"`
+}
+
+// ContentReplacement replaces regex matches in the text content of messages
+type ContentReplacement struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+
+	// only replace in messages with these roles, empty means all roles
+	Roles []string `yaml:"roles"`
+
+	// the compiled Pattern, set when the configuration is loaded
+	regexp *regexp.Regexp
+}
+
+// Regexp returns the pattern compiled when the configuration was loaded, or
+// compiles it for a ContentReplacement that was not loaded
+func (r ContentReplacement) Regexp() (*regexp.Regexp, error) {
+	if r.regexp != nil {
+		return r.regexp, nil
+	}
+	return regexp.Compile(r.Pattern)
+}
+
+// HasMessageFilters returns true if any filter modifies the messages array
+func (f ModelFilters) HasMessageFilters() bool {
+	return f.MergeSystemMessages || f.PrependSystemPrompt != "" || f.AppendSystemPrompt != "" ||
+		f.StripImages || len(f.ReplaceContent) > 0
 }
 
 func (m *ModelFilters) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type rawModelFilters ModelFilters
-	defaults := rawModelFilters{
-		StripParams: "",
+
+	// the old field name is accepted for backwards compatibility. It is
+	// decoded together with the other fields so strict mode accepts it.
+	var defaults struct {
+		rawModelFilters   `yaml:",inline"`
+		LegacyStripParams string `yaml:"strip_params"`
 	}
 
 	if err := unmarshal(&defaults); err != nil {
 		return err
 	}
 
-	// Try to unmarshal with the old field name for backwards compatibility
 	if defaults.StripParams == "" {
-		var legacy struct {
-			StripParams string `yaml:"strip_params"`
-		}
-		if legacyErr := unmarshal(&legacy); legacyErr != nil {
-			return errors.New("failed to unmarshal legacy filters.strip_params: " + legacyErr.Error())
-		}
-		defaults.StripParams = legacy.StripParams
+		defaults.StripParams = defaults.LegacyStripParams
 	}
 
-	*m = ModelFilters(defaults)
+	*m = ModelFilters(defaults.rawModelFilters)
 	return nil
 }
 
@@ -123,3 +235,18 @@ func (f ModelFilters) SanitizedStripParams() ([]string, error) {
 	slices.Sort(cleaned)
 	return cleaned, nil
 }
+
+// SanitizedParamKeys returns the sorted keys of setParams or defaultParams
+// with the model key removed as it can never be overridden
+func SanitizedParamKeys(params map[string]any) []string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		trimmed := strings.TrimSpace(key)
+		if trimmed == "model" || trimmed == "" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -20,6 +20,19 @@ func TestConfig_ModelConfigSanitizedCommand(t *testing.T) {
 	assert.Equal(t, []string{"python", "model1.py", "--arg1", "value1", "--arg2", "value2"}, args)
 }
 
+func TestConfig_ModelConfigModelFile(t *testing.T) {
+	tests := map[string]string{
+		"llama-server --port 8080 -m /models/qwen.gguf --mmproj mmproj.gguf": "/models/qwen.gguf",
+		"llama-server --model=/models/qwen.gguf":                             "/models/qwen.gguf",
+		"llama-server -hf unsloth/Qwen3-8B-GGUF":                             "",
+		"docker run --rm llama-server -m /models/qwen.gguf":                  "",
+		"": "",
+	}
+	for cmd, expected := range tests {
+		assert.Equal(t, expected, ModelConfig{Cmd: cmd}.ModelFile(), cmd)
+	}
+}
+
 func TestConfig_ModelFilters(t *testing.T) {
 	content := `
 macros:
@@ -52,3 +65,145 @@ models:
 	}
 
 }
+
+func TestConfig_ModelFiltersSetAndDefaultParams(t *testing.T) {
+	content := `
+macros:
+  temp: 0.6
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    filters:
+      setParams:
+        temperature: ${temp}
+        chat_template_kwargs.enable_thinking: false
+        model: "can not be set"
+      defaultParams:
+        top_p: 0.95
+        stop: ["<|end|>", "${MODEL_ID}"]
+`
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filters := config.Models["model1"].Filters
+	assert.Equal(t, 0.6, filters.SetParams["temperature"])
+	assert.Equal(t, false, filters.SetParams["chat_template_kwargs.enable_thinking"])
+	assert.Equal(t, []any{"<|end|>", "model1"}, filters.DefaultParams["stop"])
+	assert.Equal(t, []string{"chat_template_kwargs.enable_thinking", "temperature"}, SanitizedParamKeys(filters.SetParams))
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    filters:
+      defaultParams:
+        temperature: ${unknown}
+`))
+	assert.EqualError(t, err, "model model1 filters.defaultParams: unknown macro '${unknown}'")
+}
+
+func TestConfig_ModelFiltersMessages(t *testing.T) {
+	content := `
+macros:
+  prompt: "You are ${MODEL_ID}"
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    filters:
+      mergeSystemMessages: true
+      prependSystemPrompt: "${prompt}"
+      stripImages: true
+      replaceContent:
+        - pattern: "(?i)<\\|im_start\\|>"
+          replacement: ""
+          roles: ["user"]
+`
+	config, err := LoadConfigFromReader(strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filters := config.Models["model1"].Filters
+	assert.True(t, filters.HasMessageFilters())
+	assert.Equal(t, "You are model1", filters.PrependSystemPrompt)
+	if assert.Len(t, filters.ReplaceContent, 1) {
+		replacement := filters.ReplaceContent[0]
+		assert.Equal(t, `(?i)<\|im_start\|>`, replacement.Pattern)
+		assert.Equal(t, "", replacement.Replacement)
+		assert.Equal(t, []string{"user"}, replacement.Roles)
+		// compiled when the configuration is loaded
+		if assert.NotNil(t, replacement.regexp) {
+			assert.Equal(t, replacement.Pattern, replacement.regexp.String())
+		}
+	}
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    filters:
+      replaceContent:
+        - pattern: "([a-z"
+`))
+	assert.ErrorContains(t, err, "model model1 filters.replaceContent[0]: invalid pattern:")
+}
+
+func TestConfig_ModelFiltersThinkTags(t *testing.T) {
+	config, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    filters:
+      thinkTags: extract
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "extract", config.Models["model1"].Filters.ThinkTags)
+	}
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    filters:
+      thinkTags: remove
+`))
+	assert.EqualError(t, err, "model model1 filters.thinkTags must be extract or strip, got: remove")
+}
+
+func TestConfig_RemoteModel(t *testing.T) {
+	config, err := LoadConfigFromReader(strings.NewReader(`
+macros:
+  api_key: secret
+models:
+  remote:
+    proxy: https://vllm.example.com
+    headers:
+      Authorization: "Bearer ${api_key}"
+  local:
+    cmd: path/to/cmd --port ${PORT}
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, config.Models["remote"].IsRemote())
+	assert.False(t, config.Models["local"].IsRemote())
+	assert.Equal(t, map[string]string{"Authorization": "Bearer secret"}, config.Models["remote"].Headers)
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  remote:
+    checkEndpoint: none
+`))
+	assert.EqualError(t, err, "model remote: proxy must be set to the remote server when cmd is empty")
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  remote:
+    proxy: https://vllm.example.com
+    headers:
+      Authorization: "Bearer ${missing}"
+`))
+	assert.EqualError(t, err, "unknown macro '${missing}' found in remote.headers.Authorization")
+}
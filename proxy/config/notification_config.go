@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// events that can be sent as notifications
+const (
+	NotifyProcessStateChanged = "process_state_changed"
+	NotifyModelPreloaded      = "model_preloaded"
+	NotifyConfigChanged       = "config_changed"
+	NotifyProcessCrashed      = "process_crashed"
+	NotifyHealthCheckFailed   = "health_check_failed"
+)
+
+var notificationEvents = []string{
+	NotifyProcessStateChanged,
+	NotifyModelPreloaded,
+	NotifyConfigChanged,
+	NotifyProcessCrashed,
+	NotifyHealthCheckFailed,
+}
+
+// NotificationConfig delivers events to a webhook, a local command or both
+type NotificationConfig struct {
+	// events to send, empty means all events
+	Events []string `yaml:"events"`
+
+	// only send events of these models, empty means all models.
+	// Events without a model, like config_changed, are always sent.
+	Models []string `yaml:"models"`
+
+	// JSON POST of the event
+	Webhook string            `yaml:"webhook"`
+	Headers map[string]string `yaml:"headers"`
+
+	// signs the webhook body with HMAC-SHA256 when set
+	Secret string `yaml:"secret"`
+
+	// webhook retries with exponential backoff
+	Retries int `yaml:"retries"`
+
+	// command run with the event in environment variables
+	Exec string `yaml:"exec"`
+}
+
+func (n *NotificationConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawNotificationConfig NotificationConfig
+	defaults := rawNotificationConfig{
+		Retries: 3,
+	}
+
+	if err := unmarshal(&defaults); err != nil {
+		return err
+	}
+
+	*n = NotificationConfig(defaults)
+	return nil
+}
+
+// Wants returns true if the notification should be sent for the event and model
+func (n NotificationConfig) Wants(event, modelID string) bool {
+	if len(n.Events) > 0 && !slices.Contains(n.Events, event) {
+		return false
+	}
+	if modelID != "" && len(n.Models) > 0 && !slices.Contains(n.Models, modelID) {
+		return false
+	}
+	return true
+}
+
+// validateNotifications checks the notifications. Model IDs and aliases are
+// replaced with the real model ID.
+func validateNotifications(config *Config) error {
+	for i := range config.Notifications {
+		n := &config.Notifications[i]
+		if n.Webhook == "" && n.Exec == "" {
+			return fmt.Errorf("notifications[%d]: webhook or exec is required", i)
+		}
+		if n.Webhook != "" {
+			if u, err := url.Parse(n.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("notifications[%d]: webhook must be an http or https URL, got: %s", i, n.Webhook)
+			}
+		}
+		if n.Exec != "" {
+			if _, err := SanitizeCommand(n.Exec); err != nil {
+				return fmt.Errorf("notifications[%d]: invalid exec: %s", i, err.Error())
+			}
+		}
+		if n.Retries < 0 {
+			return fmt.Errorf("notifications[%d]: retries must be greater than or equal to 0", i)
+		}
+
+		for _, event := range n.Events {
+			if !slices.Contains(notificationEvents, event) {
+				return fmt.Errorf("notifications[%d]: unknown event %s, must be one of: %s", i, event, strings.Join(notificationEvents, ", "))
+			}
+		}
+
+		models := make([]string, 0, len(n.Models))
+		for _, model := range n.Models {
+			realName, found := config.RealModelName(strings.TrimSpace(model))
+			if !found {
+				return fmt.Errorf("notifications[%d]: unknown model %s", i, model)
+			}
+			models = append(models, realName)
+		}
+		n.Models = models
+	}
+	return nil
+}
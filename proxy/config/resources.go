@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCgroupRoot is where the model cgroups are created
+const DefaultCgroupRoot = "/sys/fs/cgroup/llama-swap"
+
+// MaxAffinityCPUs is the size of the CPU affinity mask, cpuAffinity CPUs must
+// be lower
+const MaxAffinityCPUs = 1024
+
+// ResourceLimits restricts what an upstream process can use. The limits are
+// only applied on Linux.
+type ResourceLimits struct {
+	// cgroup v2 limits: memory.max, cpu.max and pids.max
+	Memory string  `yaml:"memory"`
+	CPUs   float64 `yaml:"cpus"`
+	Pids   int     `yaml:"pids"`
+
+	// scheduling priority, -20 (highest) to 19 (lowest)
+	Nice int `yaml:"nice"`
+
+	// I/O priority: idle, best-effort[:0-7] or realtime[:0-7]
+	IONice string `yaml:"ionice"`
+
+	// CPUs the process can run on, e.g. "0-7,16"
+	CPUAffinity string `yaml:"cpuAffinity"`
+}
+
+// IsSet returns true if any limit is configured
+func (r ResourceLimits) IsSet() bool {
+	return r.UsesCgroup() || r.Nice != 0 || r.IONice != "" || r.CPUAffinity != ""
+}
+
+// UsesCgroup returns true if a cgroup is needed for the limits
+func (r ResourceLimits) UsesCgroup() bool {
+	return r.Memory != "" || r.CPUs != 0 || r.Pids != 0
+}
+
+func (r ResourceLimits) Validate() error {
+	if r.Memory != "" {
+		if _, err := ParseMemorySize(r.Memory); err != nil {
+			return fmt.Errorf("memory: %v", err)
+		}
+	}
+	if r.CPUs < 0 {
+		return fmt.Errorf("cpus must be greater than or equal to 0")
+	}
+	if r.Pids < 0 {
+		return fmt.Errorf("pids must be greater than or equal to 0")
+	}
+	if r.Nice < -20 || r.Nice > 19 {
+		return fmt.Errorf("nice must be between -20 and 19, got: %d", r.Nice)
+	}
+	if r.IONice != "" {
+		if _, _, err := ParseIONice(r.IONice); err != nil {
+			return fmt.Errorf("ionice: %v", err)
+		}
+	}
+	if r.CPUAffinity != "" {
+		if _, err := ParseCPUList(r.CPUAffinity); err != nil {
+			return fmt.Errorf("cpuAffinity: %v", err)
+		}
+	}
+	return nil
+}
+
+// ParseMemorySize returns the number of bytes in sizes like 512M, 16G or
+// 1.5GiB. Suffixes are powers of 1024.
+func ParseMemorySize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := 1.0
+	if s != "" {
+		if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+			multiplier = math.Pow(1024, float64(i+1))
+			s = s[:len(s)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a value like 512M or 16G", size)
+	}
+	return int64(value * multiplier), nil
+}
+
+// ioprio classes, see ioprio_set(2)
+const (
+	IOPrioClassRealtime   = 1
+	IOPrioClassBestEffort = 2
+	IOPrioClassIdle       = 3
+)
+
+// ParseIONice returns the I/O scheduling class and level of idle,
+// best-effort[:level] or realtime[:level]. The default level is 4.
+func ParseIONice(ionice string) (class int, level int, err error) {
+	name, levelStr, hasLevel := strings.Cut(strings.TrimSpace(ionice), ":")
+	switch name {
+	case "idle":
+		if hasLevel {
+			return 0, 0, fmt.Errorf("idle does not have a level")
+		}
+		return IOPrioClassIdle, 0, nil
+	case "best-effort":
+		class = IOPrioClassBestEffort
+	case "realtime":
+		class = IOPrioClassRealtime
+	default:
+		return 0, 0, fmt.Errorf("must be idle, best-effort[:0-7] or realtime[:0-7], got: %s", ionice)
+	}
+
+	level = 4
+	if hasLevel {
+		if level, err = strconv.Atoi(levelStr); err != nil || level < 0 || level > 7 {
+			return 0, 0, fmt.Errorf("level must be between 0 and 7, got: %s", levelStr)
+		}
+	}
+	return class, level, nil
+}
+
+// ParseCPUList returns the CPUs in a list like "0-3,8,10-11"
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid CPU %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("invalid CPU range %q", part)
+			}
+		}
+		if end >= MaxAffinityCPUs {
+			return nil, fmt.Errorf("CPU %d is not supported, the maximum is %d", end, MaxAffinityCPUs-1)
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
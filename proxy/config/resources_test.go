@@ -0,0 +1,117 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMemorySize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+	}{
+		{"1024", 1024},
+		{"512K", 512 << 10},
+		{"512M", 512 << 20},
+		{"16G", 16 << 30},
+		{"1.5GiB", 3 << 29},
+		{"2t", 2 << 40},
+	}
+	for _, tt := range tests {
+		size, err := ParseMemorySize(tt.size)
+		assert.NoError(t, err, tt.size)
+		assert.Equal(t, tt.expected, size, tt.size)
+	}
+
+	for _, size := range []string{"", "G", "-1G", "16X", "lots"} {
+		_, err := ParseMemorySize(size)
+		assert.Error(t, err, size)
+	}
+}
+
+func TestParseIONice(t *testing.T) {
+	class, level, err := ParseIONice("idle")
+	assert.NoError(t, err)
+	assert.Equal(t, IOPrioClassIdle, class)
+	assert.Equal(t, 0, level)
+
+	class, level, err = ParseIONice("best-effort")
+	assert.NoError(t, err)
+	assert.Equal(t, IOPrioClassBestEffort, class)
+	assert.Equal(t, 4, level)
+
+	class, level, err = ParseIONice("realtime:0")
+	assert.NoError(t, err)
+	assert.Equal(t, IOPrioClassRealtime, class)
+	assert.Equal(t, 0, level)
+
+	for _, ionice := range []string{"idle:3", "best-effort:8", "fast"} {
+		_, _, err := ParseIONice(ionice)
+		assert.Error(t, err, ionice)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("0-3, 8,10-11")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 8, 10, 11}, cpus)
+
+	cpus, err = ParseCPUList("1023")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1023}, cpus)
+
+	// CPUs are limited to the affinity mask, large ranges are not allocated
+	for _, list := range []string{"", "a", "3-1", "1,,2", "-1", "1024", "0-1000000000"} {
+		_, err := ParseCPUList(list)
+		assert.Error(t, err, list)
+	}
+}
+
+func TestConfig_Resources(t *testing.T) {
+	config, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    resources:
+      memory: 24G
+      cpus: 8
+      pids: 512
+      nice: 10
+      ionice: best-effort:7
+      cpuAffinity: 0-7
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, DefaultCgroupRoot, config.CgroupRoot)
+	assert.Equal(t, ResourceLimits{
+		Memory:      "24G",
+		CPUs:        8,
+		Pids:        512,
+		Nice:        10,
+		IONice:      "best-effort:7",
+		CPUAffinity: "0-7",
+	}, config.Models["model1"].Resources)
+
+	tests := []struct {
+		resources string
+		err       string
+	}{
+		{"memory: lots", `model model1 resources.memory: invalid size "lots", expected a value like 512M or 16G`},
+		{"cpus: -1", "model model1 resources.cpus must be greater than or equal to 0"},
+		{"nice: 20", "model model1 resources.nice must be between -20 and 19, got: 20"},
+		{"ionice: fast", "model model1 resources.ionice: must be idle, best-effort[:0-7] or realtime[:0-7], got: fast"},
+		{"cpuAffinity: 4-2", `model model1 resources.cpuAffinity: invalid CPU range "4-2"`},
+	}
+	for _, tt := range tests {
+		_, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    resources:
+      ` + tt.resources + "\n"))
+		assert.EqualError(t, err, tt.err, tt.resources)
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RouterConfig is a virtual model that routes requests to a real model
+// based on the content of the request body
+type RouterConfig struct {
+	Description string `yaml:"description"`
+	Unlisted    bool   `yaml:"unlisted"`
+
+	// requested models starting with one of these prefixes also use the router
+	MatchPrefixes []string `yaml:"matchPrefixes"`
+
+	// rules are evaluated in order, the first matching rule wins
+	Rules []RouteRule `yaml:"rules"`
+
+	// model used when no rule matches
+	Default string `yaml:"default"`
+}
+
+// RouteRule routes to Model when all of its conditions are true. A rule
+// without conditions always matches.
+type RouteRule struct {
+	Model string `yaml:"model"`
+
+	// conditions
+	HasImages       *bool  `yaml:"hasImages"`
+	HasTools        *bool  `yaml:"hasTools"`
+	MinPromptTokens int    `yaml:"minPromptTokens"`
+	ModelPrefix     string `yaml:"modelPrefix"`
+}
+
+// FindRouter returns the router ID and config for the requested model. Exact
+// router IDs are checked first, then the longest matching prefix.
+func (c *Config) FindRouter(requestedModel string) (string, RouterConfig, bool) {
+	if router, found := c.Routers[requestedModel]; found {
+		return requestedModel, router, true
+	}
+
+	bestID, bestLen := "", 0
+	for routerID, router := range c.Routers {
+		for _, prefix := range router.MatchPrefixes {
+			if prefix != "" && strings.HasPrefix(requestedModel, prefix) && len(prefix) > bestLen {
+				bestID, bestLen = routerID, len(prefix)
+			}
+		}
+	}
+
+	if bestID == "" {
+		return "", RouterConfig{}, false
+	}
+	return bestID, c.Routers[bestID], true
+}
+
+// validateRouters checks that router IDs do not shadow models and that
+// every rule routes to a known model. Target model aliases are resolved
+// to the real model ID.
+func validateRouters(config *Config) error {
+	routerIDs := make([]string, 0, len(config.Routers))
+	for routerID := range config.Routers {
+		routerIDs = append(routerIDs, routerID)
+	}
+	sort.Strings(routerIDs)
+
+	for _, routerID := range routerIDs {
+		router := config.Routers[routerID]
+		if _, found := config.RealModelName(routerID); found {
+			return fmt.Errorf("router %s: ID is already used by a model or alias", routerID)
+		}
+
+		if len(router.Rules) == 0 && router.Default == "" {
+			return fmt.Errorf("router %s: rules or default is required", routerID)
+		}
+
+		rules := make([]RouteRule, len(router.Rules))
+		for i, rule := range router.Rules {
+			if rule.Model == "" {
+				return fmt.Errorf("router %s rules[%d]: model is required", routerID, i)
+			}
+			if rule.MinPromptTokens < 0 {
+				return fmt.Errorf("router %s rules[%d]: minPromptTokens must be greater than or equal to 0", routerID, i)
+			}
+			realName, found := config.RealModelName(rule.Model)
+			if !found {
+				return fmt.Errorf("router %s rules[%d]: unknown model %s", routerID, i, rule.Model)
+			}
+			rule.Model = realName
+			rules[i] = rule
+		}
+		router.Rules = rules
+
+		if router.Default != "" {
+			realName, found := config.RealModelName(router.Default)
+			if !found {
+				return fmt.Errorf("router %s: unknown default model %s", routerID, router.Default)
+			}
+			router.Default = realName
+		}
+
+		config.Routers[routerID] = router
+	}
+
+	return nil
+}
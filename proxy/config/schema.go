@@ -0,0 +1,299 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaID is where the published schema can be downloaded
+const SchemaID = "https://raw.githubusercontent.com/mostlygeek/llama-swap/main/config-schema.json"
+
+// schemaDescriptions describe each key of the configuration, by type name and
+// YAML key. TestSchema checks every key has one.
+var schemaDescriptions = map[string]string{
+	"Config.healthCheckTimeout": "Seconds to wait for a model to be ready, minimum 15.",
+	"Config.logRequests":        "Log every request to the upstream servers.",
+	"Config.logLevel":           "Level of the proxy logs.",
+	"Config.metricsMaxInMemory": "Maximum number of request metrics kept in memory.",
+	"Config.models":             "Models llama-swap can start and proxy to, the key is the model ID.",
+	"Config.profiles":           "Lists of models that can be requested together as profile:model.",
+	"Config.groups":             "Groups control which models can run at the same time, the key is the group ID.",
+	"Config.macros":             "Values substituted for ${name} in the model configurations.",
+	"Config.include":            "Globs of files merged into this configuration, relative to this file.",
+	"Config.startPort":          "First port assigned to ${PORT}.",
+	"Config.drainTimeout":       "Seconds to wait for in-flight requests on shutdown.",
+	"Config.stateFile":          "Running processes are recorded here and adopted after a restart, disabled when empty.",
+	"Config.cgroupRoot":         "Parent cgroup for the per model cgroups used by resources limits.",
+	"Config.hooks":              "Actions run on startup, on a schedule and when events happen.",
+	"Config.rateLimits":         "Per client request and token limits.",
+	"Config.usage":              "Token usage accounting per user.",
+	"Config.routers":            "Virtual models that route requests to real models, the key is the router ID.",
+	"Config.peers":              "Other llama-swap instances whose models are served through this one, the key is the peer ID.",
+	"Config.notifications":      "Lifecycle events delivered to webhooks and commands.",
+	"Config.strict":             "Reject unknown keys in the configuration.",
+	"Config.configAPI":          "Endpoints that change models and groups at runtime.",
+	"Config.discovery":          "Directories of GGUF files, a model is generated for each file.",
+	"Config.tls":                "HTTPS, the command line flags take precedence and changes require a restart.",
+
+	"ModelConfig.cmd":              "Command that starts the upstream server, models without cmd are remote.",
+	"ModelConfig.cmdStop":          "Command that stops the upstream server, ${PID} is the process ID.",
+	"ModelConfig.proxy":            "URL requests are proxied to.",
+	"ModelConfig.aliases":          "Other names the model can be requested with.",
+	"ModelConfig.env":              "Environment variables for cmd, as NAME=value.",
+	"ModelConfig.checkEndpoint":    "Path checked until the upstream server is ready, none disables the check.",
+	"ModelConfig.ttl":              "Seconds without requests before the model is unloaded, 0 never unloads.",
+	"ModelConfig.unlisted":         "Hide the model from /v1/models.",
+	"ModelConfig.useModelName":     "Model name sent to the upstream server instead of the model ID.",
+	"ModelConfig.headers":          "Headers added to requests sent to the upstream server.",
+	"ModelConfig.name":             "Display name in /v1/models.",
+	"ModelConfig.description":      "Description in /v1/models.",
+	"ModelConfig.concurrencyLimit": "Maximum concurrent requests, 0 uses the default of 10.",
+	"ModelConfig.filters":          "Changes made to requests and responses.",
+	"ModelConfig.macros":           "Model macros, they take precedence over the global macros.",
+	"ModelConfig.metadata":         "Arbitrary metadata exposed in /v1/models.",
+	"ModelConfig.splitTraffic":     "Send a percentage of the requests to other models.",
+	"ModelConfig.mirror":           "Copy requests to a shadow model in the background.",
+	"ModelConfig.resources":        "Memory, CPU and priority limits of the upstream process, Linux only.",
+
+	"GroupConfig.swap":             "Only one member runs at a time.",
+	"GroupConfig.exclusive":        "Loading a member unloads the models of other groups.",
+	"GroupConfig.persistent":       "Members are not unloaded by other exclusive groups.",
+	"GroupConfig.members":          "Model IDs in the group.",
+	"GroupConfig.ttl":              "Default ttl of the members.",
+	"GroupConfig.env":              "Environment variables added to the members' env, a member's own value for a name takes precedence.",
+	"GroupConfig.macros":           "Macros of the members, between the global and the model macros in precedence.",
+	"GroupConfig.concurrencyLimit": "Default concurrencyLimit of the members.",
+	"GroupConfig.filters":          "Default filters of the members. Params and lists are merged, the member's values take precedence.",
+	"GroupConfig.idleTtl":          "Seconds without requests to any member before all members are unloaded together, 0 disables it.",
+
+	"ModelFilters.stripParams":         "Comma separated parameters removed from requests.",
+	"ModelFilters.setParams":           "Parameters always set in requests, keys are JSON paths.",
+	"ModelFilters.defaultParams":       "Parameters set in requests when the client did not send them, keys are JSON paths.",
+	"ModelFilters.mergeSystemMessages": "Merge all system messages into the first one.",
+	"ModelFilters.prependSystemPrompt": "Text added before the system prompt.",
+	"ModelFilters.appendSystemPrompt":  "Text added after the system prompt.",
+	"ModelFilters.stripImages":         "Remove images from the messages.",
+	"ModelFilters.replaceContent":      "Regex replacements in the text content of messages.",
+	"ModelFilters.thinkTags":           "Move <think> blocks in responses to reasoning_content, or strip them.",
+	"ModelFilters.strip_params":        "Deprecated, use stripParams.",
+
+	"ContentReplacement.pattern":     "Regular expression to replace.",
+	"ContentReplacement.replacement": "Replacement text, $1 refers to capture groups.",
+	"ContentReplacement.roles":       "Only replace in messages with these roles, empty means all roles.",
+
+	"TrafficSplit.model":   "Model that receives the requests.",
+	"TrafficSplit.percent": "Percentage of the requests, the total of a model must not be more than 100.",
+
+	"MirrorConfig.model":   "Shadow model that receives a copy of the requests.",
+	"MirrorConfig.percent": "Percentage of the requests copied, 0 to 100.",
+
+	"ResourceLimits.memory":      "Memory limit, e.g. 24G.",
+	"ResourceLimits.cpus":        "Number of CPUs, e.g. 4.5.",
+	"ResourceLimits.pids":        "Maximum number of processes and threads.",
+	"ResourceLimits.nice":        "Scheduling priority, -20 (highest) to 19 (lowest).",
+	"ResourceLimits.ionice":      "I/O priority: idle, best-effort[:0-7] or realtime[:0-7].",
+	"ResourceLimits.cpuAffinity": "CPUs the process can run on, e.g. 0-7,16.",
+
+	"HooksConfig.on_startup":       "Actions run when llama-swap starts.",
+	"HooksConfig.schedule":         "Actions run at times matching a cron expression.",
+	"HooksConfig.on_model_ready":   "Actions run when a model is ready.",
+	"HooksConfig.on_model_stopped": "Actions run when a model stops.",
+	"HooksConfig.on_idle":          "Actions run when no requests were received for a while.",
+	"HooksConfig.on_crash":         "Actions run when an upstream process exits unexpectedly.",
+
+	"HookOnStartup.preload": "Models loaded on startup.",
+
+	"HookAction.exec":    "Command run with the event in environment variables.",
+	"HookAction.webhook": "URL the event is posted to as JSON.",
+	"HookAction.models":  "Only run for events of these models, empty means all models.",
+	"HookAction.after":   "on_idle only: seconds without requests before the action runs.",
+
+	"ScheduledHook.cron":      "Five field cron expression, e.g. 0 8 * * 1-5.",
+	"ScheduledHook.preload":   "Models loaded at the scheduled time.",
+	"ScheduledHook.unload":    "Models unloaded at the scheduled time.",
+	"ScheduledHook.unloadAll": "Unload all models at the scheduled time.",
+
+	"RateLimitConfig.keyBy":             "How clients are identified: apiKey, ip or header:<name>.",
+	"RateLimitConfig.requestsPerMinute": "Requests per minute for each client, 0 is unlimited.",
+	"RateLimitConfig.tokensPerHour":     "Tokens per hour for each client, 0 is unlimited.",
+	"RateLimitConfig.tokensPerDay":      "Tokens per day for each client, 0 is unlimited.",
+
+	"UsageConfig.keyBy": "How users are identified: apiKey, ip or header:<name>.",
+	"UsageConfig.file":  "File where the usage totals are persisted, disabled when empty.",
+
+	"RouterConfig.description":   "Description in /v1/models.",
+	"RouterConfig.unlisted":      "Hide the router from /v1/models.",
+	"RouterConfig.matchPrefixes": "Requested models starting with one of these prefixes also use the router.",
+	"RouterConfig.rules":         "Rules evaluated in order, the first matching rule wins.",
+	"RouterConfig.default":       "Model used when no rule matches.",
+
+	"RouteRule.model":           "Model the request is routed to.",
+	"RouteRule.hasImages":       "Match requests with or without images.",
+	"RouteRule.hasTools":        "Match requests with or without tools.",
+	"RouteRule.minPromptTokens": "Match requests with at least this many estimated prompt tokens.",
+	"RouteRule.modelPrefix":     "Match requested models starting with this prefix.",
+
+	"PeerConfig.url":     "Base URL of the peer.",
+	"PeerConfig.headers": "Headers added to requests sent to the peer, e.g. for authentication.",
+
+	"TLSConfig.certFile":       "Certificate file, enables HTTPS together with keyFile.",
+	"TLSConfig.keyFile":        "Private key file.",
+	"TLSConfig.clientCAFile":   "CA bundle to verify client certificates against (mutual TLS).",
+	"TLSConfig.redirectListen": "Optional ip/port for a plain HTTP listener that redirects to HTTPS.",
+
+	"DiscoveryConfig.dir":       "Directory scanned for .gguf files, relative to this file.",
+	"DiscoveryConfig.recursive": "Also scan subdirectories, the model ID includes the subdirectory.",
+	"DiscoveryConfig.model":     "Settings of the generated models, ${MODEL_PATH}, ${MODEL_NAME} and ${MMPROJ} are replaced in all values.",
+
+	"ConfigAPIConfig.apiKeys":   "Keys allowed to use the /api/config endpoints, disabled when empty.",
+	"ConfigAPIConfig.writeBack": "Write changes to the configuration file, comments are kept.",
+
+	"NotificationConfig.events":  "Events to send, empty means all events.",
+	"NotificationConfig.models":  "Only send events of these models, empty means all models.",
+	"NotificationConfig.webhook": "URL the event is posted to as JSON.",
+	"NotificationConfig.headers": "Headers added to the webhook request.",
+	"NotificationConfig.secret":  "Signs the webhook body with HMAC-SHA256 when set.",
+	"NotificationConfig.retries": "Webhook retries with exponential backoff.",
+	"NotificationConfig.exec":    "Command run with the event in environment variables.",
+}
+
+// schemaEnums are the allowed values of keys, by type name and YAML key
+var schemaEnums = map[string][]string{
+	"Config.logLevel":           {"debug", "info", "warn", "error"},
+	"ModelFilters.thinkTags":    {"extract", "strip"},
+	"NotificationConfig.events": notificationEvents,
+}
+
+// Schema returns the JSON Schema of the configuration file
+func Schema() ([]byte, error) {
+	g := &schemaGenerator{definitions: make(map[string]any)}
+	root := g.structSchema(reflect.TypeOf(Config{}), reflect.ValueOf(defaultConfig()))
+
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["$id"] = SchemaID
+	root["title"] = "llama-swap configuration"
+	root["definitions"] = g.definitions
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type schemaGenerator struct {
+	definitions map[string]any
+}
+
+// structSchema returns the schema of a struct type. Keys with a non zero value
+// in defaults are documented with that default.
+func (g *schemaGenerator) structSchema(t reflect.Type, defaults reflect.Value) map[string]any {
+	properties := make(map[string]any)
+	g.addProperties(t, defaults, properties)
+
+	// ModelFilters still accepts the legacy key, see UnmarshalYAML
+	if t == reflect.TypeOf(ModelFilters{}) {
+		properties["strip_params"] = g.property(t.Name(), "strip_params", reflect.TypeOf(""), reflect.Value{})
+		properties["strip_params"].(map[string]any)["deprecated"] = true
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func (g *schemaGenerator) addProperties(t reflect.Type, defaults reflect.Value, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if options == "inline" {
+			g.addProperties(field.Type, defaults.Field(i), properties)
+			continue
+		}
+		if key == "" || key == "-" {
+			continue
+		}
+
+		properties[key] = g.property(t.Name(), key, field.Type, defaults.Field(i))
+	}
+}
+
+func (g *schemaGenerator) property(typeName, key string, t reflect.Type, defaultValue reflect.Value) map[string]any {
+	schema := g.typeSchema(t)
+	if description, found := schemaDescriptions[typeName+"."+key]; found {
+		schema["description"] = description
+	}
+	if enum, found := schemaEnums[typeName+"."+key]; found {
+		if items, ok := schema["items"].(map[string]any); ok {
+			items["enum"] = enum
+		} else {
+			schema["enum"] = enum
+		}
+	}
+	if defaultValue.IsValid() && !defaultValue.IsZero() && defaultValue.Kind() != reflect.Struct &&
+		!(defaultValue.Kind() == reflect.Slice || defaultValue.Kind() == reflect.Map) {
+		schema["default"] = defaultValue.Interface()
+	}
+	return schema
+}
+
+// typeSchema returns the schema of a value type. Named structs are added to
+// the definitions and referenced.
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(MacroList{}) {
+		return map[string]any{
+			"type":          "object",
+			"propertyNames": map[string]any{"pattern": macroNameRegex.String()},
+			"additionalProperties": map[string]any{
+				"type": []string{"string", "number", "boolean"},
+			},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		if _, found := g.definitions[t.Name()]; !found {
+			g.definitions[t.Name()] = nil // recursion guard
+			g.definitions[t.Name()] = g.structSchema(t, structDefaults(t))
+		}
+		return map[string]any{"$ref": "#/definitions/" + t.Name()}
+	default:
+		panic(fmt.Sprintf("no JSON schema for type %s", t))
+	}
+}
+
+// structDefaults returns the value an empty mapping decodes to, which has the
+// defaults set by the UnmarshalYAML of the type
+func structDefaults(t reflect.Type) reflect.Value {
+	value := reflect.New(t)
+	if err := yaml.Unmarshal([]byte("{}"), value.Interface()); err != nil {
+		panic(err)
+	}
+	return value.Elem()
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var schema map[string]any
+	if !assert.NoError(t, json.Unmarshal(data, &schema)) {
+		return
+	}
+	definitions := schema["definitions"].(map[string]any)
+	property := func(object map[string]any, key string) map[string]any {
+		return object["properties"].(map[string]any)[key].(map[string]any)
+	}
+
+	// every key is documented
+	objects := map[string]map[string]any{"Config": schema}
+	for name, definition := range definitions {
+		objects[name] = definition.(map[string]any)
+	}
+	for name, object := range objects {
+		assert.Equal(t, false, object["additionalProperties"], name)
+		for key, value := range object["properties"].(map[string]any) {
+			assert.NotEmpty(t, value.(map[string]any)["description"], "%s.%s has no description", name, key)
+		}
+	}
+
+	// defaults come from the same code that sets them when loading
+	assert.Equal(t, float64(5800), property(schema, "startPort")["default"])
+	assert.Equal(t, "info", property(schema, "logLevel")["default"])
+	modelConfig := definitions["ModelConfig"].(map[string]any)
+	assert.Equal(t, "http://localhost:${PORT}", property(modelConfig, "proxy")["default"])
+	assert.Equal(t, "/health", property(modelConfig, "checkEndpoint")["default"])
+	assert.Equal(t, true, property(definitions["GroupConfig"].(map[string]any), "swap")["default"])
+	assert.Equal(t, float64(100), property(definitions["MirrorConfig"].(map[string]any), "percent")["default"])
+
+	assert.Equal(t, map[string]any{"$ref": "#/definitions/ModelConfig"}, property(schema, "models")["additionalProperties"])
+	assert.Equal(t, map[string]any{"$ref": "#/definitions/HookAction"}, property(definitions["HooksConfig"].(map[string]any), "on_idle")["items"])
+	assert.Equal(t, []any{"extract", "strip"}, property(definitions["ModelFilters"].(map[string]any), "thinkTags")["enum"])
+	assert.Equal(t, true, property(definitions["ModelFilters"].(map[string]any), "strip_params")["deprecated"])
+
+	// inlined fields of ScheduledHook
+	scheduledHook := definitions["ScheduledHook"].(map[string]any)
+	assert.Contains(t, scheduledHook["properties"], "cron")
+	assert.Contains(t, scheduledHook["properties"], "webhook")
+}
+
+func TestSchema_PublishedIsUpToDate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the default cmdStop is different on windows")
+	}
+
+	published, err := os.ReadFile("../../config-schema.json")
+	if !assert.NoError(t, err) {
+		return
+	}
+	schema, err := Schema()
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(schema), string(published), "run: go run . schema > config-schema.json")
+	}
+}
@@ -8,6 +8,8 @@ const ConfigFileChangedEventID = 0x03
 const LogDataEventID = 0x04
 const TokenMetricsEventID = 0x05
 const ModelPreloadedEventID = 0x06
+const ProcessCrashedEventID = 0x07
+const ProcessHealthCheckFailedEventID = 0x08
 
 type ProcessStateChangeEvent struct {
 	ProcessName string
@@ -58,3 +60,24 @@ type ModelPreloadedEvent struct {
 func (e ModelPreloadedEvent) Type() uint32 {
 	return ModelPreloadedEventID
 }
+
+// ProcessCrashedEvent is emitted when an upstream process exits without being stopped
+type ProcessCrashedEvent struct {
+	ProcessName string
+	ExitCode    int
+	Error       string
+}
+
+func (e ProcessCrashedEvent) Type() uint32 {
+	return ProcessCrashedEventID
+}
+
+// ProcessHealthCheckFailedEvent is emitted when a process does not pass its health check in time
+type ProcessHealthCheckFailedEvent struct {
+	ProcessName string
+	Error       string
+}
+
+func (e ProcessHealthCheckFailedEvent) Type() uint32 {
+	return ProcessHealthCheckFailedEventID
+}
@@ -0,0 +1,369 @@
+// Package gguf reads the header of GGUF model files
+package gguf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// "GGUF" in little endian
+const magic = 0x46554747
+
+// limits for corrupt or hostile files
+const (
+	maxStringLength = 64 << 20
+	maxCount        = 1 << 32
+	maxDimensions   = 8
+)
+
+// metadata value types
+const (
+	typeUint8   = 0
+	typeInt8    = 1
+	typeUint16  = 2
+	typeInt16   = 3
+	typeUint32  = 4
+	typeInt32   = 5
+	typeFloat32 = 6
+	typeBool    = 7
+	typeString  = 8
+	typeArray   = 9
+	typeUint64  = 10
+	typeInt64   = 11
+	typeFloat64 = 12
+)
+
+// fileTypes are the names of general.file_type, see llama_ftype in llama.cpp
+var fileTypes = map[uint64]string{
+	0:  "F32",
+	1:  "F16",
+	2:  "Q4_0",
+	3:  "Q4_1",
+	7:  "Q8_0",
+	8:  "Q5_0",
+	9:  "Q5_1",
+	10: "Q2_K",
+	11: "Q3_K_S",
+	12: "Q3_K_M",
+	13: "Q3_K_L",
+	14: "Q4_K_S",
+	15: "Q4_K_M",
+	16: "Q5_K_S",
+	17: "Q5_K_M",
+	18: "Q6_K",
+	19: "IQ2_XXS",
+	20: "IQ2_XS",
+	21: "Q2_K_S",
+	22: "IQ3_XS",
+	23: "IQ3_XXS",
+	24: "IQ1_S",
+	25: "IQ4_NL",
+	26: "IQ3_S",
+	27: "IQ3_M",
+	28: "IQ2_S",
+	29: "IQ2_M",
+	30: "IQ4_XS",
+	31: "IQ1_M",
+	32: "BF16",
+	36: "TQ1_0",
+	37: "TQ2_0",
+	38: "MXFP4_MOE",
+}
+
+// split GGUF files: model-00001-of-00003.gguf
+var splitRegex = regexp.MustCompile(`^(.+)-(\d{5})-of-(\d{5})\.(?i:gguf)$`)
+
+// SplitName parses the name of a file of a split model, e.g.
+// model-00001-of-00003.gguf has the base model, shard 1 and count 3
+func SplitName(path string) (base string, shard, count int, ok bool) {
+	match := splitRegex.FindStringSubmatch(path)
+	if match == nil {
+		return "", 0, 0, false
+	}
+	shard, _ = strconv.Atoi(match[2])
+	count, _ = strconv.Atoi(match[3])
+	return match[1], shard, count, true
+}
+
+// Info describes a model file
+type Info struct {
+	Architecture    string `json:"architecture"`
+	Parameters      uint64 `json:"parameters"`
+	Quantization    string `json:"quantization,omitempty"`
+	ContextLength   uint64 `json:"context_length,omitempty"`
+	HasChatTemplate bool   `json:"has_chat_template"`
+
+	// bytes, the total of all files of a split model
+	FileSize int64 `json:"file_size"`
+}
+
+// Header is the metadata and tensors of a GGUF file. Only scalar metadata
+// values are kept, arrays like the tokenizer vocabulary are skipped.
+type Header struct {
+	Version  uint32
+	Metadata map[string]any
+	Tensors  []Tensor
+}
+
+// Tensor is the description of a tensor in the header
+type Tensor struct {
+	Name       string
+	Dimensions []uint64
+	Type       uint32
+}
+
+// Elements returns the number of values in the tensor
+func (t Tensor) Elements() uint64 {
+	n := uint64(1)
+	for _, d := range t.Dimensions {
+		n *= d
+	}
+	return n
+}
+
+// ReadInfo reads the header of the GGUF file at path. The other files of a
+// split model are read for the parameter count and file size.
+func ReadInfo(path string) (Info, error) {
+	header, size, err := readFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{FileSize: size}
+	info.Architecture, _ = header.Metadata["general.architecture"].(string)
+	if fileType, ok := header.uint("general.file_type"); ok {
+		info.Quantization = fileTypes[fileType]
+	}
+	info.ContextLength, _ = header.uint(info.Architecture + ".context_length")
+	_, info.HasChatTemplate = header.Metadata["tokenizer.chat_template"]
+	for _, tensor := range header.Tensors {
+		info.Parameters += tensor.Elements()
+	}
+
+	if base, shardNumber, count, ok := SplitName(path); ok && shardNumber == 1 {
+		for i := 2; i <= count; i++ {
+			shard, size, err := readFile(fmt.Sprintf("%s-%05d-of-%05d%s", base, i, count, filepath.Ext(path)))
+			if err != nil {
+				return Info{}, err
+			}
+			info.FileSize += size
+			for _, tensor := range shard.Tensors {
+				info.Parameters += tensor.Elements()
+			}
+		}
+	}
+
+	return info, nil
+}
+
+func readFile(path string) (*Header, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header, err := ReadHeader(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return header, stat.Size(), nil
+}
+
+// ReadHeader reads the header of a GGUF file, versions 2 and 3 are supported
+func ReadHeader(r io.Reader) (*Header, error) {
+	d := &decoder{r: bufio.NewReaderSize(r, 1<<16)}
+
+	if d.uint32() != magic {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, errors.New("not a GGUF file")
+	}
+
+	header := &Header{Version: d.uint32(), Metadata: make(map[string]any)}
+	if d.err == nil && header.Version != 2 && header.Version != 3 {
+		return nil, fmt.Errorf("unsupported GGUF version %d", header.Version)
+	}
+
+	tensorCount := d.count()
+	metadataCount := d.count()
+	for i := uint64(0); i < metadataCount && d.err == nil; i++ {
+		key := d.string()
+		if value := d.value(d.uint32()); value != nil {
+			header.Metadata[key] = value
+		}
+	}
+
+	for i := uint64(0); i < tensorCount && d.err == nil; i++ {
+		tensor := Tensor{Name: d.string()}
+		dimensions := d.uint32()
+		if dimensions > maxDimensions {
+			return nil, fmt.Errorf("tensor %s has %d dimensions", tensor.Name, dimensions)
+		}
+		for j := uint32(0); j < dimensions; j++ {
+			tensor.Dimensions = append(tensor.Dimensions, d.uint64())
+		}
+		tensor.Type = d.uint32()
+		d.uint64() // offset of the data
+		header.Tensors = append(header.Tensors, tensor)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return header, nil
+}
+
+// uint returns an unsigned integer metadata value of any size
+func (h *Header) uint(key string) (uint64, bool) {
+	switch v := h.Metadata[key].(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int32:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	default:
+		return 0, false
+	}
+}
+
+// decoder reads little endian values, the first error is kept in err and
+// later reads return zero values
+type decoder struct {
+	r   *bufio.Reader
+	err error
+	buf [8]byte
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return d.buf[:n]
+	}
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		d.err = fmt.Errorf("truncated header: %v", err)
+	}
+	return d.buf[:n]
+}
+
+func (d *decoder) skip(n uint64) {
+	if d.err != nil {
+		return
+	}
+	if _, err := d.r.Discard(int(n)); err != nil {
+		d.err = fmt.Errorf("truncated header: %v", err)
+	}
+}
+
+func (d *decoder) uint32() uint32 { return binary.LittleEndian.Uint32(d.read(4)) }
+func (d *decoder) uint64() uint64 { return binary.LittleEndian.Uint64(d.read(8)) }
+
+func (d *decoder) count() uint64 {
+	n := d.uint64()
+	if n > maxCount && d.err == nil {
+		d.err = fmt.Errorf("invalid count %d", n)
+	}
+	return n
+}
+
+func (d *decoder) stringLength() uint64 {
+	n := d.uint64()
+	if n > maxStringLength && d.err == nil {
+		d.err = fmt.Errorf("invalid string length %d", n)
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.stringLength()
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.err = fmt.Errorf("truncated header: %v", err)
+	}
+	return string(buf)
+}
+
+// value reads a metadata value, arrays are skipped and returned as nil
+func (d *decoder) value(valueType uint32) any {
+	switch valueType {
+	case typeUint8:
+		return d.read(1)[0]
+	case typeInt8:
+		return int8(d.read(1)[0])
+	case typeUint16:
+		return binary.LittleEndian.Uint16(d.read(2))
+	case typeInt16:
+		return int16(binary.LittleEndian.Uint16(d.read(2)))
+	case typeUint32:
+		return d.uint32()
+	case typeInt32:
+		return int32(d.uint32())
+	case typeFloat32:
+		return math.Float32frombits(d.uint32())
+	case typeBool:
+		return d.read(1)[0] != 0
+	case typeString:
+		return d.string()
+	case typeUint64:
+		return d.uint64()
+	case typeInt64:
+		return int64(d.uint64())
+	case typeFloat64:
+		return math.Float64frombits(d.uint64())
+	case typeArray:
+		d.skipArray(d.uint32(), d.count())
+		return nil
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown metadata type %d", valueType)
+		}
+		return nil
+	}
+}
+
+func (d *decoder) skipArray(elementType uint32, count uint64) {
+	sizes := map[uint32]uint64{
+		typeUint8: 1, typeInt8: 1, typeBool: 1,
+		typeUint16: 2, typeInt16: 2,
+		typeUint32: 4, typeInt32: 4, typeFloat32: 4,
+		typeUint64: 8, typeInt64: 8, typeFloat64: 8,
+	}
+	if size, ok := sizes[elementType]; ok {
+		d.skip(count * size)
+		return
+	}
+
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		switch elementType {
+		case typeString:
+			d.skip(d.stringLength())
+		case typeArray:
+			d.skipArray(d.uint32(), d.count())
+		default:
+			d.err = fmt.Errorf("unknown array type %d", elementType)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package gguf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ggufWriter builds GGUF headers for tests
+type ggufWriter struct {
+	metadata bytes.Buffer
+	tensors  bytes.Buffer
+	kvs      uint64
+	count    uint64
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.LittleEndian, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func (w *ggufWriter) kv(key string, valueType uint32, value any) *ggufWriter {
+	writeString(&w.metadata, key)
+	binary.Write(&w.metadata, binary.LittleEndian, valueType)
+	if s, ok := value.(string); ok {
+		writeString(&w.metadata, s)
+	} else {
+		binary.Write(&w.metadata, binary.LittleEndian, value)
+	}
+	w.kvs++
+	return w
+}
+
+func (w *ggufWriter) stringArray(key string, values ...string) *ggufWriter {
+	writeString(&w.metadata, key)
+	binary.Write(&w.metadata, binary.LittleEndian, uint32(typeArray))
+	binary.Write(&w.metadata, binary.LittleEndian, uint32(typeString))
+	binary.Write(&w.metadata, binary.LittleEndian, uint64(len(values)))
+	for _, v := range values {
+		writeString(&w.metadata, v)
+	}
+	w.kvs++
+	return w
+}
+
+func (w *ggufWriter) tensor(name string, dimensions ...uint64) *ggufWriter {
+	writeString(&w.tensors, name)
+	binary.Write(&w.tensors, binary.LittleEndian, uint32(len(dimensions)))
+	binary.Write(&w.tensors, binary.LittleEndian, dimensions)
+	binary.Write(&w.tensors, binary.LittleEndian, uint32(12)) // Q4_K
+	binary.Write(&w.tensors, binary.LittleEndian, uint64(0))
+	w.count++
+	return w
+}
+
+func (w *ggufWriter) bytes() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(magic))
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	binary.Write(&buf, binary.LittleEndian, w.count)
+	binary.Write(&buf, binary.LittleEndian, w.kvs)
+	buf.Write(w.metadata.Bytes())
+	buf.Write(w.tensors.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadInfo(t *testing.T) {
+	data := (&ggufWriter{}).
+		kv("general.architecture", typeString, "qwen3").
+		kv("general.file_type", typeUint32, uint32(15)).
+		kv("qwen3.context_length", typeUint32, uint32(40960)).
+		kv("qwen3.rope.freq_base", typeFloat32, float32(1000000)).
+		stringArray("tokenizer.ggml.tokens", "a", "b", "c").
+		kv("tokenizer.chat_template", typeString, "{{ messages }}").
+		tensor("token_embd.weight", 1024, 151936).
+		tensor("output_norm.weight", 1024).
+		bytes()
+
+	path := filepath.Join(t.TempDir(), "qwen.gguf")
+	if !assert.NoError(t, os.WriteFile(path, data, 0644)) {
+		return
+	}
+
+	info, err := ReadInfo(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, Info{
+			Architecture:    "qwen3",
+			Parameters:      1024*151936 + 1024,
+			Quantization:    "Q4_K_M",
+			ContextLength:   40960,
+			HasChatTemplate: true,
+			FileSize:        int64(len(data)),
+		}, info)
+	}
+
+	header, err := ReadHeader(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(3), header.Version)
+		assert.Equal(t, float32(1000000), header.Metadata["qwen3.rope.freq_base"])
+		assert.NotContains(t, header.Metadata, "tokenizer.ggml.tokens")
+		assert.Equal(t, "output_norm.weight", header.Tensors[1].Name)
+	}
+}
+
+func TestReadInfo_Split(t *testing.T) {
+	dir := t.TempDir()
+	first := (&ggufWriter{}).
+		kv("general.architecture", typeString, "glm4moe").
+		kv("split.count", typeUint16, uint16(2)).
+		tensor("a", 10, 10).
+		bytes()
+	second := (&ggufWriter{}).tensor("b", 5).bytes()
+	os.WriteFile(filepath.Join(dir, "glm-00001-of-00002.gguf"), first, 0644)
+	os.WriteFile(filepath.Join(dir, "glm-00002-of-00002.gguf"), second, 0644)
+
+	info, err := ReadInfo(filepath.Join(dir, "glm-00001-of-00002.gguf"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(105), info.Parameters)
+		assert.Equal(t, int64(len(first)+len(second)), info.FileSize)
+		assert.False(t, info.HasChatTemplate)
+	}
+
+	// a missing shard is an error
+	os.Remove(filepath.Join(dir, "glm-00002-of-00002.gguf"))
+	_, err = ReadInfo(filepath.Join(dir, "glm-00001-of-00002.gguf"))
+	assert.Error(t, err)
+}
+
+func TestSplitName(t *testing.T) {
+	base, shard, count, ok := SplitName("/models/GLM-4.5-Q4_K_M-00002-of-00003.GGUF")
+	assert.True(t, ok)
+	assert.Equal(t, "/models/GLM-4.5-Q4_K_M", base)
+	assert.Equal(t, 2, shard)
+	assert.Equal(t, 3, count)
+
+	_, _, _, ok = SplitName("/models/qwen-00001.gguf")
+	assert.False(t, ok)
+}
+
+func TestReadHeader_Invalid(t *testing.T) {
+	_, err := ReadHeader(bytes.NewReader([]byte("not a model file")))
+	assert.EqualError(t, err, "not a GGUF file")
+
+	data := (&ggufWriter{}).kv("general.architecture", typeString, "llama").bytes()
+	_, err = ReadHeader(bytes.NewReader(data[:len(data)-2]))
+	assert.ErrorContains(t, err, "truncated header")
+
+	// huge lengths are rejected before allocating
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{magic, 3})
+	binary.Write(&buf, binary.LittleEndian, []uint64{0, 1, 1 << 40})
+	_, err = ReadHeader(&buf)
+	assert.EqualError(t, err, "invalid string length 1099511627776")
+}
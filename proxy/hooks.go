@@ -0,0 +1,297 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/event"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+const (
+	hookEventModelReady   = "model_ready"
+	hookEventModelStopped = "model_stopped"
+	hookEventIdle         = "idle"
+	hookEventCrash        = "crash"
+	hookEventSchedule     = "schedule"
+
+	// how long exec and webhook actions can run
+	hookActionTimeout = 60 * time.Second
+)
+
+// HookPayload is sent as JSON to webhooks and on stdin to exec actions
+type HookPayload struct {
+	Event       string    `json:"event"`
+	Timestamp   time.Time `json:"timestamp"`
+	Model       string    `json:"model,omitempty"`
+	ExitCode    int       `json:"exit_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	IdleSeconds int       `json:"idle_seconds,omitempty"`
+	Cron        string    `json:"cron,omitempty"`
+}
+
+// HookRunner runs the scheduled and event hooks
+type HookRunner struct {
+	hooks     config.HooksConfig
+	models    map[string]config.ModelConfig
+	schedules []config.CronSchedule
+	logger    *LogMonitor
+
+	// model actions, provided by the ProxyManager
+	preload   func(modelID string)
+	unload    func(modelID string)
+	unloadAll func()
+
+	// request activity for on_idle
+	inflight     atomic.Int64
+	lastActivity atomic.Int64 // unix nanoseconds
+	activityGen  atomic.Int64
+
+	// the activity generation each on_idle action last ran for
+	idleFired []int64
+
+	// used for testing
+	now func() time.Time
+
+	wg sync.WaitGroup
+}
+
+func NewHookRunner(conf config.Config, logger *LogMonitor) *HookRunner {
+	hr := &HookRunner{
+		hooks:     conf.Hooks,
+		models:    conf.Models,
+		logger:    logger,
+		idleFired: make([]int64, len(conf.Hooks.OnIdle)),
+		now:       time.Now,
+		preload:   func(string) {},
+		unload:    func(string) {},
+		unloadAll: func() {},
+	}
+	for i := range hr.idleFired {
+		hr.idleFired[i] = -1
+	}
+
+	// validated when the configuration is loaded
+	for _, hook := range conf.Hooks.Schedule {
+		schedule, _ := config.ParseCron(hook.Cron)
+		hr.schedules = append(hr.schedules, schedule)
+	}
+
+	hr.lastActivity.Store(hr.now().UnixNano())
+	return hr
+}
+
+// Start runs the hooks in the background until ctx is done
+func (hr *HookRunner) Start(ctx context.Context) {
+	hooks := hr.hooks
+	if len(hooks.Schedule) == 0 && len(hooks.OnModelReady) == 0 && len(hooks.OnModelStopped) == 0 &&
+		len(hooks.OnIdle) == 0 && len(hooks.OnCrash) == 0 {
+		return
+	}
+
+	cancelStateEvents := event.On(func(e ProcessStateChangeEvent) {
+		if _, found := hr.models[e.ProcessName]; !found {
+			return
+		}
+		switch {
+		case e.NewState == StateReady:
+			hr.runModelHooks(hooks.OnModelReady, HookPayload{Event: hookEventModelReady, Model: e.ProcessName})
+		case e.NewState == StateStopped && e.OldState == StateStopping:
+			hr.runModelHooks(hooks.OnModelStopped, HookPayload{Event: hookEventModelStopped, Model: e.ProcessName})
+		}
+	})
+	cancelCrashEvents := event.On(func(e ProcessCrashedEvent) {
+		if _, found := hr.models[e.ProcessName]; !found {
+			return
+		}
+		hr.runModelHooks(hooks.OnCrash, HookPayload{
+			Event:    hookEventCrash,
+			Model:    e.ProcessName,
+			ExitCode: e.ExitCode,
+			Error:    e.Error,
+		})
+	})
+
+	go func() {
+		defer cancelStateEvents()
+		defer cancelCrashEvents()
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		lastMinute := hr.now().Truncate(time.Minute)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				now := hr.now()
+				if minute := now.Truncate(time.Minute); !minute.Equal(lastMinute) {
+					lastMinute = minute
+					hr.runSchedule(minute)
+				}
+				hr.checkIdle(now)
+			}
+		}
+	}()
+}
+
+// Wait blocks until all running actions are complete
+func (hr *HookRunner) Wait() {
+	hr.wg.Wait()
+}
+
+// TrackRequest marks the start of a request, the returned func marks the end
+func (hr *HookRunner) TrackRequest() func() {
+	hr.inflight.Add(1)
+	hr.activityGen.Add(1)
+	hr.lastActivity.Store(hr.now().UnixNano())
+	return func() {
+		hr.lastActivity.Store(hr.now().UnixNano())
+		hr.inflight.Add(-1)
+	}
+}
+
+// checkIdle runs each on_idle action once per idle period
+func (hr *HookRunner) checkIdle(now time.Time) {
+	if hr.inflight.Load() > 0 {
+		return
+	}
+
+	idle := now.Sub(time.Unix(0, hr.lastActivity.Load()))
+	gen := hr.activityGen.Load()
+	for i, action := range hr.hooks.OnIdle {
+		if hr.idleFired[i] == gen || idle < time.Duration(action.After)*time.Second {
+			continue
+		}
+		hr.idleFired[i] = gen
+		hr.runAction(action, HookPayload{Event: hookEventIdle, IdleSeconds: int(idle.Seconds())})
+	}
+}
+
+// runSchedule runs the scheduled hooks matching minute
+func (hr *HookRunner) runSchedule(minute time.Time) {
+	for i, hook := range hr.hooks.Schedule {
+		if !hr.schedules[i].Matches(minute) {
+			continue
+		}
+
+		hr.logger.Infof("Running scheduled hook: %s", hook.Cron)
+		hr.wg.Add(1)
+		go func(hook config.ScheduledHook) {
+			defer hr.wg.Done()
+			if hook.UnloadAll {
+				hr.unloadAll()
+			}
+			for _, modelID := range hook.Unload {
+				hr.unload(modelID)
+			}
+			for _, modelID := range hook.Preload {
+				hr.preload(modelID)
+			}
+			if hook.Exec != "" || hook.Webhook != "" {
+				hr.runAction(hook.HookAction, HookPayload{Event: hookEventSchedule, Cron: hook.Cron})
+			}
+		}(hook)
+	}
+}
+
+func (hr *HookRunner) runModelHooks(actions []config.HookAction, payload HookPayload) {
+	for _, action := range actions {
+		if len(action.Models) > 0 && !slices.Contains(action.Models, payload.Model) {
+			continue
+		}
+		hr.runAction(action, payload)
+	}
+}
+
+// runAction runs the exec and webhook of an action in the background
+func (hr *HookRunner) runAction(action config.HookAction, payload HookPayload) {
+	payload.Timestamp = hr.now()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		hr.logger.Errorf("Failed to encode %s hook payload: %v", payload.Event, err)
+		return
+	}
+
+	hr.wg.Add(1)
+	go func() {
+		defer hr.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), hookActionTimeout)
+		defer cancel()
+
+		if action.Exec != "" {
+			env := []string{
+				"LLAMA_SWAP_EVENT=" + payload.Event,
+				"LLAMA_SWAP_MODEL=" + payload.Model,
+			}
+			if err := runHookExec(ctx, action.Exec, env, data, hr.logger); err != nil {
+				hr.logger.Errorf("Hook %s exec failed: %v", payload.Event, err)
+			}
+		}
+		if action.Webhook != "" {
+			if err := postHookWebhook(ctx, action.Webhook, data, nil); err != nil {
+				hr.logger.Errorf("Hook %s webhook failed: %v", payload.Event, err)
+			}
+		}
+	}()
+}
+
+// runHookExec runs command with data on stdin and env added to its environment
+func runHookExec(ctx context.Context, command string, env []string, data []byte, logger *LogMonitor) error {
+	args, err := config.SanitizeCommand(command)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = logger
+	cmd.Stderr = logger
+	return cmd.Run()
+}
+
+// webhookStatusError is returned when a webhook responds with a non 2xx status
+type webhookStatusError struct {
+	url        string
+	statusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("%s returned status code: %d", e.url, e.statusCode)
+}
+
+// postHookWebhook sends data as JSON to url with any extra headers
+func postHookWebhook(ctx context.Context, url string, data []byte, headers http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &webhookStatusError{url: url, statusCode: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// hookReceiver is a webhook endpoint that records the payloads it receives
+type hookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	payloads []HookPayload
+	received chan HookPayload
+}
+
+func newHookReceiver() *hookReceiver {
+	hr := &hookReceiver{received: make(chan HookPayload, 10)}
+	hr.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload HookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		hr.mu.Lock()
+		hr.payloads = append(hr.payloads, payload)
+		hr.mu.Unlock()
+		hr.received <- payload
+	}))
+	return hr
+}
+
+func (hr *hookReceiver) count() int {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	return len(hr.payloads)
+}
+
+func (hr *hookReceiver) wait(t *testing.T) HookPayload {
+	t.Helper()
+	select {
+	case payload := <-hr.received:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+		return HookPayload{}
+	}
+}
+
+func TestHookRunner_ModelReadyWebhook(t *testing.T) {
+	receiver := newHookReceiver()
+	defer receiver.Close()
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+			"model2": getTestSimpleResponderConfig("model2"),
+		},
+		Hooks: config.HooksConfig{
+			OnModelReady: []config.HookAction{
+				{Webhook: receiver.URL, Models: []string{"model2"}},
+			},
+		},
+	})
+	proxy := New(config)
+	t.Cleanup(proxy.Shutdown)
+
+	for _, model := range []string{"model1", "model2"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"`+model+`"}`))
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// model1 is filtered out by models
+	payload := receiver.wait(t)
+	assert.Equal(t, hookEventModelReady, payload.Event)
+	assert.Equal(t, "model2", payload.Model)
+	assert.False(t, payload.Timestamp.IsZero())
+
+	proxy.hookRunner.Wait()
+	assert.Equal(t, 1, receiver.count())
+}
+
+func TestHookRunner_Schedule(t *testing.T) {
+	receiver := newHookReceiver()
+	defer receiver.Close()
+
+	conf := config.Config{
+		Hooks: config.HooksConfig{
+			Schedule: []config.ScheduledHook{
+				{Cron: "0 8 * * 1-5", Preload: []string{"model1"}},
+				{Cron: "0 20 * * *", UnloadAll: true, HookAction: config.HookAction{Webhook: receiver.URL}},
+				{Cron: "0 1 * * *", Unload: []string{"model1"}, Preload: []string{"nightly"}},
+			},
+		},
+	}
+
+	var mu sync.Mutex
+	var actions []string
+	record := func(action string) {
+		mu.Lock()
+		defer mu.Unlock()
+		actions = append(actions, action)
+	}
+
+	hr := NewHookRunner(conf, testLogger)
+	hr.preload = func(modelID string) { record("preload " + modelID) }
+	hr.unload = func(modelID string) { record("unload " + modelID) }
+	hr.unloadAll = func() { record("unloadAll") }
+
+	// Monday
+	hr.runSchedule(time.Date(2025, 6, 2, 8, 0, 0, 0, time.Local))
+	hr.Wait()
+	assert.Equal(t, []string{"preload model1"}, actions)
+
+	// Saturday
+	actions = nil
+	hr.runSchedule(time.Date(2025, 6, 7, 8, 0, 0, 0, time.Local))
+	hr.Wait()
+	assert.Empty(t, actions)
+
+	hr.runSchedule(time.Date(2025, 6, 7, 1, 0, 0, 0, time.Local))
+	hr.Wait()
+	assert.Equal(t, []string{"unload model1", "preload nightly"}, actions)
+
+	actions = nil
+	hr.runSchedule(time.Date(2025, 6, 7, 20, 0, 0, 0, time.Local))
+	hr.Wait()
+	assert.Equal(t, []string{"unloadAll"}, actions)
+	payload := receiver.wait(t)
+	assert.Equal(t, hookEventSchedule, payload.Event)
+	assert.Equal(t, "0 20 * * *", payload.Cron)
+}
+
+func TestHookRunner_Idle(t *testing.T) {
+	receiver := newHookReceiver()
+	defer receiver.Close()
+
+	conf := config.Config{
+		Hooks: config.HooksConfig{
+			OnIdle: []config.HookAction{{Webhook: receiver.URL, After: 60}},
+		},
+	}
+
+	now := time.Date(2025, 6, 2, 8, 0, 0, 0, time.Local)
+	hr := NewHookRunner(conf, testLogger)
+	hr.now = func() time.Time { return now }
+
+	done := hr.TrackRequest()
+	now = now.Add(2 * time.Minute)
+
+	// not idle while a request is in flight
+	hr.checkIdle(now)
+	done()
+	hr.checkIdle(now.Add(59 * time.Second))
+	hr.Wait()
+	assert.Equal(t, 0, receiver.count())
+
+	// runs once per idle period
+	hr.checkIdle(now.Add(60 * time.Second))
+	hr.checkIdle(now.Add(120 * time.Second))
+	hr.Wait()
+	payload := receiver.wait(t)
+	assert.Equal(t, hookEventIdle, payload.Event)
+	assert.Equal(t, 60, payload.IdleSeconds)
+	assert.Equal(t, 1, receiver.count())
+
+	// and again after new activity
+	hr.TrackRequest()()
+	hr.checkIdle(now.Add(60 * time.Second))
+	hr.Wait()
+	receiver.wait(t)
+	assert.Equal(t, 2, receiver.count())
+}
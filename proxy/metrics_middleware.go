@@ -15,6 +15,15 @@ import (
 type MetricsRecorder struct {
 	metricsMonitor *MetricsMonitor
 	realModelName  string
+
+	// token usage is counted against the client's rate limits
+	rateLimiter *RateLimiter
+	clientID    string
+
+	// token usage is attributed to the user for accounting
+	usageTracker *UsageTracker
+	user         string
+
 	//	isStreaming    bool
 	startTime time.Time
 }
@@ -38,6 +47,14 @@ func MetricsMiddleware(pm *ProxyManager) gin.HandlerFunc {
 		}
 
 		realModelName, found := pm.config.RealModelName(requestedModel)
+		if !found {
+			// routed requests are recorded against the model chosen by the handler
+			if routerID, _, isRouter := pm.config.FindRouter(requestedModel); isRouter {
+				realModelName, found = routerID, true
+			} else if pm.findPeer(c.Request, requestedModel) != nil {
+				realModelName, found = requestedModel, true
+			}
+		}
 		if !found {
 			pm.sendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("could not find real modelID for %s", requestedModel))
 			c.Abort()
@@ -49,12 +66,20 @@ func MetricsMiddleware(pm *ProxyManager) gin.HandlerFunc {
 			metricsRecorder: &MetricsRecorder{
 				metricsMonitor: pm.metricsMonitor,
 				realModelName:  realModelName,
+				rateLimiter:    pm.rateLimiter,
+				clientID:       c.GetString(ctxKeyClientID),
+				usageTracker:   pm.usageTracker,
+				user:           requestIdentity(c, pm.config.Usage.KeyBy),
 				startTime:      time.Now(),
 			},
 		}
 		c.Writer = writer
 		c.Next()
 
+		if routedModel := c.GetString(ctxKeyRoutedModel); routedModel != "" {
+			writer.metricsRecorder.realModelName = routedModel
+		}
+
 		// check for streaming response
 		if strings.Contains(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
 			writer.metricsRecorder.processStreamingResponse(writer.body)
@@ -99,16 +124,26 @@ func (rec *MetricsRecorder) parseAndRecordMetrics(jsonData gjson.Result) bool {
 		}
 	}
 
-	rec.metricsMonitor.addMetrics(TokenMetrics{
+	metric := TokenMetrics{
 		Timestamp:       time.Now(),
 		Model:           rec.realModelName,
+		User:            rec.user,
 		CachedTokens:    cachedTokens,
 		InputTokens:     inputTokens,
 		OutputTokens:    outputTokens,
 		PromptPerSecond: promptPerSecond,
 		TokensPerSecond: tokensPerSecond,
 		DurationMs:      durationMs,
-	})
+	}
+	rec.metricsMonitor.addMetrics(metric)
+
+	if rec.usageTracker != nil {
+		rec.usageTracker.Add(metric)
+	}
+
+	if rec.rateLimiter != nil {
+		rec.rateLimiter.AddTokens(rec.clientID, inputTokens+outputTokens)
+	}
 
 	return true
 }
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/gguf"
+)
+
+// ModelInfoCache keeps the GGUF header information of model files. A file is
+// read again when its size or modification time changes, failures are cached
+// the same way so broken files are not read on every request.
+type ModelInfoCache struct {
+	sync.Mutex
+	entries map[string]modelInfoEntry
+}
+
+type modelInfoEntry struct {
+	size    int64
+	modTime time.Time
+	info    *gguf.Info
+}
+
+func NewModelInfoCache() *ModelInfoCache {
+	return &ModelInfoCache{entries: make(map[string]modelInfoEntry)}
+}
+
+// Get returns the information of the GGUF file at path, nil when the file does
+// not exist or cannot be read. The read error is only returned once.
+func (c *ModelInfoCache) Get(path string) (*gguf.Info, error) {
+	if path == "" || !strings.HasSuffix(strings.ToLower(path), ".gguf") {
+		return nil, nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, nil
+	}
+
+	c.Lock()
+	entry, found := c.entries[path]
+	c.Unlock()
+	if found && entry.size == stat.Size() && entry.modTime.Equal(stat.ModTime()) {
+		return entry.info, nil
+	}
+
+	// read without the lock, a slow disk must not block requests for other files
+	entry = modelInfoEntry{size: stat.Size(), modTime: stat.ModTime()}
+	info, err := gguf.ReadInfo(path)
+	if err == nil {
+		entry.info = &info
+	}
+
+	c.Lock()
+	c.entries[path] = entry
+	c.Unlock()
+	return entry.info, err
+}
@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/event"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+const (
+	// headers sent with notification webhooks
+	headerNotificationEvent     = "X-Llama-Swap-Event"
+	headerNotificationSignature = "X-Llama-Swap-Signature"
+
+	// first wait before retrying a webhook, doubled for each retry
+	notificationRetryDelay = time.Second
+
+	// how long a single webhook or exec delivery can take
+	notificationTimeout = 30 * time.Second
+)
+
+// NotificationPayload is the JSON body sent to notification webhooks
+type NotificationPayload struct {
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	Model     string    `json:"model,omitempty"`
+
+	// process_state_changed
+	OldState string `json:"old_state,omitempty"`
+	NewState string `json:"new_state,omitempty"`
+
+	// model_preloaded
+	Success *bool `json:"success,omitempty"`
+
+	// config_changed: "start" or "end" of the reload
+	Reloading string `json:"reloading,omitempty"`
+
+	// process_crashed and health_check_failed
+	ExitCode int    `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// env returns the payload as environment variables for exec notifications
+func (p NotificationPayload) env(data []byte) []string {
+	env := []string{
+		"LLAMA_SWAP_EVENT=" + p.Event,
+		"LLAMA_SWAP_TIMESTAMP=" + p.Timestamp.Format(time.RFC3339),
+		"LLAMA_SWAP_MODEL=" + p.Model,
+		"LLAMA_SWAP_PAYLOAD=" + string(data),
+	}
+	if p.OldState != "" || p.NewState != "" {
+		env = append(env, "LLAMA_SWAP_OLD_STATE="+p.OldState, "LLAMA_SWAP_NEW_STATE="+p.NewState)
+	}
+	if p.Success != nil {
+		env = append(env, "LLAMA_SWAP_SUCCESS="+strconv.FormatBool(*p.Success))
+	}
+	if p.Reloading != "" {
+		env = append(env, "LLAMA_SWAP_RELOADING="+p.Reloading)
+	}
+	if p.Event == config.NotifyProcessCrashed {
+		env = append(env, "LLAMA_SWAP_EXIT_CODE="+strconv.Itoa(p.ExitCode))
+	}
+	if p.Error != "" {
+		env = append(env, "LLAMA_SWAP_ERROR="+p.Error)
+	}
+	return env
+}
+
+// signPayload returns the HMAC-SHA256 signature of data as "sha256=<hex>"
+func signPayload(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier delivers lifecycle events to the configured webhooks and commands
+type Notifier struct {
+	notifications []config.NotificationConfig
+	modelIDs      map[string]bool
+	logger        *LogMonitor
+
+	retryDelay time.Duration
+
+	wg sync.WaitGroup
+}
+
+func NewNotifier(conf config.Config, logger *LogMonitor) *Notifier {
+	n := &Notifier{
+		notifications: conf.Notifications,
+		modelIDs:      make(map[string]bool, len(conf.Models)),
+		logger:        logger,
+		retryDelay:    notificationRetryDelay,
+	}
+	for modelID := range conf.Models {
+		n.modelIDs[modelID] = true
+	}
+	return n
+}
+
+// Start delivers events in the background until ctx is done. Deliveries
+// already in progress are completed.
+func (n *Notifier) Start(ctx context.Context) {
+	if len(n.notifications) == 0 {
+		return
+	}
+
+	cancels := []context.CancelFunc{
+		event.On(func(e ProcessStateChangeEvent) {
+			n.notifyModel(NotificationPayload{
+				Event:    config.NotifyProcessStateChanged,
+				Model:    e.ProcessName,
+				OldState: string(e.OldState),
+				NewState: string(e.NewState),
+			})
+		}),
+		event.On(func(e ModelPreloadedEvent) {
+			success := e.Success
+			n.notifyModel(NotificationPayload{
+				Event:   config.NotifyModelPreloaded,
+				Model:   e.ModelName,
+				Success: &success,
+			})
+		}),
+		event.On(func(e ProcessCrashedEvent) {
+			n.notifyModel(NotificationPayload{
+				Event:    config.NotifyProcessCrashed,
+				Model:    e.ProcessName,
+				ExitCode: e.ExitCode,
+				Error:    e.Error,
+			})
+		}),
+		event.On(func(e ProcessHealthCheckFailedEvent) {
+			n.notifyModel(NotificationPayload{
+				Event: config.NotifyHealthCheckFailed,
+				Model: e.ProcessName,
+				Error: e.Error,
+			})
+		}),
+		event.On(func(e ConfigFileChangedEvent) {
+			reloading := "start"
+			if e.ReloadingState == ReloadingStateEnd {
+				reloading = "end"
+			}
+			n.notify(NotificationPayload{
+				Event:     config.NotifyConfigChanged,
+				Reloading: reloading,
+			})
+		}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+}
+
+// Wait blocks until all deliveries in progress are complete
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// notifyModel ignores events of processes not in this configuration
+func (n *Notifier) notifyModel(payload NotificationPayload) {
+	if n.modelIDs[payload.Model] {
+		n.notify(payload)
+	}
+}
+
+func (n *Notifier) notify(payload NotificationPayload) {
+	payload.Timestamp = time.Now()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		n.logger.Errorf("Failed to encode %s notification: %v", payload.Event, err)
+		return
+	}
+
+	for _, notification := range n.notifications {
+		if !notification.Wants(payload.Event, payload.Model) {
+			continue
+		}
+
+		n.wg.Add(1)
+		go func(notification config.NotificationConfig) {
+			defer n.wg.Done()
+			if notification.Webhook != "" {
+				if err := n.sendWebhook(notification, payload.Event, data); err != nil {
+					n.logger.Errorf("Notification %s to %s failed: %v", payload.Event, notification.Webhook, err)
+				}
+			}
+			if notification.Exec != "" {
+				ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+				defer cancel()
+				if err := runHookExec(ctx, notification.Exec, payload.env(data), data, n.logger); err != nil {
+					n.logger.Errorf("Notification %s exec failed: %v", payload.Event, err)
+				}
+			}
+		}(notification)
+	}
+}
+
+// sendWebhook posts data, retrying with exponential backoff on network errors,
+// 429 and 5xx responses
+func (n *Notifier) sendWebhook(notification config.NotificationConfig, eventName string, data []byte) error {
+	headers := make(http.Header)
+	for name, value := range notification.Headers {
+		headers.Set(name, value)
+	}
+	headers.Set(headerNotificationEvent, eventName)
+	if notification.Secret != "" {
+		headers.Set(headerNotificationSignature, signPayload(notification.Secret, data))
+	}
+
+	delay := n.retryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		err := postHookWebhook(ctx, notification.Webhook, data, headers)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *webhookStatusError
+		retryable := !errors.As(err, &statusErr) ||
+			statusErr.statusCode == http.StatusTooManyRequests || statusErr.statusCode >= 500
+		if !retryable || attempt >= notification.Retries {
+			return err
+		}
+
+		n.logger.Debugf("Notification %s to %s failed, retrying in %v: %v", eventName, notification.Webhook, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/event"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier_SignedWebhook(t *testing.T) {
+	type delivery struct {
+		payload  NotificationPayload
+		signedOK bool
+		event    string
+		auth     string
+	}
+	received := make(chan delivery, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload NotificationPayload
+		json.Unmarshal(body, &payload)
+
+		// the signature is of the exact body
+		signedOK := r.Header.Get(headerNotificationSignature) == signPayload("s3cret", body)
+		received <- delivery{payload, signedOK, r.Header.Get(headerNotificationEvent), r.Header.Get("Authorization")}
+	}))
+	defer server.Close()
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+		Notifications: []config.NotificationConfig{{
+			Webhook: server.URL,
+			Secret:  "s3cret",
+			Headers: map[string]string{"Authorization": "Bearer token"},
+			Events:  []string{"process_state_changed"},
+			Retries: 0, // stop events can be sent after the server is closed
+		}},
+	})
+	proxy := New(config)
+	t.Cleanup(proxy.Shutdown)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// deliveries are concurrent, collect both state changes
+	states := map[string]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case d := <-received:
+			assert.True(t, d.signedOK)
+			assert.Equal(t, "process_state_changed", d.event)
+			assert.Equal(t, "Bearer token", d.auth)
+			assert.Equal(t, "model1", d.payload.Model)
+			states[d.payload.NewState] = d.payload.OldState
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for notification")
+		}
+	}
+	assert.Equal(t, map[string]string{"starting": "stopped", "ready": "starting"}, states)
+}
+
+func TestNotifier_WebhookRetry(t *testing.T) {
+	var mu sync.Mutex
+	statusCodes := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(statusCodes[min(attempts, len(statusCodes)-1)])
+		attempts++
+	}))
+	defer server.Close()
+
+	getAttempts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+
+	conf := config.Config{
+		Models: map[string]config.ModelConfig{"model1": {}},
+		Notifications: []config.NotificationConfig{
+			{Webhook: server.URL, Retries: 3},
+		},
+	}
+	n := NewNotifier(conf, testLogger)
+	n.retryDelay = time.Millisecond
+
+	n.notify(NotificationPayload{Event: config.NotifyConfigChanged, Reloading: "end"})
+	n.Wait()
+	assert.Equal(t, 3, getAttempts())
+
+	// client errors are not retried
+	statusCodes = []int{http.StatusBadRequest}
+	attempts = 0
+	n.notify(NotificationPayload{Event: config.NotifyConfigChanged, Reloading: "end"})
+	n.Wait()
+	assert.Equal(t, 1, getAttempts())
+
+	// retries are limited
+	statusCodes = []int{http.StatusInternalServerError}
+	attempts = 0
+	n.notifications[0].Retries = 2
+	n.notify(NotificationPayload{Event: config.NotifyConfigChanged, Reloading: "end"})
+	n.Wait()
+	assert.Equal(t, 3, getAttempts())
+}
+
+func TestNotifier_Events(t *testing.T) {
+	received := make(chan NotificationPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload NotificationPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	conf := config.Config{
+		Models: map[string]config.ModelConfig{"notify-model": {}},
+		Notifications: []config.NotificationConfig{{
+			Webhook: server.URL,
+			Events:  []string{"model_preloaded", "process_crashed", "health_check_failed", "config_changed"},
+		}},
+	}
+	n := NewNotifier(conf, testLogger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n.Start(ctx)
+
+	wait := func() NotificationPayload {
+		t.Helper()
+		select {
+		case payload := <-received:
+			return payload
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for notification")
+			return NotificationPayload{}
+		}
+	}
+
+	event.Emit(ModelPreloadedEvent{ModelName: "notify-model", Success: false})
+	payload := wait()
+	if assert.NotNil(t, payload.Success) {
+		assert.False(t, *payload.Success)
+	}
+
+	// events of other models are ignored
+	event.Emit(ProcessCrashedEvent{ProcessName: "other-model"})
+
+	event.Emit(ProcessCrashedEvent{ProcessName: "notify-model", ExitCode: 2, Error: "exit status 2"})
+	payload = wait()
+	assert.Equal(t, "process_crashed", payload.Event)
+	assert.Equal(t, "notify-model", payload.Model)
+	assert.Equal(t, 2, payload.ExitCode)
+
+	event.Emit(ProcessHealthCheckFailedEvent{ProcessName: "notify-model", Error: "health check timed out after 5s"})
+	payload = wait()
+	assert.Equal(t, "health_check_failed", payload.Event)
+	assert.Equal(t, "health check timed out after 5s", payload.Error)
+
+	event.Emit(ConfigFileChangedEvent{ReloadingState: ReloadingStateStart})
+	payload = wait()
+	assert.Equal(t, "config_changed", payload.Event)
+	assert.Equal(t, "start", payload.Reloading)
+
+	// not in the events list
+	event.Emit(ProcessStateChangeEvent{ProcessName: "notify-model", OldState: StateStopped, NewState: StateStarting})
+	n.Wait()
+	assert.Empty(t, received)
+}
+
+func TestNotificationPayload_Env(t *testing.T) {
+	success := true
+	payload := NotificationPayload{
+		Event:     config.NotifyModelPreloaded,
+		Timestamp: time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC),
+		Model:     "model1",
+		Success:   &success,
+	}
+	assert.Equal(t, []string{
+		"LLAMA_SWAP_EVENT=model_preloaded",
+		"LLAMA_SWAP_TIMESTAMP=2025-06-02T08:00:00Z",
+		"LLAMA_SWAP_MODEL=model1",
+		"LLAMA_SWAP_PAYLOAD={}",
+		"LLAMA_SWAP_SUCCESS=true",
+	}, payload.env([]byte("{}")))
+}
@@ -0,0 +1,434 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+const (
+	// set on requests between llama-swap instances. Requests with this header
+	// are never forwarded again and only see the instance's own models.
+	headerPeerRequest = "X-Llama-Swap-Peer"
+
+	// how often peer model lists are refreshed
+	peerRefreshInterval = 30 * time.Second
+
+	// wait before reconnecting to a peer's event stream
+	peerReconnectDelay = 5 * time.Second
+)
+
+// isPeerRequest returns true for requests sent by another llama-swap instance
+func isPeerRequest(r *http.Request) bool {
+	return r.Header.Get(headerPeerRequest) != ""
+}
+
+// PeerStatus is the state of a peer as seen by this instance
+type PeerStatus struct {
+	ID       string    `json:"id"`
+	URL      string    `json:"url"`
+	Healthy  bool      `json:"healthy"`
+	Models   []string  `json:"models"`
+	Running  []string  `json:"running"`
+	LastSeen time.Time `json:"last_seen"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Peer tracks the models of another llama-swap instance. The model list comes
+// from its /v1/models, running models from /running and live updates from the
+// modelStatus messages in /api/events.
+type Peer struct {
+	id      string
+	config  config.PeerConfig
+	baseURL *url.URL
+	logger  *LogMonitor
+
+	client *http.Client
+
+	mu        sync.RWMutex
+	healthy   bool
+	models    []map[string]any // records from the peer's /v1/models
+	modelIDs  map[string]bool
+	running   map[string]bool
+	lastSeen  time.Time
+	lastError string
+
+	refreshNow chan struct{}
+}
+
+func newPeer(id string, peerConfig config.PeerConfig, logger *LogMonitor) *Peer {
+	// validated when the configuration is loaded
+	baseURL, _ := url.Parse(strings.TrimSuffix(peerConfig.URL, "/"))
+
+	return &Peer{
+		id:         id,
+		config:     peerConfig,
+		baseURL:    baseURL,
+		logger:     logger,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		modelIDs:   make(map[string]bool),
+		running:    make(map[string]bool),
+		refreshNow: make(chan struct{}, 1),
+	}
+}
+
+func (p *Peer) setHeaders(header http.Header) {
+	header.Set(headerPeerRequest, "1")
+	for name, value := range p.config.Headers {
+		header.Set(name, value)
+	}
+}
+
+// ProxyRequest sends the request to the peer as is and streams back the response
+func (p *Peer) ProxyRequest(w http.ResponseWriter, r *http.Request) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, p.baseURL.String()+r.URL.String(), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header = r.Header.Clone()
+	req.ContentLength = r.ContentLength
+	p.setHeaders(req.Header)
+
+	// no timeout, responses can be streamed for a long time
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		p.logger.Errorf("<peer:%s> error proxying %s: %v", p.id, r.URL.Path, err)
+		http.Error(w, fmt.Sprintf("error proxying request to peer %s: %s", p.id, err.Error()), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				p.logger.Errorf("<peer:%s> error reading response for %s: %v", p.id, r.URL.Path, err)
+			}
+			return
+		}
+	}
+}
+
+func (p *Peer) hasModel(modelID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.healthy && p.modelIDs[modelID]
+}
+
+func (p *Peer) isRunning(modelID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.running[modelID]
+}
+
+func (p *Peer) getJSON(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL.String()+path, nil)
+	if err != nil {
+		return err
+	}
+	p.setHeaders(req.Header)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status code: %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// refresh fetches the peer's models and running models
+func (p *Peer) refresh(ctx context.Context) error {
+	var models struct {
+		Data []map[string]any `json:"data"`
+	}
+	var running struct {
+		Running []struct {
+			Model string `json:"model"`
+		} `json:"running"`
+	}
+
+	err := p.getJSON(ctx, "/v1/models", &models)
+	if err == nil {
+		err = p.getJSON(ctx, "/running", &running)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		if p.healthy || p.lastError == "" {
+			p.logger.Warnf("<peer:%s> unavailable: %v", p.id, err)
+		}
+		p.healthy = false
+		p.lastError = err.Error()
+		return err
+	}
+
+	if !p.healthy {
+		p.logger.Infof("<peer:%s> available with %d models", p.id, len(models.Data))
+	}
+
+	p.healthy = true
+	p.lastError = ""
+	p.lastSeen = time.Now()
+	p.models = models.Data
+	p.modelIDs = make(map[string]bool, len(models.Data))
+	for _, record := range models.Data {
+		if id, ok := record["id"].(string); ok {
+			p.modelIDs[id] = true
+		}
+	}
+	p.running = make(map[string]bool, len(running.Running))
+	for _, r := range running.Running {
+		p.running[r.Model] = true
+	}
+	return nil
+}
+
+// updateModelStatus applies a modelStatus message from the peer's event stream
+func (p *Peer) updateModelStatus(models []Model) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastSeen = time.Now()
+	p.running = make(map[string]bool)
+	listChanged := false
+	for _, model := range models {
+		if model.State == "ready" {
+			p.running[model.Id] = true
+		}
+		if !model.Unlisted && !p.modelIDs[model.Id] {
+			listChanged = true
+		}
+	}
+
+	// the peer's configuration changed, get the new model list
+	if listChanged {
+		select {
+		case p.refreshNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watchEvents reads the peer's event stream until it disconnects
+func (p *Peer) watchEvents(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL.String()+"/api/events", nil)
+	if err != nil {
+		return err
+	}
+	p.setHeaders(req.Header)
+
+	// no timeout, the stream stays open
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("/api/events returned status code: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// log history is sent in a single message
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data:")
+		if !found {
+			continue
+		}
+
+		var envelope messageEnvelope
+		if err := json.Unmarshal([]byte(data), &envelope); err != nil || envelope.Type != msgTypeModelStatus {
+			continue
+		}
+
+		var models []Model
+		if err := json.Unmarshal([]byte(envelope.Data), &models); err == nil {
+			p.updateModelStatus(models)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("event stream closed")
+}
+
+func (p *Peer) pollLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.refreshNow:
+		}
+	}
+}
+
+func (p *Peer) eventLoop(ctx context.Context, reconnectDelay time.Duration) {
+	for {
+		err := p.watchEvents(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		p.logger.Debugf("<peer:%s> event stream disconnected: %v", p.id, err)
+
+		// a disconnect usually means the peer went away
+		select {
+		case p.refreshNow <- struct{}{}:
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (p *Peer) status() PeerStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	status := PeerStatus{
+		ID:       p.id,
+		URL:      p.config.URL,
+		Healthy:  p.healthy,
+		Models:   make([]string, 0, len(p.modelIDs)),
+		Running:  make([]string, 0, len(p.running)),
+		LastSeen: p.lastSeen,
+		Error:    p.lastError,
+	}
+	for id := range p.modelIDs {
+		status.Models = append(status.Models, id)
+	}
+	for id := range p.running {
+		status.Running = append(status.Running, id)
+	}
+	sort.Strings(status.Models)
+	sort.Strings(status.Running)
+	return status
+}
+
+// PeerManager tracks the configured peers and finds the peer serving a model
+type PeerManager struct {
+	peers []*Peer // sorted by ID
+
+	refreshInterval time.Duration
+	reconnectDelay  time.Duration
+}
+
+func NewPeerManager(peers map[string]config.PeerConfig, logger *LogMonitor) *PeerManager {
+	pm := &PeerManager{
+		refreshInterval: peerRefreshInterval,
+		reconnectDelay:  peerReconnectDelay,
+	}
+	for id, peerConfig := range peers {
+		pm.peers = append(pm.peers, newPeer(id, peerConfig, logger))
+	}
+	sort.Slice(pm.peers, func(i, j int) bool {
+		return pm.peers[i].id < pm.peers[j].id
+	})
+	return pm
+}
+
+// Start tracks the peers in the background until ctx is done
+func (m *PeerManager) Start(ctx context.Context) {
+	for _, peer := range m.peers {
+		go peer.pollLoop(ctx, m.refreshInterval)
+		go peer.eventLoop(ctx, m.reconnectDelay)
+	}
+}
+
+// FindPeer returns a healthy peer with the model, preferring one where the
+// model is already running. It returns nil when no peer has the model.
+func (m *PeerManager) FindPeer(modelID string) *Peer {
+	var found *Peer
+	for _, peer := range m.peers {
+		if !peer.hasModel(modelID) {
+			continue
+		}
+		if peer.isRunning(modelID) {
+			return peer
+		}
+		if found == nil {
+			found = peer
+		}
+	}
+	return found
+}
+
+// ListModels returns the /v1/models records of healthy peers. Models in exclude
+// and models already listed by an earlier peer are left out.
+func (m *PeerManager) ListModels(exclude map[string]bool) []map[string]any {
+	seen := make(map[string]bool)
+	records := make([]map[string]any, 0)
+	for _, peer := range m.peers {
+		peer.mu.RLock()
+		if peer.healthy {
+			for _, record := range peer.models {
+				id, _ := record["id"].(string)
+				if id == "" || exclude[id] || seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				copied := make(map[string]any, len(record)+1)
+				for k, v := range record {
+					copied[k] = v
+				}
+				copied["peer"] = peer.id
+				records = append(records, copied)
+			}
+		}
+		peer.mu.RUnlock()
+	}
+	return records
+}
+
+// Status returns the state of all peers
+func (m *PeerManager) Status() []PeerStatus {
+	status := make([]PeerStatus, 0, len(m.peers))
+	for _, peer := range m.peers {
+		status = append(status, peer.status())
+	}
+	return status
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestProxyManager_Peers(t *testing.T) {
+	// the instances are peers of each other to check requests are not looped
+	serverA := httptest.NewUnstartedServer(nil)
+	defer serverA.Close()
+	serverB := httptest.NewUnstartedServer(nil)
+	defer serverB.Close()
+
+	proxyA := New(config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"modelA": getTestSimpleResponderConfig("modelA"),
+		},
+		Peers: map[string]config.PeerConfig{
+			"b": {URL: "http://" + serverB.Listener.Addr().String()},
+		},
+	}))
+	defer proxyA.Shutdown()
+
+	proxyB := New(config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"modelB": getTestSimpleResponderConfig("modelB"),
+		},
+		Peers: map[string]config.PeerConfig{
+			"a": {URL: "http://" + serverA.Listener.Addr().String()},
+		},
+	}))
+	defer proxyB.Shutdown()
+
+	serverA.Config.Handler = proxyA
+	serverA.Start()
+	serverB.Config.Handler = proxyB
+	serverB.Start()
+
+	if !assert.Eventually(t, func() bool {
+		return proxyA.peerManager.FindPeer("modelB") != nil && proxyB.peerManager.FindPeer("modelA") != nil
+	}, 5*time.Second, 20*time.Millisecond) {
+		return
+	}
+
+	// peer models are merged into /v1/models
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	w := httptest.NewRecorder()
+	proxyA.ServeHTTP(w, req)
+	assert.Equal(t, `["modelA","modelB"]`, gjson.Get(w.Body.String(), "data.#.id").Raw)
+	assert.Equal(t, "b", gjson.Get(w.Body.String(), `data.#(id=="modelB").peer`).String())
+
+	// requests for peer models are proxied
+	req = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"modelB"}`))
+	w = httptest.NewRecorder()
+	proxyA.ServeHTTP(w, req)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, "modelB", gjson.Get(w.Body.String(), "responseMessage").String())
+	}
+
+	// including streaming responses
+	req = httptest.NewRequest("POST", "/v1/chat/completions?stream=true", bytes.NewBufferString(`{"model":"modelB"}`))
+	w = httptest.NewRecorder()
+	proxyA.ServeHTTP(w, req)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/event-stream")
+		assert.Contains(t, w.Body.String(), "asdf")
+		assert.Contains(t, w.Body.String(), "[DONE]")
+	}
+
+	// metrics are recorded for proxied requests
+	metrics := proxyA.metricsMonitor.GetMetrics()
+	if assert.Len(t, metrics, 2) {
+		assert.Equal(t, "modelB", metrics[0].Model)
+	}
+
+	// running models are tracked through the peer's event stream
+	assert.Eventually(t, func() bool {
+		for _, status := range proxyA.peerManager.Status() {
+			if status.ID == "b" && slices.Contains(status.Running, "modelB") {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// requests from peers are never forwarded again
+	req = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"modelB"}`))
+	req.Header.Set(headerPeerRequest, "1")
+	w = httptest.NewRecorder()
+	proxyA.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(headerPeerRequest, "1")
+	w = httptest.NewRecorder()
+	proxyA.ServeHTTP(w, req)
+	assert.Equal(t, `["modelA"]`, gjson.Get(w.Body.String(), "data.#.id").Raw)
+
+	req = httptest.NewRequest("GET", "/api/peers", nil)
+	w = httptest.NewRecorder()
+	proxyA.ServeHTTP(w, req)
+	assert.Equal(t, `[true]`, gjson.Get(w.Body.String(), "peers.#.healthy").Raw)
+}
+
+func TestPeerManager_UnavailablePeer(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	peerManager := NewPeerManager(map[string]config.PeerConfig{"gone": {URL: server.URL}}, debugLogger)
+	peer := peerManager.peers[0]
+	assert.Error(t, peer.refresh(context.Background()))
+	assert.Nil(t, peerManager.FindPeer("model1"))
+
+	status := peerManager.Status()
+	if assert.Len(t, status, 1) {
+		assert.False(t, status[0].Healthy)
+		assert.NotEmpty(t, status[0].Error)
+	}
+}
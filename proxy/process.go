@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -46,6 +47,9 @@ type Process struct {
 	// PR #155 called to cancel the upstream process
 	cancelUpstream context.CancelFunc
 
+	// done once cancelUpstream is called, used to tell a stop from a crash
+	upstreamCtx context.Context
+
 	// closed when command exits
 	cmdWaitChan chan struct{}
 
@@ -73,6 +77,16 @@ type Process struct {
 
 	// track the number of failed starts
 	failedStartCount int
+
+	// pid of the running upstream process, guarded by stateMutex
+	upstreamPID int
+
+	// when set, upstream output is written to this file and tailed into
+	// processLogger, see adopt()
+	logFile string
+
+	// parent of the cgroup created for resources limits
+	cgroupRoot string
 }
 
 func NewProcess(ID string, healthCheckTimeout int, config config.ModelConfig, processLogger *LogMonitor, proxyLogger *LogMonitor) *Process {
@@ -167,9 +181,16 @@ func (p *Process) start() error {
 		return fmt.Errorf("can not start(), upstream proxy missing")
 	}
 
-	args, err := p.config.SanitizedCommand()
-	if err != nil {
-		return fmt.Errorf("unable to get sanitized command: %v", err)
+	// remote models have no command, they are ready once the health check passes
+	remote := p.config.IsRemote()
+
+	var args []string
+	if !remote {
+		var err error
+		args, err = p.config.SanitizedCommand()
+		if err != nil {
+			return fmt.Errorf("unable to get sanitized command: %v", err)
+		}
 	}
 
 	if curState, err := p.swapState(StateStopped, StateStarting); err != nil {
@@ -193,45 +214,14 @@ func (p *Process) start() error {
 
 	p.waitStarting.Add(1)
 	defer p.waitStarting.Done()
-	cmdContext, ctxCancelUpstream := context.WithCancel(context.Background())
-
-	p.cmd = exec.CommandContext(cmdContext, args[0], args[1:]...)
-	p.cmd.Stdout = p.processLogger
-	p.cmd.Stderr = p.processLogger
-	p.cmd.Env = append(p.cmd.Environ(), p.config.Env...)
-	p.cmd.Cancel = p.cmdStopUpstreamProcess
-	p.cmd.WaitDelay = p.gracefulStopTimeout
-	p.cancelUpstream = ctxCancelUpstream
-	p.cmdWaitChan = make(chan struct{})
-
-	p.failedStartCount++ // this will be reset to zero when the process has successfully started
-
-	p.proxyLogger.Debugf("<%s> Executing start command: %s, env: %s", p.ID, strings.Join(args, " "), strings.Join(p.config.Env, ", "))
-	err = p.cmd.Start()
 
-	// Set process state to failed
-	if err != nil {
-		if curState, swapErr := p.swapState(StateStarting, StateStopped); swapErr != nil {
-			p.state = StateStopped // force it into a stopped state
-			return fmt.Errorf(
-				"failed to start command '%s' and state swap failed. command error: %v, current state: %v, state swap error: %v",
-				strings.Join(args, " "), err, curState, swapErr,
-			)
-		}
-		return fmt.Errorf("start() failed for command '%s': %v", strings.Join(args, " "), err)
+	if remote {
+		p.failedStartCount++
+		p.proxyLogger.Debugf("<%s> Remote model, no command to start for %s", p.ID, p.config.Proxy)
+	} else if err := p.startCommand(args); err != nil {
+		return err
 	}
 
-	// Capture the exit error for later signalling
-	go p.waitForCmd()
-
-	// One of three things can happen at this stage:
-	// 1. The command exits unexpectedly
-	// 2. The health check fails
-	// 3. The health check passes
-	//
-	// only in the third case will the process be considered Ready to accept
-	<-time.After(250 * time.Millisecond) // give process a bit of time to start
-
 	checkStartTime := time.Now()
 	maxDuration := time.Second * time.Duration(p.healthCheckTimeout)
 	checkEndpoint := strings.TrimSpace(p.config.CheckEndpoint)
@@ -256,7 +246,9 @@ func (p *Process) start() error {
 
 			if time.Since(checkStartTime) > maxDuration {
 				p.stopCommand()
-				return fmt.Errorf("health check timed out after %vs", maxDuration.Seconds())
+				err := fmt.Errorf("health check timed out after %vs", maxDuration.Seconds())
+				event.Emit(ProcessHealthCheckFailedEvent{ProcessName: p.ID, Error: err.Error()})
+				return err
 			}
 
 			if err := p.checkHealthEndpoint(healthURL); err == nil {
@@ -274,28 +266,7 @@ func (p *Process) start() error {
 		}
 	}
 
-	if p.config.UnloadAfter > 0 {
-		// start a goroutine to check every second if
-		// the process should be stopped
-		go func() {
-			maxDuration := time.Duration(p.config.UnloadAfter) * time.Second
-
-			for range time.Tick(time.Second) {
-				if p.CurrentState() != StateReady {
-					return
-				}
-
-				// wait for all inflight requests to complete and ticker
-				p.inFlightRequests.Wait()
-
-				if time.Since(p.lastRequestHandled) > maxDuration {
-					p.proxyLogger.Infof("<%s> Unloading model, TTL of %ds reached", p.ID, p.config.UnloadAfter)
-					p.Stop()
-					return
-				}
-			}
-		}()
-	}
+	p.watchUnloadAfter()
 
 	if curState, err := p.swapState(StateStarting, StateReady); err != nil {
 		return fmt.Errorf("failed to set Process state to ready: current state: %v, error: %v", curState, err)
@@ -305,6 +276,102 @@ func (p *Process) start() error {
 	}
 }
 
+// watchUnloadAfter stops the process once it has not handled a request for
+// the model's ttl
+func (p *Process) watchUnloadAfter() {
+	if p.config.UnloadAfter <= 0 {
+		return
+	}
+
+	// start a goroutine to check every second if
+	// the process should be stopped
+	go func() {
+		maxDuration := time.Duration(p.config.UnloadAfter) * time.Second
+
+		for range time.Tick(time.Second) {
+			if p.CurrentState() != StateReady {
+				return
+			}
+
+			// wait for all inflight requests to complete and ticker
+			p.inFlightRequests.Wait()
+
+			if time.Since(p.lastRequestHandled) > maxDuration {
+				p.proxyLogger.Infof("<%s> Unloading model, TTL of %ds reached", p.ID, p.config.UnloadAfter)
+				p.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// startCommand runs the upstream command for a local model
+func (p *Process) startCommand(args []string) error {
+	cmdContext, ctxCancelUpstream := context.WithCancel(context.Background())
+
+	p.cmd = exec.CommandContext(cmdContext, args[0], args[1:]...)
+	p.cmd.Stdout = p.processLogger
+	p.cmd.Stderr = p.processLogger
+	p.cmd.Env = append(p.cmd.Environ(), p.config.Env...)
+	setProcessGroup(p.cmd)
+	p.cmd.Cancel = p.cmdStopUpstreamProcess
+	p.cmd.WaitDelay = p.gracefulStopTimeout
+	p.cancelUpstream = ctxCancelUpstream
+	p.upstreamCtx = cmdContext
+	p.cmdWaitChan = make(chan struct{})
+
+	p.failedStartCount++ // this will be reset to zero when the process has successfully started
+
+	// the process writes to the file directly so it does not depend on llama-swap
+	// to read its output, see adopt()
+	var logFile *os.File
+	if p.logFile != "" {
+		var err error
+		if logFile, err = os.Create(p.logFile); err != nil {
+			p.proxyLogger.Errorf("<%s> Failed to create log file %s, output will not be captured: %v", p.ID, p.logFile, err)
+		} else {
+			p.cmd.Stdout = logFile
+			p.cmd.Stderr = logFile
+		}
+	}
+
+	p.proxyLogger.Debugf("<%s> Executing start command: %s, env: %s", p.ID, strings.Join(args, " "), strings.Join(p.config.Env, ", "))
+	err := p.startWithLimits()
+	if logFile != nil {
+		// the process has its own copy
+		logFile.Close()
+	}
+
+	// Set process state to failed
+	if err != nil {
+		if curState, swapErr := p.swapState(StateStarting, StateStopped); swapErr != nil {
+			p.state = StateStopped // force it into a stopped state
+			return fmt.Errorf(
+				"failed to start command '%s' and state swap failed. command error: %v, current state: %v, state swap error: %v",
+				strings.Join(args, " "), err, curState, swapErr,
+			)
+		}
+		return fmt.Errorf("start() failed for command '%s': %v", strings.Join(args, " "), err)
+	}
+
+	p.setUpstreamPID(p.cmd.Process.Pid)
+	if logFile != nil {
+		go tailFile(p.logFile, 0, p.processLogger, p.cmdWaitChan)
+	}
+
+	// Capture the exit error for later signalling
+	go p.waitForCmd()
+
+	// One of three things can happen at this stage:
+	// 1. The command exits unexpectedly
+	// 2. The health check fails
+	// 3. The health check passes
+	//
+	// only in the third case will the process be considered Ready to accept
+	<-time.After(250 * time.Millisecond) // give process a bit of time to start
+	return nil
+}
+
 // Stop will wait for inflight requests to complete before stopping the process.
 func (p *Process) Stop() {
 	if !isValidTransition(p.CurrentState(), StateStopping) {
@@ -355,6 +422,21 @@ func (p *Process) stopCommand() {
 		p.proxyLogger.Debugf("<%s> stopCommand took %v", p.ID, time.Since(stopStartTime))
 	}()
 
+	// remote models have no upstream process, stopping only changes the state
+	if p.config.IsRemote() {
+		if p.CurrentState() == StateStopping {
+			if curState, err := p.swapState(StateStopping, StateStopped); err == nil {
+				return
+			} else {
+				p.proxyLogger.Errorf("<%s> could not swap to StateStopped. curState=%s, err: %v", p.ID, curState, err)
+			}
+		}
+		p.stateMutex.Lock()
+		p.state = StateStopped // force it to be in this state
+		p.stateMutex.Unlock()
+		return
+	}
+
 	if p.cancelUpstream == nil {
 		p.proxyLogger.Errorf("<%s> stopCommand has a nil p.cancelUpstream()", p.ID)
 		return
@@ -383,6 +465,7 @@ func (p *Process) checkHealthEndpoint(healthURL string) error {
 	if err != nil {
 		return err
 	}
+	p.setUpstreamHeaders(req.Header)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -442,6 +525,7 @@ func (p *Process) ProxyRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.Header = r.Header.Clone()
+	p.setUpstreamHeaders(req.Header)
 
 	contentLength, err := strconv.ParseInt(req.Header.Get("content-length"), 10, 64)
 	if err == nil {
@@ -491,11 +575,22 @@ func (p *Process) ProxyRequest(w http.ResponseWriter, r *http.Request) {
 		p.ID, r.RequestURI, startDuration, totalTime)
 }
 
+// setUpstreamHeaders adds the model's configured headers, e.g. for authenticating
+// with a remote server. They replace headers sent by the client.
+func (p *Process) setUpstreamHeaders(header http.Header) {
+	for name, value := range p.config.Headers {
+		header.Set(name, value)
+	}
+}
+
 // waitForCmd waits for the command to exit and handles exit conditions depending on current state
 func (p *Process) waitForCmd() {
 	exitErr := p.cmd.Wait()
 	p.proxyLogger.Debugf("<%s> cmd.Wait() returned error: %v", p.ID, exitErr)
 
+	// children that did not exit with the process would keep holding memory
+	killProcessGroup(p.cmd.Process.Pid)
+
 	if exitErr != nil {
 		if errno, ok := exitErr.(syscall.Errno); ok {
 			p.proxyLogger.Errorf("<%s> errno >> %v", p.ID, errno)
@@ -514,6 +609,18 @@ func (p *Process) waitForCmd() {
 		}
 	}
 
+	exitCode := -1
+	if p.cmd.ProcessState != nil {
+		exitCode = p.cmd.ProcessState.ExitCode()
+	}
+	p.handleExit(exitErr, exitCode)
+}
+
+// handleExit updates the state once the upstream process has exited
+func (p *Process) handleExit(exitErr error, exitCode int) {
+	p.setUpstreamPID(0)
+	p.removeCgroup()
+
 	currentState := p.CurrentState()
 	switch currentState {
 	case StateStopping:
@@ -524,6 +631,15 @@ func (p *Process) waitForCmd() {
 	default:
 		p.proxyLogger.Infof("<%s> process exited but not StateStopping, current state: %s", p.ID, currentState)
 		p.state = StateStopped // force it to be in this state
+
+		// exited on its own while starting or serving requests
+		if p.upstreamCtx.Err() == nil {
+			crash := ProcessCrashedEvent{ProcessName: p.ID, ExitCode: exitCode, Error: "process exited"}
+			if exitErr != nil {
+				crash.Error = exitErr.Error()
+			}
+			event.Emit(crash)
+		}
 	}
 	close(p.cmdWaitChan)
 }
@@ -538,9 +654,14 @@ func (p *Process) cmdStopUpstreamProcess() error {
 		return fmt.Errorf("<%s> process is nil or cmd is nil, skipping graceful stop", p.ID)
 	}
 
+	return p.stopPID(p.cmd.Process.Pid, p.cmd.Env)
+}
+
+// stopPID runs cmdStop, or sends a SIGTERM, to gracefully stop the process pid
+func (p *Process) stopPID(pid int, env []string) error {
 	if p.config.CmdStop != "" {
 		// replace ${PID} with the pid of the process
-		stopArgs, err := config.SanitizeCommand(strings.ReplaceAll(p.config.CmdStop, "${PID}", fmt.Sprintf("%d", p.cmd.Process.Pid)))
+		stopArgs, err := config.SanitizeCommand(strings.ReplaceAll(p.config.CmdStop, "${PID}", fmt.Sprintf("%d", pid)))
 		if err != nil {
 			p.proxyLogger.Errorf("<%s> Failed to sanitize stop command: %v", p.ID, err)
 			return err
@@ -551,14 +672,14 @@ func (p *Process) cmdStopUpstreamProcess() error {
 		stopCmd := exec.Command(stopArgs[0], stopArgs[1:]...)
 		stopCmd.Stdout = p.processLogger
 		stopCmd.Stderr = p.processLogger
-		stopCmd.Env = p.cmd.Env
+		stopCmd.Env = env
 
 		if err := stopCmd.Run(); err != nil {
 			p.proxyLogger.Errorf("<%s> Failed to exec stop command: %v", p.ID, err)
 			return err
 		}
 	} else {
-		if err := p.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		if err := terminatePID(pid); err != nil {
 			p.proxyLogger.Errorf("<%s> Failed to send SIGTERM to process: %v", p.ID, err)
 			return err
 		}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how often an adopted process is checked, it is not a child so it can not be waited on
+const adoptedPollInterval = 250 * time.Millisecond
+
+func (p *Process) setUpstreamPID(pid int) {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	p.upstreamPID = pid
+}
+
+// pid returns the pid of the upstream process, 0 when it is not running
+func (p *Process) pid() int {
+	p.stateMutex.RLock()
+	defer p.stateMutex.RUnlock()
+	return p.upstreamPID
+}
+
+// adopt takes over an upstream process started by a previous llama-swap. It
+// must pass the health check, then the process goes directly to StateReady
+// without being started again.
+func (p *Process) adopt(pid int) error {
+	if p.config.IsRemote() {
+		return fmt.Errorf("remote models have no process to adopt")
+	}
+	if !processAlive(pid) {
+		return fmt.Errorf("process %d is not running", pid)
+	}
+
+	if checkEndpoint := strings.TrimSpace(p.config.CheckEndpoint); checkEndpoint != "none" {
+		healthURL, err := url.JoinPath(p.config.Proxy, checkEndpoint)
+		if err != nil {
+			return fmt.Errorf("failed to create health check URL proxy=%s and checkEndpoint=%s", p.config.Proxy, checkEndpoint)
+		}
+		if err := p.checkHealthEndpoint(healthURL); err != nil {
+			return fmt.Errorf("health check failed: %v", err)
+		}
+	}
+
+	if curState, err := p.swapState(StateStopped, StateStarting); err != nil {
+		return fmt.Errorf("failed to set Process state to starting: current state: %v, error: %v", curState, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancelUpstream = cancel
+	p.upstreamCtx = ctx
+	p.cmdWaitChan = make(chan struct{})
+	p.lastRequestHandled = time.Now()
+	p.setUpstreamPID(pid)
+
+	if p.logFile != "" {
+		// only new output, the rest was already logged by the previous llama-swap
+		if info, err := os.Stat(p.logFile); err == nil {
+			go tailFile(p.logFile, info.Size(), p.processLogger, p.cmdWaitChan)
+		}
+	}
+
+	go p.waitForAdopted(pid)
+	p.watchUnloadAfter()
+
+	if curState, err := p.swapState(StateStarting, StateReady); err != nil {
+		return fmt.Errorf("failed to set Process state to ready: current state: %v, error: %v", curState, err)
+	}
+	p.proxyLogger.Infof("<%s> Adopted running process %d", p.ID, pid)
+	return nil
+}
+
+// waitForAdopted polls the adopted process until it exits. When the process is
+// stopped it is sent cmdStop or a SIGTERM, then killed after gracefulStopTimeout.
+func (p *Process) waitForAdopted(pid int) {
+	ticker := time.NewTicker(adoptedPollInterval)
+	defer ticker.Stop()
+
+	stopRequested := p.upstreamCtx.Done()
+	for processAlive(pid) {
+		select {
+		case <-stopRequested:
+			stopRequested = nil
+			env := append(os.Environ(), p.config.Env...)
+			if err := p.stopPID(pid, env); err != nil {
+				killPID(pid)
+			} else {
+				time.AfterFunc(p.gracefulStopTimeout, func() {
+					if processAlive(pid) {
+						p.proxyLogger.Warnf("<%s> Process %d did not stop in %v, killing it", p.ID, pid, p.gracefulStopTimeout)
+						killPID(pid)
+					}
+				})
+			}
+		case <-ticker.C:
+		}
+	}
+
+	p.proxyLogger.Debugf("<%s> Adopted process %d exited", p.ID, pid)
+	p.handleExit(nil, -1)
+}
+
+// tailFile copies what is written to path from offset onwards into w until done
+// is closed
+func tailFile(path string, offset int64, w io.Writer, done <-chan struct{}) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		io.Copy(w, file)
+		select {
+		case <-done:
+			// anything written before the process exited
+			io.Copy(w, file)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// commandMatches checks that pid is still running program. After a reboot the
+// pid could belong to an unrelated process. Only Linux can be checked, other
+// platforms always match.
+func commandMatches(pid int, program string) bool {
+	cmdline, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return true
+	}
+	running, _, _ := bytes.Cut(cmdline, []byte{0})
+	return filepath.Base(string(running)) == filepath.Base(program)
+}
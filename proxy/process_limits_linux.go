@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+const (
+	// cpu.max period in microseconds
+	cgroupCPUPeriod = 100000
+
+	// see ioprio_set(2)
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+
+	// how long removeCgroup waits for the processes in the cgroup to exit
+	cgroupRemoveTimeout = time.Second
+)
+
+// startWithLimits starts p.cmd with the model's resources limits. The process
+// is started directly in its cgroup and inherits the priority and affinity,
+// so children it forks right away are limited as well.
+func (p *Process) startWithLimits() error {
+	limits := p.config.Resources
+	if !limits.IsSet() {
+		return p.cmd.Start()
+	}
+
+	if limits.UsesCgroup() {
+		dir, err := setupCgroup(p.cgroupRoot, p.ID, limits)
+		if err != nil {
+			return fmt.Errorf("failed to set up cgroup: %v", err)
+		}
+		cgroup, err := os.Open(dir)
+		if err != nil {
+			return fmt.Errorf("failed to set up cgroup: %v", err)
+		}
+		defer cgroup.Close()
+
+		if p.cmd.SysProcAttr == nil {
+			p.cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		p.cmd.SysProcAttr.UseCgroupFD = true
+		p.cmd.SysProcAttr.CgroupFD = int(cgroup.Fd())
+	}
+
+	if limits.Nice == 0 && limits.IONice == "" && limits.CPUAffinity == "" {
+		return p.cmd.Start()
+	}
+
+	// the settings are changed on a thread which then starts the process. The
+	// thread is never unlocked so it exits with the goroutine instead of being
+	// reused with the changed settings.
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := setThreadLimits(limits); err != nil {
+			errc <- err
+			return
+		}
+		errc <- p.cmd.Start()
+	}()
+	return <-errc
+}
+
+// setupCgroup creates the cgroup for modelID under root and writes its limits
+func setupCgroup(root, modelID string, limits config.ResourceLimits) (string, error) {
+	if root == "" {
+		root = config.DefaultCgroupRoot
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+
+	var controllers []string
+	values := map[string]string{"memory.max": "max", "cpu.max": "max", "pids.max": "max"}
+	if limits.Memory != "" {
+		bytes, _ := config.ParseMemorySize(limits.Memory) // validated when the configuration is loaded
+		controllers = append(controllers, "+memory")
+		values["memory.max"] = strconv.FormatInt(bytes, 10)
+	}
+	if limits.CPUs > 0 {
+		controllers = append(controllers, "+cpu")
+		values["cpu.max"] = fmt.Sprintf("%d %d", int64(limits.CPUs*cgroupCPUPeriod), cgroupCPUPeriod)
+	}
+	if limits.Pids > 0 {
+		controllers = append(controllers, "+pids")
+		values["pids.max"] = strconv.Itoa(limits.Pids)
+	}
+
+	subtreeControl := filepath.Join(root, "cgroup.subtree_control")
+	if err := os.WriteFile(subtreeControl, []byte(strings.Join(controllers, " ")), 0644); err != nil {
+		return "", fmt.Errorf("failed to enable controllers in %s: %v", subtreeControl, err)
+	}
+
+	// a cgroup left behind, e.g. when llama-swap was killed, is reused
+	dir := cgroupPath(root, modelID)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	for _, file := range []string{"memory.max", "cpu.max", "pids.max"} {
+		err := os.WriteFile(filepath.Join(dir, file), []byte(values[file]), 0644)
+		// limits removed from the configuration are reset, their controller may
+		// not be enabled
+		if err != nil && values[file] != "max" {
+			return "", fmt.Errorf("failed to set %s: %v", file, err)
+		}
+	}
+	return dir, nil
+}
+
+// cgroupPath returns the cgroup of modelID under root
+func cgroupPath(root, modelID string) string {
+	if root == "" {
+		root = config.DefaultCgroupRoot
+	}
+	return filepath.Join(root, unsafeFileChars.ReplaceAllString(modelID, "_"))
+}
+
+// removeCgroup removes the cgroup of the model after its process has exited.
+// Processes left in the cgroup are killed first, it can only be removed when
+// it is empty.
+func (p *Process) removeCgroup() {
+	if !p.config.Resources.UsesCgroup() {
+		return
+	}
+
+	dir := cgroupPath(p.cgroupRoot, p.ID)
+	// cgroup.kill is available since Linux 5.14, it is not created when missing
+	if kill, err := os.OpenFile(filepath.Join(dir, "cgroup.kill"), os.O_WRONLY, 0); err == nil {
+		kill.WriteString("1")
+		kill.Close()
+	}
+
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for {
+		err := os.Remove(dir)
+		if err == nil || os.IsNotExist(err) {
+			return
+		}
+		if time.Now().After(deadline) {
+			p.proxyLogger.Warnf("<%s> Failed to remove cgroup %s: %v", p.ID, dir, err)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// setThreadLimits sets the priority and CPU affinity of the calling thread
+func setThreadLimits(limits config.ResourceLimits) error {
+	if limits.Nice != 0 {
+		// 0 is the calling thread
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, limits.Nice); err != nil {
+			return fmt.Errorf("failed to set nice %d: %v", limits.Nice, err)
+		}
+	}
+
+	if limits.IONice != "" {
+		class, level, _ := config.ParseIONice(limits.IONice)
+		prio := uintptr(class<<ioprioClassShift | level)
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prio); errno != 0 {
+			return fmt.Errorf("failed to set ionice %s: %v", limits.IONice, errno)
+		}
+	}
+
+	if limits.CPUAffinity != "" {
+		// validated when the configuration is loaded, the CPUs fit in the mask
+		cpus, _ := config.ParseCPUList(limits.CPUAffinity)
+		var mask [config.MaxAffinityCPUs / 64]uint64
+		for _, cpu := range cpus {
+			mask[cpu/64] |= 1 << (cpu % 64)
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask))); errno != 0 {
+			return fmt.Errorf("failed to set cpuAffinity %s: %v", limits.CPUAffinity, errno)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupCgroup(t *testing.T) {
+	root := t.TempDir()
+
+	dir, err := setupCgroup(root, "org/model:1", config.ResourceLimits{
+		Memory: "1.5G",
+		CPUs:   2.5,
+		Pids:   128,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, filepath.Join(root, "org_model_1"), dir)
+
+	readFile := func(name string) string {
+		data, err := os.ReadFile(name)
+		assert.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "+memory +cpu +pids", readFile(filepath.Join(root, "cgroup.subtree_control")))
+	assert.Equal(t, "1610612736", readFile(filepath.Join(dir, "memory.max")))
+	assert.Equal(t, "250000 100000", readFile(filepath.Join(dir, "cpu.max")))
+	assert.Equal(t, "128", readFile(filepath.Join(dir, "pids.max")))
+
+	// removed limits are reset
+	_, err = setupCgroup(root, "org/model:1", config.ResourceLimits{Pids: 64})
+	assert.NoError(t, err)
+	assert.Equal(t, "+pids", readFile(filepath.Join(root, "cgroup.subtree_control")))
+	assert.Equal(t, "max", readFile(filepath.Join(dir, "memory.max")))
+	assert.Equal(t, "max", readFile(filepath.Join(dir, "cpu.max")))
+	assert.Equal(t, "64", readFile(filepath.Join(dir, "pids.max")))
+}
+
+func TestProcess_RemoveCgroup(t *testing.T) {
+	root := t.TempDir()
+	modelConfig := getTestSimpleResponderConfig("limited")
+	modelConfig.Resources = config.ResourceLimits{Pids: 64}
+
+	process := NewProcess("org/limited", 5, modelConfig, debugLogger, debugLogger)
+	process.cgroupRoot = root
+
+	// a cgroup directory only has the kernel's interface files, rmdir removes it
+	dir := cgroupPath(root, "org/limited")
+	if !assert.NoError(t, os.Mkdir(dir, 0755)) {
+		return
+	}
+	process.removeCgroup()
+	assert.NoDirExists(t, dir)
+
+	// nothing to remove
+	process.removeCgroup()
+}
+
+func TestProcess_StartWithThreadLimits(t *testing.T) {
+	modelConfig := getTestSimpleResponderConfig("limited")
+	modelConfig.Resources = config.ResourceLimits{Nice: 5, IONice: "idle", CPUAffinity: "0"}
+
+	process := NewProcess("limited", 5, modelConfig, debugLogger, debugLogger)
+	defer process.Stop()
+	if !assert.NoError(t, process.start()) {
+		return
+	}
+
+	// field 19 of /proc/<pid>/stat is the nice value
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(process.pid()), "stat"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, fields, _ := strings.Cut(string(stat), ") ")
+	assert.Equal(t, "5", strings.Fields(fields)[16])
+}
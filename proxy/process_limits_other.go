@@ -0,0 +1,14 @@
+//go:build !linux
+
+package proxy
+
+// startWithLimits starts p.cmd, resources limits are only supported on Linux
+func (p *Process) startWithLimits() error {
+	if p.config.Resources.IsSet() {
+		p.proxyLogger.Warnf("<%s> resources limits are only supported on Linux, ignoring them", p.ID)
+	}
+	return p.cmd.Start()
+}
+
+// removeCgroup does nothing, cgroups are only used on Linux
+func (p *Process) removeCgroup() {}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// processAlive returns true if a process with pid exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// setProcessGroup starts cmd in its own process group so stopping it also
+// stops its children, e.g. when cmd is a shell wrapper
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminatePID sends a SIGTERM to the process group of pid
+func terminatePID(pid int) error {
+	return signalPID(pid, syscall.SIGTERM)
+}
+
+// killPID forcefully stops the process group of pid
+func killPID(pid int) error {
+	return signalPID(pid, syscall.SIGKILL)
+}
+
+// signalPID signals the process group led by pid. Processes that do not lead
+// a group, like ones started before process groups were used, are signalled
+// directly.
+func signalPID(pid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pid, sig); err != syscall.ESRCH {
+		return err
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// killProcessGroup kills the processes left in the group of pid after pid
+// has exited. The group ID can not be reused while it has members.
+func killProcessGroup(pid int) {
+	syscall.Kill(-pid, syscall.SIGKILL)
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcess_StopsWholeProcessGroup(t *testing.T) {
+	port := getTestPort()
+	upstreamURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	// the server is a child of the shell and does not get the shell's SIGTERM
+	modelConfig := config.ModelConfig{
+		Cmd:   fmt.Sprintf(`sh -c '%s --port %d --silent --respond wrapped & wait'`, simpleResponderPath, port),
+		Proxy: upstreamURL,
+	}
+	process := NewProcess("wrapped", 5, modelConfig, debugLogger, debugLogger)
+	defer process.Stop()
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	process.ProxyRequest(w, req)
+	if !assert.Equal(t, http.StatusOK, w.Code) {
+		return
+	}
+
+	process.StopImmediately()
+	assert.Equal(t, StateStopped, process.CurrentState())
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(upstreamURL + "/health")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err != nil
+	}, 5*time.Second, 50*time.Millisecond, "the wrapped server should be stopped")
+}
@@ -492,3 +492,46 @@ func TestProcess_EnvironmentSetCorrectly(t *testing.T) {
 	assert.Equal(t, len(process1.cmd.Environ())+2, len(process2.cmd.Environ()), "process2 should have 2 more environment variables than process1")
 
 }
+
+func TestProcess_RemoteModel(t *testing.T) {
+	var healthChecks int
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer remote-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/health" {
+			healthChecks++
+		}
+		w.Write([]byte("remote " + r.URL.Path))
+	}))
+	defer remote.Close()
+
+	config := config.ModelConfig{
+		Proxy:         remote.URL,
+		CheckEndpoint: "/health",
+		Headers:       map[string]string{"Authorization": "Bearer remote-key"},
+	}
+	process := NewProcess("remote", 5, config, debugLogger, debugLogger)
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	process.ProxyRequest(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "remote /v1/models", w.Body.String())
+	assert.Equal(t, StateReady, process.CurrentState())
+	assert.Equal(t, 1, healthChecks)
+
+	// stopping only changes the state, the health check runs again on the next request
+	process.Stop()
+	assert.Equal(t, StateStopped, process.CurrentState())
+
+	w = httptest.NewRecorder()
+	process.ProxyRequest(w, httptest.NewRequest("GET", "/v1/models", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, healthChecks)
+
+	process.Shutdown()
+	assert.Equal(t, StateShutdown, process.CurrentState())
+}
@@ -0,0 +1,55 @@
+//go:build windows
+
+package proxy
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// exit code reported for processes that have not exited
+const windowsStillActive = 259
+
+// processAlive returns true if a process with pid exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	const processQueryLimitedInformation = 0x1000
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == windowsStillActive
+}
+
+// setProcessGroup is not needed on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminatePID sends a SIGTERM to the process pid
+func terminatePID(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(syscall.SIGTERM)
+}
+
+// killProcessGroup is not needed on Windows
+func killProcessGroup(pid int) {}
+
+// killPID forcefully stops the process pid
+func killPID(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
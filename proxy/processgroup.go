@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/mostlygeek/llama-swap/proxy/config"
 )
@@ -24,6 +25,14 @@ type ProcessGroup struct {
 	// map of current processes
 	processes       map[string]*Process
 	lastUsedProcess string
+
+	// for the group's idleTtl: requests in progress and when the last one
+	// finished, guarded by the mutex
+	inflight    int
+	lastRequest time.Time
+
+	// closed by Shutdown
+	shutdown chan struct{}
 }
 
 func NewProcessGroup(id string, config config.Config, proxyLogger *LogMonitor, upstreamLogger *LogMonitor) *ProcessGroup {
@@ -41,25 +50,91 @@ func NewProcessGroup(id string, config config.Config, proxyLogger *LogMonitor, u
 		proxyLogger:    proxyLogger,
 		upstreamLogger: upstreamLogger,
 		processes:      make(map[string]*Process),
+		lastRequest:    time.Now(),
+		shutdown:       make(chan struct{}),
 	}
 
 	// Create a Process for each member in the group
 	for _, modelID := range groupConfig.Members {
 		modelConfig, modelID, _ := pg.config.FindConfig(modelID)
 		process := NewProcess(modelID, pg.config.HealthCheckTimeout, modelConfig, pg.upstreamLogger, pg.proxyLogger)
+		process.cgroupRoot = pg.config.CgroupRoot
 		pg.processes[modelID] = process
 	}
 
+	if groupConfig.IdleTTL > 0 {
+		go pg.watchIdleTTL(time.Duration(groupConfig.IdleTTL)*time.Second, time.Second)
+	}
+
 	return pg
 }
 
+// watchIdleTTL stops all members once none of them has handled a request for
+// idleTTL, checking every interval
+func (pg *ProcessGroup) watchIdleTTL(idleTTL, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pg.shutdown:
+			return
+		case <-ticker.C:
+		}
+
+		pg.Lock()
+		idle := pg.inflight == 0 && time.Since(pg.lastRequest) > idleTTL
+		pg.Unlock()
+		if !idle || !pg.hasRunningProcess() {
+			continue
+		}
+
+		pg.proxyLogger.Infof("<%s> Unloading group, idle TTL of %.0fs reached", pg.id, idleTTL.Seconds())
+		pg.stopProcesses(StopWaitForInflightRequest, false)
+		pg.Lock()
+		pg.lastUsedProcess = ""
+		pg.Unlock()
+	}
+}
+
+// hasRunningProcess returns true if a local member is starting or ready
+func (pg *ProcessGroup) hasRunningProcess() bool {
+	for _, process := range pg.processes {
+		if process.config.IsRemote() {
+			continue
+		}
+		switch process.CurrentState() {
+		case StateStarting, StateReady:
+			return true
+		}
+	}
+	return false
+}
+
+// trackRequest records a request for the group's idleTtl, the returned
+// function is called when the request is done
+func (pg *ProcessGroup) trackRequest() func() {
+	pg.Lock()
+	pg.inflight++
+	pg.Unlock()
+
+	return func() {
+		pg.Lock()
+		pg.inflight--
+		pg.lastRequest = time.Now()
+		pg.Unlock()
+	}
+}
+
 // ProxyRequest proxies a request to the specified model
 func (pg *ProcessGroup) ProxyRequest(modelID string, writer http.ResponseWriter, request *http.Request) error {
 	if !pg.HasMember(modelID) {
 		return fmt.Errorf("model %s not part of group %s", modelID, pg.id)
 	}
+	defer pg.trackRequest()()
 
-	if pg.swap {
+	// remote models do not use local resources and never swap out other models
+	if pg.swap && !pg.processes[modelID].config.IsRemote() {
 		pg.Lock()
 		if pg.lastUsedProcess != modelID {
 
@@ -84,6 +159,17 @@ func (pg *ProcessGroup) ProxyRequest(modelID string, writer http.ResponseWriter,
 	return nil
 }
 
+// swapsOut returns true when a request to modelID would stop the model that
+// is currently running in the swapping group
+func (pg *ProcessGroup) swapsOut(modelID string) bool {
+	if !pg.swap || pg.processes[modelID].config.IsRemote() {
+		return false
+	}
+	pg.Lock()
+	defer pg.Unlock()
+	return pg.lastUsedProcess != "" && pg.lastUsedProcess != modelID
+}
+
 func (pg *ProcessGroup) HasMember(modelName string) bool {
 	return slices.Contains(pg.config.Groups[pg.id].Members, modelName)
 }
@@ -112,6 +198,12 @@ func (pg *ProcessGroup) StopProcess(modelID string, strategy StopStrategy) error
 }
 
 func (pg *ProcessGroup) StopProcesses(strategy StopStrategy) {
+	pg.stopProcesses(strategy, true)
+}
+
+// stopProcesses stops the processes in the group. Remote models are only
+// stopped when includeRemote is true, they are not unloaded by exclusive groups.
+func (pg *ProcessGroup) stopProcesses(strategy StopStrategy, includeRemote bool) {
 	pg.Lock()
 	defer pg.Unlock()
 
@@ -122,6 +214,9 @@ func (pg *ProcessGroup) StopProcesses(strategy StopStrategy) {
 	// stop Processes in parallel
 	var wg sync.WaitGroup
 	for _, process := range pg.processes {
+		if !includeRemote && process.config.IsRemote() {
+			continue
+		}
 		wg.Add(1)
 		go func(process *Process) {
 			defer wg.Done()
@@ -137,6 +232,12 @@ func (pg *ProcessGroup) StopProcesses(strategy StopStrategy) {
 }
 
 func (pg *ProcessGroup) Shutdown() {
+	select {
+	case <-pg.shutdown:
+	default:
+		close(pg.shutdown)
+	}
+
 	var wg sync.WaitGroup
 	for _, process := range pg.processes {
 		wg.Add(1)
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/mostlygeek/llama-swap/proxy/config"
 	"github.com/stretchr/testify/assert"
@@ -113,3 +114,46 @@ func TestProcessGroup_ProxyRequestSwapIsFalse(t *testing.T) {
 		assert.Equal(t, StateReady, process.CurrentState())
 	}
 }
+
+func TestProcessGroup_IdleTTL(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping group idle TTL test")
+	}
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+			"model2": getTestSimpleResponderConfig("model2"),
+		},
+		Groups: map[string]config.GroupConfig{
+			"G1": {
+				Swap:    false,
+				IdleTTL: 1,
+				Members: []string{"model1", "model2"},
+			},
+		},
+	})
+
+	pg := NewProcessGroup("G1", config, testLogger, testLogger)
+	defer pg.Shutdown()
+
+	for _, modelName := range []string{"model1", "model2"} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		w := httptest.NewRecorder()
+		assert.NoError(t, pg.ProxyRequest(modelName, w, req))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// a slow request keeps the whole group loaded
+	req := httptest.NewRequest("GET", "/slow-respond?echo=1234&delay=2000ms", nil)
+	w := httptest.NewRecorder()
+	assert.NoError(t, pg.ProxyRequest("model1", w, req))
+	assert.Equal(t, StateReady, pg.processes["model2"].CurrentState())
+
+	// both members are unloaded together
+	assert.Eventually(t, func() bool {
+		return pg.processes["model1"].CurrentState() == StateStopped &&
+			pg.processes["model2"].CurrentState() == StateStopped
+	}, 5*time.Second, 100*time.Millisecond)
+}
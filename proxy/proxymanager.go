@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -38,6 +40,38 @@ type ProxyManager struct {
 
 	metricsMonitor *MetricsMonitor
 
+	// nil when rate limiting is not configured
+	rateLimiter *RateLimiter
+
+	// usage totals per user, model and day
+	usageTracker *UsageTracker
+
+	// requests mirrored to shadow models
+	mirrorMonitor *MirrorMonitor
+
+	// other llama-swap instances serving models this one does not have
+	peerManager *PeerManager
+
+	// scheduled and event hooks
+	hookRunner *HookRunner
+
+	// lifecycle events sent to webhooks and commands
+	notifier *Notifier
+
+	// records running processes for adoption after a restart, nil when disabled
+	stateFile *processStateFile
+
+	// changes the configuration through /api/config, nil when not available
+	configEditor *config.Editor
+
+	// GGUF header information of model files for /v1/models
+	modelInfo *ModelInfoCache
+
+	// proxied requests in progress and the end of the drain period in
+	// unix nanoseconds, zero when not draining. See Drain.
+	inflightRequests atomic.Int64
+	drainDeadline    atomic.Int64
+
 	processGroups map[string]*ProcessGroup
 
 	// shutdown signaling
@@ -84,6 +118,8 @@ func New(config config.Config) *ProxyManager {
 		upstreamLogger: upstreamLogger,
 
 		metricsMonitor: NewMetricsMonitor(&config),
+		mirrorMonitor:  NewMirrorMonitor(),
+		modelInfo:      NewModelInfoCache(),
 
 		processGroups: make(map[string]*ProcessGroup),
 
@@ -91,6 +127,22 @@ func New(config config.Config) *ProxyManager {
 		shutdownCancel: shutdownCancel,
 	}
 
+	if config.RateLimits.Enabled() {
+		pm.rateLimiter = NewRateLimiter(config.RateLimits)
+	}
+
+	usageTracker, err := NewUsageTracker(config.Usage.File)
+	if err != nil {
+		// do not overwrite a file that could not be read
+		proxyLogger.Errorf("Failed to load usage from %s, usage will not be persisted: %v", config.Usage.File, err)
+		usageTracker, _ = NewUsageTracker("")
+	}
+	pm.usageTracker = usageTracker
+	go pm.usageTracker.runSaveLoop(30*time.Second, shutdownCtx.Done(), proxyLogger)
+
+	pm.peerManager = NewPeerManager(config.Peers, proxyLogger)
+	pm.peerManager.Start(shutdownCtx)
+
 	// create the process groups
 	for groupID := range config.Groups {
 		processGroup := NewProcessGroup(groupID, config, proxyLogger, upstreamLogger)
@@ -99,30 +151,33 @@ func New(config config.Config) *ProxyManager {
 
 	pm.setupGinEngine()
 
+	pm.notifier = NewNotifier(config, proxyLogger)
+	pm.notifier.Start(shutdownCtx)
+
+	pm.hookRunner = NewHookRunner(config, proxyLogger)
+	pm.hookRunner.preload = pm.preloadModel
+	pm.hookRunner.unload = func(realModelName string) {
+		if processGroup := pm.findGroupByModelName(realModelName); processGroup != nil {
+			proxyLogger.Infof("Unloading model: %s", realModelName)
+			processGroup.StopProcess(realModelName, StopWaitForInflightRequest)
+		}
+	}
+	pm.hookRunner.unloadAll = func() {
+		proxyLogger.Info("Unloading all models")
+		pm.StopProcesses(StopWaitForInflightRequest)
+	}
+	pm.hookRunner.Start(shutdownCtx)
+
+	if config.StateFile != "" {
+		pm.setupStateFile()
+	}
+
 	// run any startup hooks
 	if len(config.Hooks.OnStartup.Preload) > 0 {
 		// do it in the background, don't block startup -- not sure if good idea yet
 		go func() {
-			discardWriter := &DiscardWriter{}
 			for _, realModelName := range config.Hooks.OnStartup.Preload {
-				proxyLogger.Infof("Preloading model: %s", realModelName)
-				processGroup, _, err := pm.swapProcessGroup(realModelName)
-
-				if err != nil {
-					event.Emit(ModelPreloadedEvent{
-						ModelName: realModelName,
-						Success:   false,
-					})
-					proxyLogger.Errorf("Failed to preload model %s: %v", realModelName, err)
-					continue
-				} else {
-					req, _ := http.NewRequest("GET", "/", nil)
-					processGroup.ProxyRequest(realModelName, discardWriter, req)
-					event.Emit(ModelPreloadedEvent{
-						ModelName: realModelName,
-						Success:   true,
-					})
-				}
+				pm.preloadModel(realModelName)
 			}
 		}()
 	}
@@ -130,6 +185,27 @@ func New(config config.Config) *ProxyManager {
 	return pm
 }
 
+// preloadModel starts a model and waits for it to be ready
+func (pm *ProxyManager) preloadModel(realModelName string) {
+	pm.proxyLogger.Infof("Preloading model: %s", realModelName)
+	processGroup, _, err := pm.swapProcessGroup(realModelName)
+	if err != nil {
+		event.Emit(ModelPreloadedEvent{
+			ModelName: realModelName,
+			Success:   false,
+		})
+		pm.proxyLogger.Errorf("Failed to preload model %s: %v", realModelName, err)
+		return
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	processGroup.ProxyRequest(realModelName, &DiscardWriter{}, req)
+	event.Emit(ModelPreloadedEvent{
+		ModelName: realModelName,
+		Success:   true,
+	})
+}
+
 func (pm *ProxyManager) setupGinEngine() {
 	pm.ginEngine.Use(func(c *gin.Context) {
 		// Start timer
@@ -185,33 +261,35 @@ func (pm *ProxyManager) setupGinEngine() {
 		c.Next()
 	})
 
+	rl := RateLimitMiddleware(pm)
 	mm := MetricsMiddleware(pm)
 
 	// Set up routes using the Gin engine
-	pm.ginEngine.POST("/v1/chat/completions", mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/v1/chat/completions", rl, mm, pm.proxyOAIHandler)
 	// Support legacy /v1/completions api, see issue #12
-	pm.ginEngine.POST("/v1/completions", mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/v1/completions", rl, mm, pm.proxyOAIHandler)
 
 	// Support embeddings and reranking
-	pm.ginEngine.POST("/v1/embeddings", mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/v1/embeddings", rl, mm, pm.proxyOAIHandler)
 
 	// llama-server's /reranking endpoint + aliases
-	pm.ginEngine.POST("/reranking", mm, pm.proxyOAIHandler)
-	pm.ginEngine.POST("/rerank", mm, pm.proxyOAIHandler)
-	pm.ginEngine.POST("/v1/rerank", mm, pm.proxyOAIHandler)
-	pm.ginEngine.POST("/v1/reranking", mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/reranking", rl, mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/rerank", rl, mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/v1/rerank", rl, mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/v1/reranking", rl, mm, pm.proxyOAIHandler)
 
 	// llama-server's /infill endpoint for code infilling
-	pm.ginEngine.POST("/infill", mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/infill", rl, mm, pm.proxyOAIHandler)
 
 	// llama-server's /completion endpoint
-	pm.ginEngine.POST("/completion", mm, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/completion", rl, mm, pm.proxyOAIHandler)
 
 	// Support audio/speech endpoint
-	pm.ginEngine.POST("/v1/audio/speech", pm.proxyOAIHandler)
-	pm.ginEngine.POST("/v1/audio/transcriptions", pm.proxyOAIPostFormHandler)
+	pm.ginEngine.POST("/v1/audio/speech", rl, pm.proxyOAIHandler)
+	pm.ginEngine.POST("/v1/audio/transcriptions", rl, pm.proxyOAIPostFormHandler)
 
 	pm.ginEngine.GET("/v1/models", pm.listModelsHandler)
+	pm.ginEngine.GET("/v1/models/*model", pm.getModelHandler)
 
 	// in proxymanager_loghandlers.go
 	pm.ginEngine.GET("/logs", pm.sendLogsHandlers)
@@ -232,6 +310,10 @@ func (pm *ProxyManager) setupGinEngine() {
 	pm.ginEngine.GET("/unload", pm.unloadAllModelsHandler)
 	pm.ginEngine.GET("/running", pm.listRunningProcessesHandler)
 	pm.ginEngine.GET("/health", func(c *gin.Context) {
+		if pm.IsDraining() {
+			c.String(http.StatusServiceUnavailable, "draining")
+			return
+		}
 		c.String(http.StatusOK, "OK")
 	})
 
@@ -320,9 +402,65 @@ func (pm *ProxyManager) Shutdown() {
 		}(processGroup)
 	}
 	wg.Wait()
+
+	if err := pm.usageTracker.Save(); err != nil {
+		pm.proxyLogger.Errorf("Failed to save usage to %s: %v", pm.config.Usage.File, err)
+	}
+
 	pm.shutdownCancel()
 }
 
+// Drain stops accepting new requests and waits up to drainTimeout for
+// in-flight requests to finish. New requests receive a 503 with Retry-After.
+// It returns false if requests were still running when the wait ended.
+func (pm *ProxyManager) Drain(ctx context.Context) bool {
+	timeout := time.Duration(pm.config.DrainTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pm.drainDeadline.Store(time.Now().Add(timeout).UnixNano())
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		inflight := pm.inflightRequests.Load()
+		if inflight == 0 {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			pm.proxyLogger.Warnf("Drain ended with %d requests in flight", inflight)
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsDraining returns true once Drain has been called
+func (pm *ProxyManager) IsDraining() bool {
+	return pm.drainDeadline.Load() != 0
+}
+
+// beginRequest counts a proxied request until the returned func is called.
+// When draining it responds with a 503 and returns false.
+func (pm *ProxyManager) beginRequest(c *gin.Context) (func(), bool) {
+	// counted before checking so Drain can not miss a request
+	pm.inflightRequests.Add(1)
+	if deadline := pm.drainDeadline.Load(); deadline != 0 {
+		pm.inflightRequests.Add(-1)
+		retryAfter := max(1, int(time.Until(time.Unix(0, deadline)).Seconds()+0.5))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		pm.sendErrorResponse(c, http.StatusServiceUnavailable, "server is shutting down")
+		return nil, false
+	}
+
+	hookDone := pm.hookRunner.TrackRequest()
+	return func() {
+		hookDone()
+		pm.inflightRequests.Add(-1)
+	}, true
+}
+
 func (pm *ProxyManager) swapProcessGroup(requestedModel string) (*ProcessGroup, string, error) {
 	// de-alias the real model name and get a real one
 	realModelName, found := pm.config.RealModelName(requestedModel)
@@ -335,11 +473,12 @@ func (pm *ProxyManager) swapProcessGroup(requestedModel string) (*ProcessGroup,
 		return nil, realModelName, fmt.Errorf("could not find process group for model %s", requestedModel)
 	}
 
-	if processGroup.exclusive {
+	// remote models do not use local resources so other groups keep running
+	if processGroup.exclusive && !pm.config.Models[realModelName].IsRemote() {
 		pm.proxyLogger.Debugf("Exclusive mode for group %s, stopping other process groups", processGroup.id)
 		for groupId, otherGroup := range pm.processGroups {
 			if groupId != processGroup.id && !otherGroup.persistent {
-				otherGroup.StopProcesses(StopWaitForInflightRequest)
+				otherGroup.stopProcesses(StopWaitForInflightRequest, false)
 			}
 		}
 	}
@@ -355,29 +494,26 @@ func (pm *ProxyManager) listModelsHandler(c *gin.Context) {
 		if modelConfig.Unlisted {
 			continue
 		}
+		data = append(data, pm.modelRecord(id, modelConfig, createdTime))
+	}
 
-		record := gin.H{
-			"id":       id,
-			"object":   "model",
-			"created":  createdTime,
-			"owned_by": "llama-swap",
+	// routers are listed as virtual models
+	for id, router := range pm.config.Routers {
+		if router.Unlisted {
+			continue
 		}
+		data = append(data, routerRecord(id, router, createdTime))
+	}
 
-		if name := strings.TrimSpace(modelConfig.Name); name != "" {
-			record["name"] = name
+	// models from peers, requests from peers only see local models to prevent loops
+	if !isPeerRequest(c.Request) {
+		listed := make(map[string]bool, len(data))
+		for _, record := range data {
+			listed[record["id"].(string)] = true
 		}
-		if desc := strings.TrimSpace(modelConfig.Description); desc != "" {
-			record["description"] = desc
+		for _, record := range pm.peerManager.ListModels(listed) {
+			data = append(data, gin.H(record))
 		}
-
-		// Add metadata if present
-		if len(modelConfig.Metadata) > 0 {
-			record["meta"] = gin.H{
-				"llamaswap": modelConfig.Metadata,
-			}
-		}
-
-		data = append(data, record)
 	}
 
 	// Sort by the "id" key
@@ -399,7 +535,91 @@ func (pm *ProxyManager) listModelsHandler(c *gin.Context) {
 	})
 }
 
+// modelRecord returns the /v1/models record of a model. The GGUF header
+// information of the model file is added to meta.llamaswap.gguf.
+func (pm *ProxyManager) modelRecord(id string, modelConfig config.ModelConfig, createdTime int64) gin.H {
+	record := gin.H{
+		"id":       id,
+		"object":   "model",
+		"created":  createdTime,
+		"owned_by": "llama-swap",
+	}
+
+	if name := strings.TrimSpace(modelConfig.Name); name != "" {
+		record["name"] = name
+	}
+	if desc := strings.TrimSpace(modelConfig.Description); desc != "" {
+		record["description"] = desc
+	}
+
+	// copied, the configured metadata is shared by all requests
+	meta := make(gin.H, len(modelConfig.Metadata)+1)
+	for key, value := range modelConfig.Metadata {
+		meta[key] = value
+	}
+
+	modelFile := modelConfig.ModelFile()
+	info, err := pm.modelInfo.Get(modelFile)
+	if err != nil {
+		pm.proxyLogger.Warnf("<%s> Failed to read GGUF header of %s: %v", id, modelFile, err)
+	}
+	if _, configured := meta["gguf"]; info != nil && !configured {
+		meta["gguf"] = info
+	}
+
+	if len(meta) > 0 {
+		record["meta"] = gin.H{
+			"llamaswap": meta,
+		}
+	}
+	return record
+}
+
+// routerRecord returns the /v1/models record of a router, they are listed as
+// virtual models
+func routerRecord(id string, router config.RouterConfig, createdTime int64) gin.H {
+	record := gin.H{
+		"id":       id,
+		"object":   "model",
+		"created":  createdTime,
+		"owned_by": "llama-swap",
+	}
+	if desc := strings.TrimSpace(router.Description); desc != "" {
+		record["description"] = desc
+	}
+	return record
+}
+
+// getModelHandler returns the record of a model or router, unlisted models
+// are included. Models of peers are not.
+func (pm *ProxyManager) getModelHandler(c *gin.Context) {
+	search := strings.TrimPrefix(c.Param("model"), "/")
+	createdTime := time.Now().Unix()
+
+	if origin := c.GetHeader("Origin"); origin != "" {
+		c.Header("Access-Control-Allow-Origin", origin)
+	}
+
+	if modelConfig, id, found := pm.config.FindConfig(search); found {
+		c.JSON(http.StatusOK, pm.modelRecord(id, modelConfig, createdTime))
+		return
+	}
+
+	if router, found := pm.config.Routers[search]; found {
+		c.JSON(http.StatusOK, routerRecord(search, router, createdTime))
+		return
+	}
+
+	pm.sendErrorResponse(c, http.StatusNotFound, fmt.Sprintf("model %s not found", search))
+}
+
 func (pm *ProxyManager) proxyToUpstream(c *gin.Context) {
+	requestDone, ok := pm.beginRequest(c)
+	if !ok {
+		return
+	}
+	defer requestDone()
+
 	upstreamPath := c.Param("upstreamPath")
 
 	// split the upstream path by / and search for the model name
@@ -466,6 +686,12 @@ func (pm *ProxyManager) proxyToUpstream(c *gin.Context) {
 }
 
 func (pm *ProxyManager) proxyOAIHandler(c *gin.Context) {
+	requestDone, ok := pm.beginRequest(c)
+	if !ok {
+		return
+	}
+	defer requestDone()
+
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		pm.sendErrorResponse(c, http.StatusBadRequest, "could not ready request body")
@@ -480,8 +706,52 @@ func (pm *ProxyManager) proxyOAIHandler(c *gin.Context) {
 
 	realModelName, found := pm.config.RealModelName(requestedModel)
 	if !found {
-		pm.sendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("could not find real modelID for %s", requestedModel))
-		return
+		routerID, router, isRouter := pm.config.FindRouter(requestedModel)
+		if !isRouter {
+			// models on peer instances are proxied without changes
+			if peer := pm.findPeer(c.Request, requestedModel); peer != nil {
+				c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+				c.Request.ContentLength = int64(len(bodyBytes))
+				peer.ProxyRequest(c.Writer, c.Request)
+				return
+			}
+
+			pm.sendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("could not find real modelID for %s", requestedModel))
+			return
+		}
+
+		realModelName, err = routeRequest(routerID, router, requestedModel, bodyBytes)
+		if err != nil {
+			pm.sendErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		pm.proxyLogger.Debugf("<%s> router %s sent request to %s", requestedModel, routerID, realModelName)
+		bodyBytes, err = setRoutedModel(c, bodyBytes, realModelName)
+		if err != nil {
+			pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error rewriting model name in JSON: %s", err.Error()))
+			return
+		}
+	}
+
+	// send a percentage of the traffic to candidate models
+	primaryModelName := realModelName
+	if splits := pm.config.Models[realModelName].SplitTraffic; len(splits) > 0 {
+		if target := pickSplitTarget(realModelName, splits, rand.IntN(100)); target != realModelName {
+			pm.proxyLogger.Debugf("<%s> traffic split sent request to %s", realModelName, target)
+			realModelName = target
+			bodyBytes, err = setRoutedModel(c, bodyBytes, realModelName)
+			if err != nil {
+				pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error rewriting model name in JSON: %s", err.Error()))
+				return
+			}
+		}
+	}
+
+	// the shadow model gets the request before the primary's filters are applied
+	var mirrorBody []byte
+	if pm.config.Models[primaryModelName].Mirror.Model != "" {
+		mirrorBody = bytes.Clone(bodyBytes)
 	}
 
 	processGroup, _, err := pm.swapProcessGroup(realModelName)
@@ -500,19 +770,11 @@ func (pm *ProxyManager) proxyOAIHandler(c *gin.Context) {
 		}
 	}
 
-	// issue #174 strip parameters from the JSON body
-	stripParams, err := pm.config.Models[realModelName].Filters.SanitizedStripParams()
-	if err != nil { // just log it and continue
-		pm.proxyLogger.Errorf("Error sanitizing strip params string: %s, %s", pm.config.Models[realModelName].Filters.StripParams, err.Error())
-	} else {
-		for _, param := range stripParams {
-			pm.proxyLogger.Debugf("<%s> stripping param: %s", realModelName, param)
-			bodyBytes, err = sjson.DeleteBytes(bodyBytes, param)
-			if err != nil {
-				pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error deleting parameter %s from request", param))
-				return
-			}
-		}
+	// issue #174 apply request filters to the JSON body
+	bodyBytes, err = pm.applyRequestFilters(realModelName, bodyBytes)
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -522,14 +784,32 @@ func (pm *ProxyManager) proxyOAIHandler(c *gin.Context) {
 	c.Request.Header.Set("content-length", strconv.Itoa(len(bodyBytes)))
 	c.Request.ContentLength = int64(len(bodyBytes))
 
-	if err := processGroup.ProxyRequest(realModelName, c.Writer, c.Request); err != nil {
+	// rewrite <think> tags in the response
+	var responseWriter http.ResponseWriter = c.Writer
+	if mode := pm.config.Models[realModelName].Filters.ThinkTags; mode != "" {
+		thinkWriter := newThinkTagResponseWriter(c.Writer, mode)
+		defer thinkWriter.Finish()
+		responseWriter = thinkWriter
+	}
+
+	if err := processGroup.ProxyRequest(realModelName, responseWriter, c.Request); err != nil {
 		pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error proxying request: %s", err.Error()))
 		pm.proxyLogger.Errorf("Error Proxying Request for processGroup %s and model %s", processGroup.id, realModelName)
 		return
 	}
+
+	if mirrorBody != nil {
+		pm.mirrorRequest(primaryModelName, c.Request, mirrorBody)
+	}
 }
 
 func (pm *ProxyManager) proxyOAIPostFormHandler(c *gin.Context) {
+	requestDone, ok := pm.beginRequest(c)
+	if !ok {
+		return
+	}
+	defer requestDone()
+
 	// Parse multipart form
 	if err := c.Request.ParseMultipartForm(32 << 20); err != nil { // 32MB max memory, larger files go to tmp disk
 		pm.sendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("error parsing multipart form: %s", err.Error()))
@@ -677,6 +957,15 @@ func (pm *ProxyManager) listRunningProcessesHandler(context *gin.Context) {
 	context.JSON(http.StatusOK, response) // Always return 200 OK
 }
 
+// findPeer returns the peer serving a model that is not configured locally.
+// Requests from peers are never forwarded again.
+func (pm *ProxyManager) findPeer(r *http.Request, modelID string) *Peer {
+	if isPeerRequest(r) {
+		return nil
+	}
+	return pm.peerManager.FindPeer(modelID)
+}
+
 func (pm *ProxyManager) findGroupByModelName(modelName string) *ProcessGroup {
 	for _, group := range pm.processGroups {
 		if group.HasMember(modelName) {
@@ -2,11 +2,14 @@ package proxy
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mostlygeek/llama-swap/event"
@@ -28,6 +31,21 @@ func addApiHandlers(pm *ProxyManager) {
 		apiGroup.POST("/models/unload/*model", pm.apiUnloadSingleModelHandler)
 		apiGroup.GET("/events", pm.apiSendEvents)
 		apiGroup.GET("/metrics", pm.apiGetMetrics)
+		apiGroup.GET("/ratelimits", pm.apiGetRateLimits)
+		apiGroup.GET("/usage", pm.apiGetUsage)
+		apiGroup.GET("/mirrors", pm.apiGetMirrors)
+		apiGroup.GET("/peers", pm.apiGetPeers)
+	}
+
+	if len(pm.config.ConfigAPI.APIKeys) > 0 {
+		configGroup := pm.ginEngine.Group("/api/config", pm.configAPIAuth)
+		{
+			configGroup.GET("", pm.apiGetConfig)
+			configGroup.PUT("/models/*model", pm.apiSetModel)
+			configGroup.DELETE("/models/*model", pm.apiDeleteModel)
+			configGroup.PUT("/groups/*group", pm.apiSetGroup)
+			configGroup.DELETE("/groups/*group", pm.apiDeleteGroup)
+		}
 	}
 }
 
@@ -206,6 +224,77 @@ func (pm *ProxyManager) apiGetMetrics(c *gin.Context) {
 	c.Data(http.StatusOK, "application/json", jsonData)
 }
 
+func (pm *ProxyManager) apiGetRateLimits(c *gin.Context) {
+	if pm.rateLimiter == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false, "clients": []ClientUsage{}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "clients": pm.rateLimiter.Usage()})
+}
+
+// apiGetPeers returns the health and models of the configured peers
+func (pm *ProxyManager) apiGetPeers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"peers": pm.peerManager.Status()})
+}
+
+// apiGetMirrors returns the recent output of requests mirrored to shadow models.
+// Results can be filtered with the model and shadow query parameters
+func (pm *ProxyManager) apiGetMirrors(c *gin.Context) {
+	model, shadow := c.Query("model"), c.Query("shadow")
+	captures := make([]MirrorCapture, 0)
+	for _, capture := range pm.mirrorMonitor.GetCaptures() {
+		if (model == "" || capture.Model == model) && (shadow == "" || capture.Shadow == shadow) {
+			captures = append(captures, capture)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"mirrors": captures})
+}
+
+// apiGetUsage returns usage totals per user, per model, per day. Results can be
+// filtered with the from, to, user and model query parameters and exported with format=csv
+func (pm *ProxyManager) apiGetUsage(c *gin.Context) {
+	filter := UsageFilter{
+		From:  c.Query("from"),
+		To:    c.Query("to"),
+		User:  c.Query("user"),
+		Model: c.Query("model"),
+	}
+
+	for _, day := range []string{filter.From, filter.To} {
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse(usageDayFormat, day); err != nil {
+			pm.sendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid date %s, expected YYYY-MM-DD", day))
+			return
+		}
+	}
+
+	records := pm.usageTracker.Records(filter)
+
+	if c.Query("format") == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="llama-swap-usage.csv"`)
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"day", "user", "model", "requests", "input_tokens", "output_tokens", "cache_tokens"})
+		for _, r := range records {
+			w.Write([]string{
+				r.Day,
+				r.User,
+				r.Model,
+				strconv.Itoa(r.Requests),
+				strconv.Itoa(r.InputTokens),
+				strconv.Itoa(r.OutputTokens),
+				strconv.Itoa(r.CachedTokens),
+			})
+		}
+		w.Flush()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": records})
+}
+
 func (pm *ProxyManager) apiUnloadSingleModelHandler(c *gin.Context) {
 	requestedModel := strings.TrimPrefix(c.Param("model"), "/")
 	realModelName, found := pm.config.RealModelName(requestedModel)
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mostlygeek/llama-swap/event"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"gopkg.in/yaml.v3"
+)
+
+// SetConfigEditor enables the /api/config endpoints. They are only registered
+// when configAPI.apiKeys is set.
+func (pm *ProxyManager) SetConfigEditor(editor *config.Editor) {
+	pm.configEditor = editor
+}
+
+// configAPIAuth requires one of the configAPI.apiKeys
+func (pm *ProxyManager) configAPIAuth(c *gin.Context) {
+	apiKey := requestAPIKey(c)
+	for _, key := range pm.config.ConfigAPI.APIKeys {
+		if apiKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+			if pm.configEditor == nil {
+				pm.sendErrorResponse(c, http.StatusServiceUnavailable, "configuration editing is not available")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+	}
+
+	pm.sendErrorResponse(c, http.StatusUnauthorized, "invalid API key")
+	c.Abort()
+}
+
+// apiGetConfig returns the main configuration file with the changes made
+// through the API, as YAML or as JSON with format=json
+func (pm *ProxyManager) apiGetConfig(c *gin.Context) {
+	data := pm.configEditor.Data()
+	if c.Query("format") != "json" {
+		c.Data(http.StatusOK, "application/yaml", data)
+		return
+	}
+
+	var generic any
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error decoding config: %v", err))
+		return
+	}
+	jsonData, err := json.Marshal(generic)
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error encoding config: %v", err))
+		return
+	}
+	c.Data(http.StatusOK, "application/json", jsonData)
+}
+
+func (pm *ProxyManager) apiSetModel(c *gin.Context) {
+	pm.applyConfigChange(c, "model", c.Param("model"), pm.configEditor.SetModel)
+}
+
+func (pm *ProxyManager) apiDeleteModel(c *gin.Context) {
+	pm.applyConfigChange(c, "model", c.Param("model"), func(modelID string, _ []byte) error {
+		return pm.configEditor.DeleteModel(modelID)
+	})
+}
+
+func (pm *ProxyManager) apiSetGroup(c *gin.Context) {
+	pm.applyConfigChange(c, "group", c.Param("group"), pm.configEditor.SetGroup)
+}
+
+func (pm *ProxyManager) apiDeleteGroup(c *gin.Context) {
+	pm.applyConfigChange(c, "group", c.Param("group"), func(groupID string, _ []byte) error {
+		return pm.configEditor.DeleteGroup(groupID)
+	})
+}
+
+// applyConfigChange makes a change with the request body and reloads the
+// configuration. Invalid changes are rejected with the error from loading it.
+func (pm *ProxyManager) applyConfigChange(c *gin.Context, kind, id string, change func(id string, body []byte) error) {
+	id = strings.TrimPrefix(id, "/")
+	if id == "" {
+		pm.sendErrorResponse(c, http.StatusBadRequest, kind+" ID is required")
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("error reading body: %v", err))
+		return
+	}
+
+	if err := change(id, body); err != nil {
+		var pathErr *fs.PathError
+		switch {
+		case errors.Is(err, config.ErrNotInConfigFile):
+			pm.sendErrorResponse(c, http.StatusNotFound, err.Error())
+		case errors.As(err, &pathErr):
+			pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error writing config: %v", err))
+		default:
+			pm.sendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	pm.proxyLogger.Infof("Configuration of %s %s changed through the API, reloading", kind, id)
+	event.Emit(ConfigFileChangedEvent{
+		ReloadingState: ReloadingStateStart,
+	})
+	c.JSON(http.StatusOK, gin.H{"msg": "ok"})
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/event"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyManager_ConfigAPI(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
+logLevel: error
+configAPI:
+  apiKeys: [secret]
+models:
+  # the main model
+  model1:
+    cmd: server --port ${PORT}
+`), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	editor := config.NewEditor(configPath)
+	conf, err := editor.Load()
+	if !assert.NoError(t, err) {
+		return
+	}
+	proxy := New(conf)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	doRequest := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest("GET", "/api/config", "secret", "").Code)
+	proxy.SetConfigEditor(editor)
+
+	assert.Equal(t, http.StatusUnauthorized, doRequest("GET", "/api/config", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, doRequest("GET", "/api/config", "wrong", "").Code)
+
+	w := doRequest("GET", "/api/config", "secret", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "  # the main model\n  model1:\n")
+
+	reloads := make(chan ConfigFileChangedEvent, 10)
+	defer event.On(func(e ConfigFileChangedEvent) {
+		reloads <- e
+	})()
+
+	w = doRequest("PUT", "/api/config/models/org/model2", "secret", `{"cmd": "server --port ${PORT} -m model2.gguf"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	select {
+	case e := <-reloads:
+		assert.Equal(t, ReloadingStateStart, e.ReloadingState)
+	case <-time.After(time.Second):
+		t.Error("expected a reload")
+	}
+
+	w = doRequest("GET", "/api/config?format=json", "secret", "")
+	var shown struct {
+		Models map[string]map[string]any `json:"models"`
+	}
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &shown)) {
+		assert.Equal(t, "server --port ${PORT} -m model2.gguf", shown.Models["org/model2"]["cmd"])
+	}
+
+	w = doRequest("PUT", "/api/config/models/model3", "secret", `{"cmd": "server --port ${PORT} ${nope}"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "unknown macro '${nope}' found in model3.cmd", w.Body.String())
+
+	assert.Equal(t, http.StatusOK, doRequest("PUT", "/api/config/groups/together", "secret", `{"swap": false, "members": ["model1", "org/model2"]}`).Code)
+	assert.Equal(t, http.StatusOK, doRequest("DELETE", "/api/config/groups/together", "secret", "").Code)
+	assert.Equal(t, http.StatusOK, doRequest("DELETE", "/api/config/models/org/model2", "secret", "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest("DELETE", "/api/config/models/org/model2", "secret", "").Code)
+
+	// without writeBack the file is not changed
+	data, _ := os.ReadFile(configPath)
+	assert.NotContains(t, string(data), "together")
+}
+
+func TestProxyManager_ConfigAPIDisabled(t *testing.T) {
+	proxy := New(config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+	}))
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+	proxy.SetConfigEditor(config.NewEditor("config.yaml"))
+
+	req := httptest.NewRequest("GET", "/api/config", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
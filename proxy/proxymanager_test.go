@@ -3,12 +3,16 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -411,6 +415,67 @@ func TestProxyManager_ListModelsHandler_SortedByID(t *testing.T) {
 	}
 }
 
+func TestProxyManager_ModelGGUFMetadata(t *testing.T) {
+	// a GGUF v3 header: no tensors and general.architecture = "llama"
+	var gguf bytes.Buffer
+	gguf.WriteString("GGUF")
+	for _, v := range []any{uint32(3), uint64(0), uint64(1), uint64(20), []byte("general.architecture"), uint32(8), uint64(5), []byte("llama")} {
+		binary.Write(&gguf, binary.LittleEndian, v)
+	}
+	modelFile := filepath.Join(t.TempDir(), "llama.gguf")
+	if !assert.NoError(t, os.WriteFile(modelFile, gguf.Bytes(), 0644)) {
+		return
+	}
+
+	processedConfig, err := config.LoadConfigFromReader(strings.NewReader(`
+logLevel: error
+models:
+  model1:
+    cmd: llama-server --port ${PORT} -m ` + modelFile + `
+    aliases: [llama]
+    metadata:
+      family: llama
+  hidden:
+    cmd: llama-server --port ${PORT}
+    unlisted: true
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	proxy := New(processedConfig)
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "llama", gjson.Get(w.Body.String(), "data.0.meta.llamaswap.family").String())
+	assert.Equal(t, "llama", gjson.Get(w.Body.String(), "data.0.meta.llamaswap.gguf.architecture").String())
+	assert.Equal(t, int64(gguf.Len()), gjson.Get(w.Body.String(), "data.0.meta.llamaswap.gguf.file_size").Int())
+	assert.False(t, gjson.Get(w.Body.String(), "data.0.meta.llamaswap.gguf.has_chat_template").Bool())
+
+	// the configured metadata is not changed
+	assert.NotContains(t, processedConfig.Models["model1"].Metadata, "gguf")
+
+	// model details, by alias and for unlisted models
+	req = httptest.NewRequest("GET", "/v1/models/llama", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "model1", gjson.Get(w.Body.String(), "id").String())
+	assert.Equal(t, "llama", gjson.Get(w.Body.String(), "meta.llamaswap.gguf.architecture").String())
+
+	req = httptest.NewRequest("GET", "/v1/models/hidden", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, gjson.Get(w.Body.String(), "meta").Exists())
+
+	req = httptest.NewRequest("GET", "/v1/models/nope", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestProxyManager_Shutdown(t *testing.T) {
 	// make broken model configurations
 	model1Config := getTestSimpleResponderConfigPort("model1", 9991)
@@ -885,6 +950,47 @@ func TestProxyManager_FiltersStripParams(t *testing.T) {
 	// t.Logf("%v", response)
 }
 
+func TestProxyManager_FiltersSetAndDefaultParams(t *testing.T) {
+	modelConfig := getTestSimpleResponderConfig("model1")
+	modelConfig.Filters = config.ModelFilters{
+		StripParams: "top_k",
+		SetParams: map[string]any{
+			"temperature":                          0.6,
+			"chat_template_kwargs.enable_thinking": false,
+			"model":                                "ignored",
+		},
+		DefaultParams: map[string]any{
+			"top_p": 0.95,
+			"min_p": 0.05,
+		},
+	}
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": modelConfig,
+		},
+	})
+
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+	reqBody := `{"model":"model1","temperature":1.5,"top_p":0.5,"top_k":40}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	w := httptest.NewRecorder()
+
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	requestBody := gjson.Get(w.Body.String(), "request_body").String()
+	assert.Equal(t, "model1", gjson.Get(requestBody, "model").String())
+	assert.Equal(t, 0.6, gjson.Get(requestBody, "temperature").Float())
+	assert.Equal(t, 0.5, gjson.Get(requestBody, "top_p").Float(), "client value is kept for defaultParams")
+	assert.Equal(t, 0.05, gjson.Get(requestBody, "min_p").Float())
+	assert.False(t, gjson.Get(requestBody, "top_k").Exists())
+	assert.Equal(t, "false", gjson.Get(requestBody, "chat_template_kwargs.enable_thinking").Raw)
+}
+
 func TestProxyManager_MiddlewareWritesMetrics_NonStreaming(t *testing.T) {
 	config := config.AddDefaultGroupToConfig(config.Config{
 		HealthCheckTimeout: 15,
@@ -1117,3 +1223,131 @@ func TestProxyManager_ProxiedStreamingEndpointReturnsNoBufferingHeader(t *testin
 	assert.Equal(t, "no", rec.Header().Get("X-Accel-Buffering"))
 	assert.Contains(t, rec.Header().Get("Content-Type"), "text/event-stream")
 }
+
+func TestProxyManager_RemoteModel(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer remote-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"model":%q,"usage":{"prompt_tokens":5,"completion_tokens":7}}`, gjson.GetBytes(body, "model").String())
+	}))
+	defer remote.Close()
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+			"remote": {
+				Proxy:         remote.URL,
+				CheckEndpoint: "none",
+				Headers:       map[string]string{"Authorization": "Bearer remote-key"},
+			},
+		},
+		Groups: map[string]config.GroupConfig{
+			"remotes": {Swap: true, Exclusive: true, Members: []string{"remote"}},
+		},
+	})
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	for _, model := range []string{"model1", "remote"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"`+model+`"}`))
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, model)
+	}
+
+	// the remote model does not unload the local model in the other group
+	assert.Equal(t, StateReady, proxy.findGroupByModelName("model1").processes["model1"].CurrentState())
+	assert.Equal(t, StateReady, proxy.findGroupByModelName("remote").processes["remote"].CurrentState())
+
+	metrics := proxy.metricsMonitor.GetMetrics()
+	if assert.Len(t, metrics, 2) {
+		assert.Equal(t, "remote", metrics[1].Model)
+		assert.Equal(t, 7, metrics[1].OutputTokens)
+	}
+}
+
+func TestProxyManager_Drain(t *testing.T) {
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		DrainTimeout:       10,
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+	})
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	// load the model first so the slow request starts quickly
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	slowDone := make(chan int)
+	go func() {
+		req := httptest.NewRequest("POST", "/v1/chat/completions?wait=1000ms", bytes.NewBufferString(`{"model":"model1"}`))
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		slowDone <- w.Code
+	}()
+	assert.Eventually(t, func() bool {
+		return proxy.inflightRequests.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	drained := make(chan bool)
+	go func() {
+		drained <- proxy.Drain(context.Background())
+	}()
+	assert.Eventually(t, proxy.IsDraining, time.Second, 10*time.Millisecond)
+
+	// new requests are rejected while in-flight requests finish
+	req = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "server is shutting down")
+	retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.InDelta(t, 10, retryAfter, 1)
+
+	req = httptest.NewRequest("GET", "/health", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "draining", w.Body.String())
+
+	assert.Equal(t, http.StatusOK, <-slowDone)
+	assert.True(t, <-drained)
+}
+
+func TestProxyManager_DrainTimeout(t *testing.T) {
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		DrainTimeout:       10,
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+	})
+	proxy := New(config)
+	defer proxy.StopProcesses(StopImmediately)
+
+	go func() {
+		req := httptest.NewRequest("POST", "/v1/chat/completions?wait=2000ms", bytes.NewBufferString(`{"model":"model1"}`))
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	assert.Eventually(t, func() bool {
+		return proxy.inflightRequests.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the wait ends when ctx is done, before drainTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.False(t, proxy.Drain(ctx))
+}
@@ -0,0 +1,269 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+// gin context key where the client identity is stored for other middleware
+const ctxKeyClientID = "llamaswap.clientID"
+
+// RateLimiter tracks request and token usage per client in fixed time windows
+type RateLimiter struct {
+	sync.Mutex
+
+	config  config.RateLimitConfig
+	clients map[string]*clientUsage
+
+	// clients without usage are removed periodically so the map does not grow
+	lastEviction time.Time
+
+	// used for testing to override the current time
+	now func() time.Time
+}
+
+type clientUsage struct {
+	minuteStart time.Time
+	requests    int
+
+	hourStart  time.Time
+	hourTokens int
+
+	dayStart  time.Time
+	dayTokens int
+}
+
+// ClientUsage is the current usage for a single client returned by the API
+type ClientUsage struct {
+	Client             string `json:"client"`
+	RequestsThisMinute int    `json:"requests_this_minute"`
+	TokensThisHour     int    `json:"tokens_this_hour"`
+	TokensThisDay      int    `json:"tokens_this_day"`
+	RequestsPerMinute  int    `json:"requests_per_minute_limit"`
+	TokensPerHour      int    `json:"tokens_per_hour_limit"`
+	TokensPerDay       int    `json:"tokens_per_day_limit"`
+}
+
+func NewRateLimiter(rateLimitConfig config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:  rateLimitConfig,
+		clients: make(map[string]*clientUsage),
+		now:     time.Now,
+	}
+}
+
+// usageFor returns the usage for a client with expired windows reset. Must be called with the lock held.
+func (rl *RateLimiter) usageFor(client string, now time.Time) *clientUsage {
+	rl.evictExpired(now)
+
+	usage, found := rl.clients[client]
+	if !found {
+		usage = &clientUsage{}
+		rl.clients[client] = usage
+	}
+	usage.reset(now)
+	return usage
+}
+
+// evictExpired removes clients without usage in any current window, at most
+// once a minute. Must be called with the lock held.
+func (rl *RateLimiter) evictExpired(now time.Time) {
+	if now.Sub(rl.lastEviction) < time.Minute {
+		return
+	}
+	rl.lastEviction = now
+
+	for client, usage := range rl.clients {
+		usage.reset(now)
+		if usage.requests == 0 && usage.hourTokens == 0 && usage.dayTokens == 0 {
+			delete(rl.clients, client)
+		}
+	}
+}
+
+// reset clears the counters of windows that have ended
+func (u *clientUsage) reset(now time.Time) {
+	if minuteStart := now.Truncate(time.Minute); !u.minuteStart.Equal(minuteStart) {
+		u.minuteStart = minuteStart
+		u.requests = 0
+	}
+	if hourStart := now.Truncate(time.Hour); !u.hourStart.Equal(hourStart) {
+		u.hourStart = hourStart
+		u.hourTokens = 0
+	}
+	if dayStart := now.UTC().Truncate(24 * time.Hour); !u.dayStart.Equal(dayStart) {
+		u.dayStart = dayStart
+		u.dayTokens = 0
+	}
+}
+
+// Allow checks if the client can make another request and counts it if allowed.
+// The returned headers should be set on the response regardless of the result.
+func (rl *RateLimiter) Allow(client string) (bool, time.Duration, http.Header) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	usage := rl.usageFor(client, now)
+	headers := http.Header{}
+
+	allowed := true
+	var retryAfter time.Duration
+
+	if limit := rl.config.RequestsPerMinute; limit > 0 {
+		reset := usage.minuteStart.Add(time.Minute).Sub(now)
+		if usage.requests >= limit {
+			allowed = false
+			retryAfter = max(retryAfter, reset)
+		}
+		headers.Set("x-ratelimit-limit-requests", strconv.Itoa(limit))
+		headers.Set("x-ratelimit-remaining-requests", strconv.Itoa(max(0, limit-usage.requests-1)))
+		headers.Set("x-ratelimit-reset-requests", formatResetSeconds(reset))
+	}
+
+	// report the most restrictive token window
+	tokenLimit, tokenRemaining := 0, -1
+	var tokenReset time.Duration
+	checkTokens := func(limit, used int, reset time.Duration) {
+		if limit <= 0 {
+			return
+		}
+		if used >= limit {
+			allowed = false
+			retryAfter = max(retryAfter, reset)
+		}
+		if remaining := max(0, limit-used); tokenRemaining == -1 || remaining < tokenRemaining {
+			tokenLimit, tokenRemaining, tokenReset = limit, remaining, reset
+		}
+	}
+	checkTokens(rl.config.TokensPerHour, usage.hourTokens, usage.hourStart.Add(time.Hour).Sub(now))
+	checkTokens(rl.config.TokensPerDay, usage.dayTokens, usage.dayStart.Add(24*time.Hour).Sub(now))
+	if tokenRemaining != -1 {
+		headers.Set("x-ratelimit-limit-tokens", strconv.Itoa(tokenLimit))
+		headers.Set("x-ratelimit-remaining-tokens", strconv.Itoa(tokenRemaining))
+		headers.Set("x-ratelimit-reset-tokens", formatResetSeconds(tokenReset))
+	}
+
+	if allowed {
+		usage.requests++
+	} else {
+		headers.Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+0.999)))
+	}
+
+	return allowed, retryAfter, headers
+}
+
+// AddTokens records tokens used by a client after a response has completed
+func (rl *RateLimiter) AddTokens(client string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	usage := rl.usageFor(client, rl.now())
+	usage.hourTokens += tokens
+	usage.dayTokens += tokens
+}
+
+// Usage returns the current usage of every known client sorted by client
+func (rl *RateLimiter) Usage() []ClientUsage {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	rl.evictExpired(now)
+	result := make([]ClientUsage, 0, len(rl.clients))
+	for client, usage := range rl.clients {
+		usage.reset(now)
+		result = append(result, ClientUsage{
+			Client:             client,
+			RequestsThisMinute: usage.requests,
+			TokensThisHour:     usage.hourTokens,
+			TokensThisDay:      usage.dayTokens,
+			RequestsPerMinute:  rl.config.RequestsPerMinute,
+			TokensPerHour:      rl.config.TokensPerHour,
+			TokensPerDay:       rl.config.TokensPerDay,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Client < result[j].Client
+	})
+	return result
+}
+
+func formatResetSeconds(d time.Duration) string {
+	return fmt.Sprintf("%ds", int(d.Seconds()+0.999))
+}
+
+// requestIdentity returns the identity of the client making the request. See
+// config.ClientIdentityValid for the values of keyBy. API keys are hashed so
+// they are never exposed through the API or logs.
+func requestIdentity(c *gin.Context, keyBy string) string {
+	switch {
+	case keyBy == "ip":
+		return c.ClientIP()
+	case strings.HasPrefix(keyBy, "header:"):
+		header := strings.TrimSpace(strings.TrimPrefix(keyBy, "header:"))
+		if value := strings.TrimSpace(c.GetHeader(header)); value != "" {
+			return value
+		}
+		return c.ClientIP()
+	default:
+		if apiKey := requestAPIKey(c); apiKey != "" {
+			hash := sha256.Sum256([]byte(apiKey))
+			return "key-" + hex.EncodeToString(hash[:])[:12]
+		}
+		return c.ClientIP()
+	}
+}
+
+// requestAPIKey returns the x-api-key header, or the Authorization: Bearer token
+func requestAPIKey(c *gin.Context) string {
+	apiKey := strings.TrimSpace(c.GetHeader("x-api-key"))
+	if auth := c.GetHeader("Authorization"); apiKey == "" && len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		apiKey = strings.TrimSpace(auth[7:])
+	}
+	return apiKey
+}
+
+// RateLimitMiddleware rejects requests with a 429 when a client is over its limits
+func RateLimitMiddleware(pm *ProxyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if pm.rateLimiter == nil {
+			c.Next()
+			return
+		}
+
+		client := requestIdentity(c, pm.config.RateLimits.KeyBy)
+		c.Set(ctxKeyClientID, client)
+
+		allowed, retryAfter, headers := pm.rateLimiter.Allow(client)
+		for k, vv := range headers {
+			for _, v := range vv {
+				c.Writer.Header().Set(k, v)
+			}
+		}
+
+		if !allowed {
+			pm.proxyLogger.Infof("Rate limited client %s, retry after %v", client, retryAfter)
+			pm.sendErrorResponse(c, http.StatusTooManyRequests, "rate limit exceeded, retry after "+headers.Get("Retry-After")+" seconds")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_RequestsPerMinute(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 2})
+	now := time.Date(2025, 1, 1, 10, 0, 15, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+
+	allowed, _, headers := rl.Allow("client1")
+	assert.True(t, allowed)
+	assert.Equal(t, "2", headers.Get("x-ratelimit-limit-requests"))
+	assert.Equal(t, "1", headers.Get("x-ratelimit-remaining-requests"))
+
+	allowed, _, _ = rl.Allow("client1")
+	assert.True(t, allowed)
+
+	allowed, retryAfter, headers := rl.Allow("client1")
+	assert.False(t, allowed)
+	assert.Equal(t, 45*time.Second, retryAfter)
+	assert.Equal(t, "45", headers.Get("Retry-After"))
+
+	// other clients are not affected
+	allowed, _, _ = rl.Allow("client2")
+	assert.True(t, allowed)
+
+	// next window resets the count
+	now = now.Add(time.Minute)
+	allowed, _, _ = rl.Allow("client1")
+	assert.True(t, allowed)
+}
+
+func TestRateLimiter_TokenQuotas(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{TokensPerHour: 100, TokensPerDay: 150})
+	now := time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+
+	allowed, _, headers := rl.Allow("client1")
+	assert.True(t, allowed)
+	assert.Equal(t, "100", headers.Get("x-ratelimit-remaining-tokens"))
+
+	rl.AddTokens("client1", 100)
+	allowed, retryAfter, _ := rl.Allow("client1")
+	assert.False(t, allowed)
+	assert.Equal(t, 30*time.Minute, retryAfter)
+
+	// hourly window resets but the daily quota still applies
+	now = now.Add(time.Hour)
+	allowed, _, headers = rl.Allow("client1")
+	assert.True(t, allowed)
+	assert.Equal(t, "50", headers.Get("x-ratelimit-remaining-tokens"))
+
+	rl.AddTokens("client1", 50)
+	allowed, _, _ = rl.Allow("client1")
+	assert.False(t, allowed)
+
+	usage := rl.Usage()
+	if assert.Len(t, usage, 1) {
+		assert.Equal(t, "client1", usage[0].Client)
+		assert.Equal(t, 50, usage[0].TokensThisHour)
+		assert.Equal(t, 150, usage[0].TokensThisDay)
+	}
+}
+
+func TestRateLimiter_EvictsExpiredClients(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 10, TokensPerHour: 100})
+	now := time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+
+	rl.Allow("client1")
+	rl.Allow("client2")
+	rl.AddTokens("client2", 10)
+
+	// client1 has no usage in the current windows, client2 still has tokens this hour
+	now = now.Add(2 * time.Minute)
+	rl.Allow("client3")
+	assert.Len(t, rl.clients, 2)
+	assert.NotContains(t, rl.clients, "client1")
+
+	// the tokens count for the day until it ends
+	now = now.Add(24 * time.Hour)
+	assert.Empty(t, rl.Usage())
+	assert.Empty(t, rl.clients)
+}
+
+func TestProxyManager_RateLimitTooManyRequests(t *testing.T) {
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+		LogLevel: "error",
+		RateLimits: config.RateLimitConfig{
+			RequestsPerMinute: 1,
+			TokensPerHour:     1000,
+		},
+	})
+
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	doRequest := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doRequest("key1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("x-ratelimit-limit-requests"))
+
+	w = doRequest("key1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// a different API key has its own limits
+	w = doRequest("key2")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// tokens used by the simple-responder are tracked per client
+	req := httptest.NewRequest("GET", "/api/ratelimits", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Enabled bool          `json:"enabled"`
+		Clients []ClientUsage `json:"clients"`
+	}
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response)) {
+		assert.True(t, response.Enabled)
+		if assert.Len(t, response.Clients, 2) {
+			assert.Equal(t, 35, response.Clients[0].TokensThisHour)
+			assert.Contains(t, response.Clients[0].Client, "key-")
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// applyRequestFilters applies the model's filters to the JSON request body.
+// Parameters are stripped first, then defaultParams fill in missing keys and
+// finally setParams override whatever the client sent.
+func (pm *ProxyManager) applyRequestFilters(modelID string, bodyBytes []byte) ([]byte, error) {
+	filters := pm.config.Models[modelID].Filters
+
+	stripParams, err := filters.SanitizedStripParams()
+	if err != nil { // just log it and continue
+		pm.proxyLogger.Errorf("Error sanitizing strip params string: %s, %s", filters.StripParams, err.Error())
+	} else {
+		for _, param := range stripParams {
+			pm.proxyLogger.Debugf("<%s> stripping param: %s", modelID, param)
+			bodyBytes, err = sjson.DeleteBytes(bodyBytes, param)
+			if err != nil {
+				return nil, fmt.Errorf("error deleting parameter %s from request", param)
+			}
+		}
+	}
+
+	for _, param := range config.SanitizedParamKeys(filters.DefaultParams) {
+		if gjson.GetBytes(bodyBytes, param).Exists() {
+			continue
+		}
+		pm.proxyLogger.Debugf("<%s> setting default param: %s", modelID, param)
+		bodyBytes, err = sjson.SetBytes(bodyBytes, param, filters.DefaultParams[param])
+		if err != nil {
+			return nil, fmt.Errorf("error setting default parameter %s in request", param)
+		}
+	}
+
+	for _, param := range config.SanitizedParamKeys(filters.SetParams) {
+		pm.proxyLogger.Debugf("<%s> setting param: %s", modelID, param)
+		bodyBytes, err = sjson.SetBytes(bodyBytes, param, filters.SetParams[param])
+		if err != nil {
+			return nil, fmt.Errorf("error setting parameter %s in request", param)
+		}
+	}
+
+	if filters.HasMessageFilters() {
+		bodyBytes, err = applyMessageFilters(filters, bodyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error filtering messages: %s", err.Error())
+		}
+	}
+
+	return bodyBytes, nil
+}
+
+// applyMessageFilters rewrites the chat messages array. Requests without a
+// messages array are returned unchanged.
+func applyMessageFilters(filters config.ModelFilters, bodyBytes []byte) ([]byte, error) {
+	messagesResult := gjson.GetBytes(bodyBytes, "messages")
+	if !messagesResult.IsArray() {
+		return bodyBytes, nil
+	}
+
+	var messages []map[string]any
+	if err := json.Unmarshal([]byte(messagesResult.Raw), &messages); err != nil {
+		return nil, err
+	}
+
+	for i, message := range messages {
+		if message == nil {
+			return nil, fmt.Errorf("messages[%d] is not an object", i)
+		}
+	}
+
+	if filters.MergeSystemMessages {
+		messages = mergeSystemMessages(messages)
+	}
+
+	if filters.PrependSystemPrompt != "" || filters.AppendSystemPrompt != "" {
+		if len(messages) > 0 && messages[0]["role"] == "system" {
+			text := messageText(messages[0]["content"])
+			if filters.PrependSystemPrompt != "" {
+				text = joinNonEmpty(filters.PrependSystemPrompt, text)
+			}
+			if filters.AppendSystemPrompt != "" {
+				text = joinNonEmpty(text, filters.AppendSystemPrompt)
+			}
+			messages[0]["content"] = text
+		} else {
+			text := joinNonEmpty(filters.PrependSystemPrompt, filters.AppendSystemPrompt)
+			messages = append([]map[string]any{{"role": "system", "content": text}}, messages...)
+		}
+	}
+
+	if filters.StripImages {
+		for _, message := range messages {
+			if parts, ok := message["content"].([]any); ok {
+				message["content"] = stripImageParts(parts)
+			}
+		}
+	}
+
+	for _, replacement := range filters.ReplaceContent {
+		re, err := replacement.Regexp()
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			role, _ := message["role"].(string)
+			if len(replacement.Roles) > 0 && !slices.Contains(replacement.Roles, role) {
+				continue
+			}
+			message["content"] = replaceInContent(message["content"], re, replacement.Replacement)
+		}
+	}
+
+	newMessages, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	return sjson.SetRawBytes(bodyBytes, "messages", newMessages)
+}
+
+// mergeSystemMessages combines all system messages into a single system
+// message at the start, some chat templates reject multiple system messages
+func mergeSystemMessages(messages []map[string]any) []map[string]any {
+	var systemTexts []string
+	others := make([]map[string]any, 0, len(messages))
+	for _, message := range messages {
+		if message["role"] == "system" {
+			if text := messageText(message["content"]); text != "" {
+				systemTexts = append(systemTexts, text)
+			}
+		} else {
+			others = append(others, message)
+		}
+	}
+
+	if len(systemTexts) == 0 {
+		return others
+	}
+
+	merged := map[string]any{"role": "system", "content": strings.Join(systemTexts, "\n\n")}
+	return append([]map[string]any{merged}, others...)
+}
+
+// messageText returns the text of a message's content, which is either a
+// string or an array of content parts
+func messageText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var texts []string
+		for _, part := range v {
+			if p, ok := part.(map[string]any); ok && p["type"] == "text" {
+				if text, ok := p["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	default:
+		return ""
+	}
+}
+
+// stripImageParts removes image content parts for text only models
+func stripImageParts(parts []any) any {
+	kept := make([]any, 0, len(parts))
+	for _, part := range parts {
+		if p, ok := part.(map[string]any); ok {
+			switch p["type"] {
+			case "image_url", "input_image", "image":
+				continue
+			}
+		}
+		kept = append(kept, part)
+	}
+
+	if len(kept) == 0 {
+		return ""
+	}
+	return kept
+}
+
+// replaceInContent replaces regex matches in string content and text parts
+func replaceInContent(content any, re *regexp.Regexp, replacement string) any {
+	switch v := content.(type) {
+	case string:
+		return re.ReplaceAllString(v, replacement)
+	case []any:
+		for _, part := range v {
+			if p, ok := part.(map[string]any); ok && p["type"] == "text" {
+				if text, ok := p["text"].(string); ok {
+					p["text"] = re.ReplaceAllString(text, replacement)
+				}
+			}
+		}
+		return v
+	default:
+		return content
+	}
+}
+
+func joinNonEmpty(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "\n\n" + b
+}
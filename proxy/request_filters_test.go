@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestApplyMessageFilters(t *testing.T) {
+	body := []byte(`{"model":"m1","messages":[
+		{"role":"system","content":"be brief"},
+		{"role":"user","content":[{"type":"text","text":"what is in this image? secret-123"},{"type":"image_url","image_url":{"url":"data:..."}}]},
+		{"role":"system","content":[{"type":"text","text":"answer in english"}]},
+		{"role":"assistant","content":"secret-456"}
+	]}`)
+
+	filters := config.ModelFilters{
+		MergeSystemMessages: true,
+		PrependSystemPrompt: "You are a helpful assistant.",
+		AppendSystemPrompt:  "/no_think",
+		StripImages:         true,
+		ReplaceContent: []config.ContentReplacement{
+			{Pattern: `secret-\d+`, Replacement: "[redacted]", Roles: []string{"user"}},
+		},
+	}
+
+	result, err := applyMessageFilters(filters, body)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	messages := gjson.GetBytes(result, "messages").Array()
+	if !assert.Len(t, messages, 3) {
+		return
+	}
+
+	assert.Equal(t, "system", messages[0].Get("role").String())
+	assert.Equal(t, "You are a helpful assistant.\n\nbe brief\n\nanswer in english\n\n/no_think", messages[0].Get("content").String())
+
+	assert.Equal(t, "user", messages[1].Get("role").String())
+	assert.Len(t, messages[1].Get("content").Array(), 1, "image part removed")
+	assert.Equal(t, "what is in this image? [redacted]", messages[1].Get("content.0.text").String())
+
+	assert.Equal(t, "secret-456", messages[2].Get("content").String(), "role not matched")
+	assert.Equal(t, "m1", gjson.GetBytes(result, "model").String())
+}
+
+func TestApplyMessageFilters_InsertsSystemPrompt(t *testing.T) {
+	body := []byte(`{"messages":[{"role":"user","content":"hi"}]}`)
+	result, err := applyMessageFilters(config.ModelFilters{AppendSystemPrompt: "be nice"}, body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `[{"content":"be nice","role":"system"},{"content":"hi","role":"user"}]`, gjson.GetBytes(result, "messages").Raw)
+	}
+
+	// requests without messages are not changed
+	body = []byte(`{"prompt":"hi"}`)
+	result, err = applyMessageFilters(config.ModelFilters{AppendSystemPrompt: "be nice"}, body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(body), string(result))
+	}
+}
+
+func TestApplyMessageFilters_InvalidMessages(t *testing.T) {
+	filters := config.ModelFilters{
+		ReplaceContent: []config.ContentReplacement{{Pattern: "a", Replacement: "b"}},
+	}
+
+	_, err := applyMessageFilters(filters, []byte(`{"messages":[{"role":"user","content":"a"},null]}`))
+	assert.EqualError(t, err, "messages[1] is not an object")
+
+	_, err = applyMessageFilters(filters, []byte(`{"messages":["a"]}`))
+	assert.Error(t, err)
+}
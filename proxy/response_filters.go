@@ -0,0 +1,324 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// thinkTagParser splits text into content and reasoning based on <think> tags.
+// Tags can be split across multiple calls to process, as they are when streaming.
+type thinkTagParser struct {
+	inThink bool
+
+	// text at the end of the last call that may be the start of a tag
+	pending string
+
+	// trim newlines that follow a closing tag
+	trimContent bool
+}
+
+// process returns the content and reasoning found in text
+func (p *thinkTagParser) process(text string) (content string, reasoning string) {
+	var contentBuf, reasoningBuf strings.Builder
+	emit := func(s string) {
+		if p.inThink {
+			reasoningBuf.WriteString(s)
+			return
+		}
+		if p.trimContent {
+			s = strings.TrimLeft(s, "\r\n")
+			if s != "" {
+				p.trimContent = false
+			}
+		}
+		contentBuf.WriteString(s)
+	}
+
+	s := p.pending + text
+	p.pending = ""
+	for {
+		tag := thinkOpenTag
+		if p.inThink {
+			tag = thinkCloseTag
+		}
+
+		if idx := strings.Index(s, tag); idx >= 0 {
+			emit(s[:idx])
+			s = s[idx+len(tag):]
+			p.inThink = !p.inThink
+			p.trimContent = !p.inThink
+			continue
+		}
+
+		// hold back a suffix that could be the start of the tag
+		hold := 0
+		for i := min(len(tag)-1, len(s)); i > 0; i-- {
+			if strings.HasSuffix(s, tag[:i]) {
+				hold = i
+				break
+			}
+		}
+		emit(s[:len(s)-hold])
+		p.pending = s[len(s)-hold:]
+		break
+	}
+
+	return contentBuf.String(), reasoningBuf.String()
+}
+
+// flush returns any held back text at the end of the response
+func (p *thinkTagParser) flush() (content string, reasoning string) {
+	pending := p.pending
+	p.pending = ""
+	if p.inThink {
+		return "", pending
+	}
+	return pending, ""
+}
+
+// ThinkTagResponseWriter moves <think>...</think> text out of the chat completion
+// content. With mode "extract" it is moved into reasoning_content, with mode "strip"
+// it is removed. Streaming (SSE) and non-streaming JSON responses are supported.
+// Like MetricsResponseWriter it intercepts the upstream response on its way to the client.
+type ThinkTagResponseWriter struct {
+	gin.ResponseWriter
+	mode string
+
+	// set in WriteHeader based on the upstream response
+	wroteHeader bool
+	streaming   bool
+	passthrough bool
+
+	// streaming: incomplete line, non-streaming: the whole body
+	buf []byte
+
+	// parser per choice index
+	parsers map[int64]*thinkTagParser
+
+	// the last streamed chunk, the template for releasing held back text
+	lastChunk []byte
+}
+
+func newThinkTagResponseWriter(w gin.ResponseWriter, mode string) *ThinkTagResponseWriter {
+	return &ThinkTagResponseWriter{
+		ResponseWriter: w,
+		mode:           mode,
+		parsers:        make(map[int64]*thinkTagParser),
+	}
+}
+
+func (w *ThinkTagResponseWriter) WriteHeader(statusCode int) {
+	w.wroteHeader = true
+	contentType := strings.ToLower(w.Header().Get("Content-Type"))
+	switch {
+	case statusCode != http.StatusOK:
+		w.passthrough = true
+	case strings.Contains(contentType, "text/event-stream"):
+		w.streaming = true
+	case strings.Contains(contentType, "application/json"):
+	default:
+		w.passthrough = true
+	}
+
+	if !w.passthrough {
+		// the body length changes
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *ThinkTagResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if !w.streaming {
+		return len(b), nil
+	}
+
+	// only write out complete lines
+	idx := bytes.LastIndexByte(w.buf, '\n')
+	if idx < 0 {
+		return len(b), nil
+	}
+	lines := w.buf[:idx+1]
+	w.buf = append([]byte(nil), w.buf[idx+1:]...)
+
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		out.Write(w.filterSSELine(line))
+	}
+	if _, err := w.ResponseWriter.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Finish writes out any buffered data and must be called after the upstream
+// response is complete
+func (w *ThinkTagResponseWriter) Finish() {
+	if w.passthrough {
+		return
+	}
+
+	if w.streaming {
+		// upstream may end the stream without a finish_reason or [DONE]
+		w.ResponseWriter.Write(append(w.filterSSELine(w.buf), w.flushChunk()...))
+	} else if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.filterJSONBody(w.buf))
+	}
+	w.buf = nil
+}
+
+// flushChunk returns an SSE event with the text the parsers still hold back,
+// or nil when there is none
+func (w *ThinkTagResponseWriter) flushChunk() []byte {
+	indexes := make([]int64, 0, len(w.parsers))
+	for index := range w.parsers {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+
+	var choices []any
+	for _, index := range indexes {
+		content, reasoning := w.parsers[index].flush()
+		delta := map[string]string{}
+		if content != "" {
+			delta["content"] = content
+		}
+		if w.mode == "extract" && reasoning != "" {
+			delta["reasoning_content"] = reasoning
+		}
+		if len(delta) > 0 {
+			choices = append(choices, map[string]any{"index": index, "delta": delta, "finish_reason": nil})
+		}
+	}
+	if len(choices) == 0 {
+		return nil
+	}
+
+	chunk := []byte("{}")
+	if w.lastChunk != nil {
+		chunk = slices.Clone(w.lastChunk)
+	}
+	chunk, _ = sjson.DeleteBytes(chunk, "usage")
+	chunk, _ = sjson.SetBytes(chunk, "choices", choices)
+	return []byte("data: " + string(chunk) + "\n\n")
+}
+
+func (w *ThinkTagResponseWriter) parser(index int64) *thinkTagParser {
+	p, found := w.parsers[index]
+	if !found {
+		p = &thinkTagParser{}
+		w.parsers[index] = p
+	}
+	return p
+}
+
+// filterSSELine rewrites the content of a single `data: {...}` line
+func (w *ThinkTagResponseWriter) filterSSELine(line []byte) []byte {
+	prefix := []byte("data:")
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, prefix) {
+		return line
+	}
+
+	data := bytes.TrimSpace(trimmed[len(prefix):])
+	if string(data) == "[DONE]" {
+		// the end of the stream, release anything held back
+		return append(w.flushChunk(), line...)
+	}
+	if !gjson.ValidBytes(data) {
+		return line
+	}
+	if gjson.GetBytes(data, "choices").IsArray() {
+		w.lastChunk = append(w.lastChunk[:0], data...)
+	}
+
+	changed := false
+	for i, choice := range gjson.GetBytes(data, "choices").Array() {
+		parser := w.parser(choice.Get("index").Int())
+		contentPath := "choices." + strconv.Itoa(i) + ".delta.content"
+		reasoningPath := "choices." + strconv.Itoa(i) + ".delta.reasoning_content"
+
+		contentResult := choice.Get("delta.content")
+		content, reasoning := "", ""
+		if contentResult.Type == gjson.String {
+			content, reasoning = parser.process(contentResult.String())
+		}
+
+		// the last chunk of the choice, release anything held back
+		if finish := choice.Get("finish_reason"); finish.Exists() && finish.Type != gjson.Null {
+			c, r := parser.flush()
+			content += c
+			reasoning += r
+		}
+
+		if contentResult.Type != gjson.String && content == "" && reasoning == "" {
+			continue
+		}
+
+		data, _ = sjson.SetBytes(data, contentPath, content)
+		if w.mode == "extract" && reasoning != "" {
+			existing := choice.Get("delta.reasoning_content").String()
+			data, _ = sjson.SetBytes(data, reasoningPath, existing+reasoning)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return line
+	}
+
+	var out bytes.Buffer
+	out.WriteString("data: ")
+	out.Write(data)
+	if bytes.HasSuffix(line, []byte("\n")) {
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+// filterJSONBody rewrites message.content in a non-streaming response
+func (w *ThinkTagResponseWriter) filterJSONBody(body []byte) []byte {
+	if !gjson.ValidBytes(body) {
+		return body
+	}
+
+	for i, choice := range gjson.GetBytes(body, "choices").Array() {
+		contentResult := choice.Get("message.content")
+		if contentResult.Type != gjson.String {
+			continue
+		}
+
+		parser := &thinkTagParser{}
+		content, reasoning := parser.process(contentResult.String())
+		c, r := parser.flush()
+		content += c
+		reasoning += r
+
+		body, _ = sjson.SetBytes(body, "choices."+strconv.Itoa(i)+".message.content", content)
+		if w.mode == "extract" && reasoning != "" {
+			existing := choice.Get("message.reasoning_content").String()
+			body, _ = sjson.SetBytes(body, "choices."+strconv.Itoa(i)+".message.reasoning_content", existing+reasoning)
+		}
+	}
+
+	return body
+}
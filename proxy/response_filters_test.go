@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestThinkTagParser_SplitTags(t *testing.T) {
+	// tags split across chunks like they are when streaming
+	chunks := []string{"<thi", "nk>let me", " think</th", "ink>\n\nThe answer", " is <", "42"}
+
+	parser := &thinkTagParser{}
+	var content, reasoning strings.Builder
+	for _, chunk := range chunks {
+		c, r := parser.process(chunk)
+		content.WriteString(c)
+		reasoning.WriteString(r)
+	}
+	c, r := parser.flush()
+	content.WriteString(c)
+	reasoning.WriteString(r)
+
+	assert.Equal(t, "The answer is <42", content.String())
+	assert.Equal(t, "let me think", reasoning.String())
+}
+
+func TestThinkTagResponseWriter_Streaming(t *testing.T) {
+	for _, mode := range []string{"extract", "strip"} {
+		t.Run(mode, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			w := newThinkTagResponseWriter(c.Writer, mode)
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Content-Length", "1234")
+			w.WriteHeader(http.StatusOK)
+
+			// SSE data split in the middle of lines and tags
+			w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"<think>hmm</thi"}}]}` + "\n\ndata: {\"choices\""))
+			w.Write([]byte(`:[{"index":0,"delta":{"content":"nk>\n\nhello"}}]}` + "\n\n"))
+			w.Write([]byte(`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"completion_tokens":3}}` + "\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+			w.Finish()
+
+			assert.Empty(t, rec.Header().Get("Content-Length"))
+
+			var content, reasoning strings.Builder
+			for _, line := range strings.Split(rec.Body.String(), "\n") {
+				data := strings.TrimPrefix(line, "data: ")
+				if !gjson.Valid(data) {
+					continue
+				}
+				content.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+				reasoning.WriteString(gjson.Get(data, "choices.0.delta.reasoning_content").String())
+			}
+
+			assert.Equal(t, "hello", content.String())
+			if mode == "extract" {
+				assert.Equal(t, "hmm", reasoning.String())
+			} else {
+				assert.Empty(t, reasoning.String())
+			}
+			assert.Contains(t, rec.Body.String(), `"usage":{"completion_tokens":3}`)
+			assert.Contains(t, rec.Body.String(), "data: [DONE]\n\n")
+		})
+	}
+}
+
+func TestThinkTagResponseWriter_StreamEndsWithoutFinishReason(t *testing.T) {
+	for _, done := range []bool{true, false} {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		w := newThinkTagResponseWriter(c.Writer, "extract")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`data: {"id":"1","choices":[{"index":0,"delta":{"content":"a <"}}]}` + "\n\n"))
+		if done {
+			w.Write([]byte("data: [DONE]\n\n"))
+		}
+		w.Finish()
+
+		var content strings.Builder
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			data := strings.TrimPrefix(line, "data: ")
+			if gjson.Valid(data) {
+				content.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+			}
+		}
+		assert.Equal(t, "a <", content.String())
+		if done {
+			assert.True(t, strings.HasSuffix(rec.Body.String(), "data: [DONE]\n\n"))
+		}
+	}
+}
+
+func TestThinkTagResponseWriter_NonStreaming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	w := newThinkTagResponseWriter(c.Writer, "extract")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant",`))
+	w.Write([]byte(`"content":"<think>reasoning here</think>\nanswer"}}]}`))
+	w.Finish()
+
+	assert.Equal(t, "answer", gjson.Get(rec.Body.String(), "choices.0.message.content").String())
+	assert.Equal(t, "reasoning here", gjson.Get(rec.Body.String(), "choices.0.message.reasoning_content").String())
+}
+
+func TestThinkTagResponseWriter_ErrorsPassThrough(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	w := newThinkTagResponseWriter(c.Writer, "strip")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`{"error":"<think>"}`))
+	w.Finish()
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, `{"error":"<think>"}`, rec.Body.String())
+}
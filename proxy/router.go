@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// header reporting the model a routed request was sent to
+	headerRoutedModel = "X-Llama-Swap-Model"
+
+	// set in the gin context when a request was routed, see MetricsMiddleware
+	ctxKeyRoutedModel = "llamaswap.routedModel"
+)
+
+// requestFeatures are the properties of a request body that routing rules match on
+type requestFeatures struct {
+	model        string
+	hasImages    bool
+	hasTools     bool
+	promptTokens int
+}
+
+func newRequestFeatures(requestedModel string, body []byte) requestFeatures {
+	features := requestFeatures{model: requestedModel}
+
+	tools := gjson.GetBytes(body, "tools")
+	functions := gjson.GetBytes(body, "functions")
+	features.hasTools = len(tools.Array()) > 0 || len(functions.Array()) > 0
+
+	promptChars := 0
+	for _, message := range gjson.GetBytes(body, "messages").Array() {
+		content := message.Get("content")
+		if content.Type == gjson.String {
+			promptChars += len(content.String())
+			continue
+		}
+		for _, part := range content.Array() {
+			switch part.Get("type").String() {
+			case "image_url", "input_image":
+				features.hasImages = true
+			case "text":
+				promptChars += len(part.Get("text").String())
+			}
+		}
+	}
+
+	// /v1/completions style prompts
+	prompt := gjson.GetBytes(body, "prompt")
+	if prompt.Type == gjson.String {
+		promptChars += len(prompt.String())
+	} else {
+		for _, p := range prompt.Array() {
+			promptChars += len(p.String())
+		}
+	}
+
+	// a rough estimate, good enough to pick a model with a larger context
+	features.promptTokens = promptChars / 4
+	return features
+}
+
+func (f requestFeatures) matches(rule config.RouteRule) bool {
+	if rule.HasImages != nil && *rule.HasImages != f.hasImages {
+		return false
+	}
+	if rule.HasTools != nil && *rule.HasTools != f.hasTools {
+		return false
+	}
+	if rule.MinPromptTokens > 0 && f.promptTokens < rule.MinPromptTokens {
+		return false
+	}
+	if rule.ModelPrefix != "" && !strings.HasPrefix(f.model, rule.ModelPrefix) {
+		return false
+	}
+	return true
+}
+
+// routeRequest returns the real model ID the router sends the request to
+func routeRequest(routerID string, router config.RouterConfig, requestedModel string, body []byte) (string, error) {
+	features := newRequestFeatures(requestedModel, body)
+	for _, rule := range router.Rules {
+		if features.matches(rule) {
+			return rule.Model, nil
+		}
+	}
+
+	if router.Default != "" {
+		return router.Default, nil
+	}
+	return "", fmt.Errorf("router %s: no rule matched the request", routerID)
+}
+
+// setRoutedModel sends the request to model instead of the requested model. The
+// model is reported to the client and used for metrics.
+func setRoutedModel(c *gin.Context, body []byte, model string) ([]byte, error) {
+	c.Set(ctxKeyRoutedModel, model)
+	c.Header(headerRoutedModel, model)
+
+	// upstream gets the real model ID unless useModelName overrides it
+	return sjson.SetBytes(body, "model", model)
+}
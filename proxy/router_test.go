@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestRouteRequest_Rules(t *testing.T) {
+	yes := true
+	router := config.RouterConfig{
+		Rules: []config.RouteRule{
+			{Model: "vision", HasImages: &yes},
+			{Model: "tools", HasTools: &yes},
+			{Model: "long", MinPromptTokens: 100},
+			{Model: "coder", ModelPrefix: "auto-code"},
+		},
+		Default: "small",
+	}
+
+	longPrompt := strings.Repeat("a", 400)
+	tests := []struct {
+		name     string
+		model    string
+		body     string
+		expected string
+	}{
+		{"images", "auto", `{"messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"data:..."}}]}]}`, "vision"},
+		{"tools", "auto", `{"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function"}]}`, "tools"},
+		{"empty tools", "auto", `{"messages":[{"role":"user","content":"hi"}],"tools":[]}`, "small"},
+		{"long prompt", "auto", `{"messages":[{"role":"user","content":"` + longPrompt + `"}]}`, "long"},
+		{"long completion prompt", "auto", `{"prompt":"` + longPrompt + `"}`, "long"},
+		{"model prefix", "auto-coder", `{"messages":[{"role":"user","content":"hi"}]}`, "coder"},
+		{"default", "auto", `{"messages":[{"role":"user","content":"hi"}]}`, "small"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := routeRequest("auto", router, tt.model, []byte(tt.body))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, model)
+		})
+	}
+
+	router.Default = ""
+	_, err := routeRequest("auto", router, "auto", []byte(`{"messages":[]}`))
+	assert.EqualError(t, err, "router auto: no rule matched the request")
+}
+
+func TestProxyManager_RouterSelectsModel(t *testing.T) {
+	yes := true
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+			"model2": getTestSimpleResponderConfig("model2"),
+		},
+		Routers: map[string]config.RouterConfig{
+			"auto": {
+				Rules:   []config.RouteRule{{Model: "model2", HasTools: &yes}},
+				Default: "model1",
+			},
+		},
+	})
+
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`{"model":"auto","messages":[{"role":"user","content":"hi"}]}`, "model1"},
+		{`{"model":"auto","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function"}]}`, "model2"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(tt.body))
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		if !assert.Equal(t, http.StatusOK, w.Code) {
+			continue
+		}
+
+		assert.Equal(t, tt.expected, w.Header().Get(headerRoutedModel))
+		assert.Equal(t, tt.expected, gjson.Get(w.Body.String(), "responseMessage").String())
+		requestBody := gjson.Get(w.Body.String(), "request_body").String()
+		assert.Equal(t, tt.expected, gjson.Get(requestBody, "model").String())
+	}
+
+	// metrics are recorded against the real model
+	metrics := proxy.metricsMonitor.GetMetrics()
+	if assert.Len(t, metrics, 2) {
+		assert.Equal(t, "model1", metrics[0].Model)
+		assert.Equal(t, "model2", metrics[1].Model)
+	}
+
+	// routers are listed as models
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Contains(t, gjson.Get(w.Body.String(), "data.#.id").String(), `"auto"`)
+}
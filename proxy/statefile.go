@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/event"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+// ProcessRecord is a running upstream process saved in the state file
+type ProcessRecord struct {
+	Model      string `json:"model"`
+	PID        int    `json:"pid"`
+	Proxy      string `json:"proxy"`
+	Port       int    `json:"port,omitempty"`
+	Program    string `json:"program"`
+	ConfigHash string `json:"config_hash"`
+}
+
+// processConfigHash identifies the settings a process was started with. A
+// process is only adopted when its model's hash has not changed.
+func processConfigHash(modelConfig config.ModelConfig) string {
+	h := sha256.New()
+	for _, value := range append([]string{modelConfig.Cmd, modelConfig.CmdStop, modelConfig.Proxy}, modelConfig.Env...) {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// processLogPath is where the output of a model's process is written when
+// the state file is enabled, next to the state file
+func processLogPath(stateFile, modelID string) string {
+	return filepath.Join(filepath.Dir(stateFile), "llama-swap-"+unsafeFileChars.ReplaceAllString(modelID, "_")+".log")
+}
+
+func readStateFile(file string) ([]ProcessRecord, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state struct {
+		Processes []ProcessRecord `json:"processes"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state.Processes, nil
+}
+
+func writeStateFile(file string, records []ProcessRecord) error {
+	data, err := json.MarshalIndent(map[string]any{"processes": records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(file, data)
+}
+
+// processStateFile keeps the state file in sync with the running processes
+type processStateFile struct {
+	sync.Mutex
+	file string
+}
+
+// setupStateFile sends upstream output to log files, adopts the processes in
+// the state file and keeps the file updated as processes start and stop
+func (pm *ProxyManager) setupStateFile() {
+	pm.stateFile = &processStateFile{file: pm.config.StateFile}
+
+	for _, processGroup := range pm.processGroups {
+		for modelID, process := range processGroup.processes {
+			if !process.config.IsRemote() {
+				process.logFile = processLogPath(pm.config.StateFile, modelID)
+			}
+		}
+	}
+
+	pm.adoptProcesses()
+	pm.saveProcessState()
+
+	cancel := event.On(func(e ProcessStateChangeEvent) {
+		if e.NewState != StateReady && e.NewState != StateStopped {
+			return
+		}
+		if _, found := pm.config.Models[e.ProcessName]; found {
+			pm.saveProcessState()
+		}
+	})
+	go func() {
+		<-pm.shutdownCtx.Done()
+		cancel()
+	}()
+}
+
+// adoptProcesses re-adopts live processes from the state file whose config
+// has not changed. Other live processes from the file are stopped.
+func (pm *ProxyManager) adoptProcesses() {
+	records, err := readStateFile(pm.config.StateFile)
+	if err != nil {
+		pm.proxyLogger.Errorf("Failed to read state file %s: %v", pm.config.StateFile, err)
+		return
+	}
+
+	for _, record := range records {
+		if !processAlive(record.PID) {
+			continue
+		}
+
+		if !commandMatches(record.PID, record.Program) {
+			// the pid was reused by another program, leave it alone
+			continue
+		}
+
+		modelConfig, found := pm.config.Models[record.Model]
+		reason := ""
+		processGroup := pm.findGroupByModelName(record.Model)
+		switch {
+		case !found || processGroup == nil:
+			reason = "model is no longer configured"
+		case processConfigHash(modelConfig) != record.ConfigHash:
+			reason = "configuration changed"
+		case processGroup.swap && processGroup.lastUsedProcess != "":
+			reason = "another model in the group is running"
+		}
+
+		if reason == "" {
+			if err := processGroup.processes[record.Model].adopt(record.PID); err != nil {
+				reason = err.Error()
+			} else if processGroup.swap {
+				processGroup.lastUsedProcess = record.Model
+			}
+		}
+
+		if reason != "" {
+			pm.proxyLogger.Infof("<%s> Stopping previous process %d: %s", record.Model, record.PID, reason)
+			go stopStalePID(record.PID)
+		}
+	}
+}
+
+// stopStalePID stops a process left over from a previous llama-swap
+func stopStalePID(pid int) {
+	terminatePID(pid)
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		if !processAlive(pid) {
+			return
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	killPID(pid)
+}
+
+// saveProcessState writes the ready processes to the state file
+func (pm *ProxyManager) saveProcessState() {
+	records := make([]ProcessRecord, 0)
+	for _, processGroup := range pm.processGroups {
+		for modelID, process := range processGroup.processes {
+			pid := process.pid()
+			if pid == 0 || process.CurrentState() != StateReady {
+				continue
+			}
+
+			record := ProcessRecord{
+				Model:      modelID,
+				PID:        pid,
+				Proxy:      process.config.Proxy,
+				ConfigHash: processConfigHash(process.config),
+			}
+			if u, err := url.Parse(process.config.Proxy); err == nil {
+				record.Port, _ = strconv.Atoi(u.Port())
+			}
+			if args, err := process.config.SanitizedCommand(); err == nil {
+				record.Program = args[0]
+			}
+			records = append(records, record)
+		}
+	}
+
+	pm.stateFile.Lock()
+	defer pm.stateFile.Unlock()
+	if err := writeStateFile(pm.stateFile.file, records); err != nil {
+		pm.proxyLogger.Errorf("Failed to save state file %s: %v", pm.stateFile.file, err)
+	}
+}
+
+// Detach stops the ProxyManager like Shutdown but leaves ready processes
+// running when the state file is enabled, so they can be adopted by the next
+// llama-swap. Without a state file it is the same as Shutdown.
+func (pm *ProxyManager) Detach() {
+	if pm.stateFile == nil {
+		pm.Shutdown()
+		return
+	}
+
+	pm.Lock()
+	defer pm.Unlock()
+
+	var detached []string
+	for _, processGroup := range pm.processGroups {
+		for modelID, process := range processGroup.processes {
+			if process.CurrentState() == StateReady && process.pid() != 0 {
+				detached = append(detached, modelID)
+			} else {
+				process.Shutdown()
+			}
+		}
+	}
+	if len(detached) > 0 {
+		pm.proxyLogger.Infof("Leaving running for the next start: %s", strings.Join(detached, ", "))
+	}
+
+	pm.saveProcessState()
+	if err := pm.usageTracker.Save(); err != nil {
+		pm.proxyLogger.Errorf("Failed to save usage to %s: %v", pm.config.Usage.File, err)
+	}
+	pm.shutdownCancel()
+}
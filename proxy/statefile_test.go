@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyManager_StateFileAdoptsProcesses(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	conf := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		StateFile:          stateFile,
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+	})
+
+	proxy := New(conf)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	if !assert.Equal(t, http.StatusOK, w.Code) {
+		return
+	}
+
+	pid := proxy.processGroups[config.DEFAULT_GROUP_ID].processes["model1"].pid()
+	assert.NotZero(t, pid)
+
+	// the process is left running and recorded for the next start
+	proxy.Detach()
+	assert.True(t, processAlive(pid))
+	records, err := readStateFile(stateFile)
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 1) {
+		return
+	}
+	assert.Equal(t, "model1", records[0].Model)
+	assert.Equal(t, pid, records[0].PID)
+
+	adopter := New(conf)
+	process := adopter.processGroups[config.DEFAULT_GROUP_ID].processes["model1"]
+	assert.Equal(t, StateReady, process.CurrentState())
+	assert.Equal(t, pid, process.pid())
+
+	req = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w = httptest.NewRecorder()
+	adopter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "model1")
+	adopter.Detach()
+
+	// a changed configuration stops the previous process instead of adopting it
+	modelConfig := conf.Models["model1"]
+	modelConfig.Env = append(modelConfig.Env, "CHANGED=1")
+	conf.Models["model1"] = modelConfig
+
+	restarted := New(conf)
+	defer restarted.StopProcesses(StopImmediately)
+	assert.Equal(t, StateStopped, restarted.processGroups[config.DEFAULT_GROUP_ID].processes["model1"].CurrentState())
+	assert.Eventually(t, func() bool {
+		return !processAlive(pid)
+	}, 15*time.Second, 50*time.Millisecond)
+
+	records, err = readStateFile(stateFile)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestProcessConfigHash(t *testing.T) {
+	modelConfig := config.ModelConfig{Cmd: "server --port 9000", Proxy: "http://localhost:9000"}
+	hash := processConfigHash(modelConfig)
+	assert.Equal(t, hash, processConfigHash(modelConfig))
+
+	modelConfig.Env = []string{"A=1"}
+	assert.NotEqual(t, hash, processConfigHash(modelConfig))
+}
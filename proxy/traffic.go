@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// how many mirror captures are kept in memory
+	mirrorMaxCaptures = 100
+
+	// captured output is truncated to this size, metrics use the full response
+	mirrorMaxCaptureBytes = 64 * 1024
+
+	// mirrored requests are dropped when this many are already in flight
+	mirrorMaxInflight = 4
+)
+
+// pickSplitTarget returns the model a request for modelID is sent to based
+// on the model's splitTraffic weights. The remaining percentage stays on modelID.
+func pickSplitTarget(modelID string, splits []config.TrafficSplit, roll int) string {
+	for _, split := range splits {
+		if roll < split.Percent {
+			return split.Model
+		}
+		roll -= split.Percent
+	}
+	return modelID
+}
+
+// sampled returns true for percent out of 100 calls
+func sampled(percent int) bool {
+	return percent >= 100 || (percent > 0 && rand.IntN(100) < percent)
+}
+
+// MirrorCapture is the output of a request mirrored to a shadow model
+type MirrorCapture struct {
+	ID         int       `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Model      string    `json:"model"`
+	Shadow     string    `json:"shadow"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status_code"`
+	DurationMs int       `json:"duration_ms"`
+	Request    string    `json:"request"`
+	Response   string    `json:"response"`
+	Truncated  bool      `json:"truncated"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// MirrorMonitor runs mirrored requests and keeps their recent captures
+type MirrorMonitor struct {
+	mu       sync.RWMutex
+	captures []MirrorCapture
+	nextID   int
+
+	inflight chan struct{}
+}
+
+func NewMirrorMonitor() *MirrorMonitor {
+	return &MirrorMonitor{
+		inflight: make(chan struct{}, mirrorMaxInflight),
+	}
+}
+
+func (mm *MirrorMonitor) addCapture(capture MirrorCapture) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	capture.ID = mm.nextID
+	mm.nextID++
+	mm.captures = append(mm.captures, capture)
+	if len(mm.captures) > mirrorMaxCaptures {
+		mm.captures = mm.captures[len(mm.captures)-mirrorMaxCaptures:]
+	}
+}
+
+// GetCaptures returns a copy of the recent captures, oldest first
+func (mm *MirrorMonitor) GetCaptures() []MirrorCapture {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	result := make([]MirrorCapture, len(mm.captures))
+	copy(result, mm.captures)
+	return result
+}
+
+// captureResponseWriter buffers a response that is not sent to a client
+type captureResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *captureResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *captureResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *captureResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// mirrorRequest copies a request for modelID to its shadow model in the
+// background. The shadow never swaps out another model: it is skipped when it
+// shares a swapping group with modelID or when another model is running in its
+// swapping group. body is the request before the primary's filters are applied.
+func (pm *ProxyManager) mirrorRequest(modelID string, original *http.Request, body []byte) {
+	mirror := pm.config.Models[modelID].Mirror
+	if mirror.Model == "" || !sampled(mirror.Percent) {
+		return
+	}
+
+	shadowGroup := pm.findGroupByModelName(mirror.Model)
+	if shadowGroup == nil {
+		return
+	}
+	if primaryGroup := pm.findGroupByModelName(modelID); primaryGroup == shadowGroup && shadowGroup.swap {
+		pm.proxyLogger.Debugf("<%s> not mirroring to %s, it would swap out the model", modelID, mirror.Model)
+		return
+	}
+
+	select {
+	case pm.mirrorMonitor.inflight <- struct{}{}:
+	default:
+		pm.proxyLogger.Debugf("<%s> mirror to %s dropped, too many mirrored requests in flight", modelID, mirror.Model)
+		return
+	}
+
+	// the original request can not be used after the handler returns
+	path := original.URL.RequestURI()
+	header := original.Header.Clone()
+
+	go func() {
+		defer func() { <-pm.mirrorMonitor.inflight }()
+		// waits for a model being swapped in by a client request
+		if shadowGroup.swapsOut(mirror.Model) {
+			pm.proxyLogger.Debugf("<%s> not mirroring to %s, it would swap out the running model", modelID, mirror.Model)
+			return
+		}
+		pm.runMirrorRequest(modelID, mirror.Model, path, header, body)
+	}()
+}
+
+func (pm *ProxyManager) runMirrorRequest(modelID, shadow, path string, header http.Header, body []byte) {
+	startTime := time.Now()
+	capture := MirrorCapture{
+		Timestamp: startTime,
+		Model:     modelID,
+		Shadow:    shadow,
+		Path:      path,
+		Request:   string(body),
+	}
+	defer func() {
+		capture.DurationMs = int(time.Since(startTime).Milliseconds())
+		pm.mirrorMonitor.addCapture(capture)
+	}()
+
+	body, err := sjson.SetBytes(body, "model", shadow)
+	if err == nil {
+		if useModelName := pm.config.Models[shadow].UseModelName; useModelName != "" {
+			body, err = sjson.SetBytes(body, "model", useModelName)
+		}
+	}
+	if err == nil {
+		body, err = pm.applyRequestFilters(shadow, body)
+	}
+	if err != nil {
+		capture.Error = fmt.Sprintf("error preparing request: %s", err.Error())
+		return
+	}
+
+	req, err := http.NewRequestWithContext(pm.shutdownCtx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		capture.Error = fmt.Sprintf("error creating request: %s", err.Error())
+		return
+	}
+	req.Header = header
+	req.Header.Del("transfer-encoding")
+	req.Header.Del("accept-encoding") // keep the captured output readable
+	req.Header.Set("content-length", strconv.Itoa(len(body)))
+	req.ContentLength = int64(len(body))
+
+	writer := &captureResponseWriter{header: make(http.Header)}
+	if err := pm.findGroupByModelName(shadow).ProxyRequest(shadow, writer, req); err != nil {
+		capture.Error = fmt.Sprintf("error proxying request: %s", err.Error())
+		return
+	}
+
+	capture.StatusCode = writer.statusCode
+	output := writer.body.Bytes()
+	if len(output) > mirrorMaxCaptureBytes {
+		capture.Response = string(output[:mirrorMaxCaptureBytes])
+		capture.Truncated = true
+	} else {
+		capture.Response = string(output)
+	}
+
+	if writer.statusCode != http.StatusOK {
+		return
+	}
+
+	// shadow usage is recorded as metrics but not counted against the client
+	recorder := &MetricsRecorder{
+		metricsMonitor: pm.metricsMonitor,
+		realModelName:  shadow,
+		startTime:      startTime,
+	}
+	if strings.Contains(writer.header.Get("Content-Type"), "text/event-stream") {
+		recorder.processStreamingResponse(output)
+	} else {
+		recorder.processNonStreamingResponse(output)
+	}
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestPickSplitTarget(t *testing.T) {
+	splits := []config.TrafficSplit{
+		{Model: "candidate1", Percent: 10},
+		{Model: "candidate2", Percent: 5},
+	}
+
+	assert.Equal(t, "candidate1", pickSplitTarget("model1", splits, 0))
+	assert.Equal(t, "candidate1", pickSplitTarget("model1", splits, 9))
+	assert.Equal(t, "candidate2", pickSplitTarget("model1", splits, 10))
+	assert.Equal(t, "candidate2", pickSplitTarget("model1", splits, 14))
+	assert.Equal(t, "model1", pickSplitTarget("model1", splits, 15))
+	assert.Equal(t, "model1", pickSplitTarget("model1", splits, 99))
+	assert.Equal(t, "model1", pickSplitTarget("model1", nil, 0))
+}
+
+func TestProxyManager_SplitTraffic(t *testing.T) {
+	modelConfig := getTestSimpleResponderConfig("model1")
+	modelConfig.SplitTraffic = []config.TrafficSplit{{Model: "model2", Percent: 100}}
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": modelConfig,
+			"model2": getTestSimpleResponderConfig("model2"),
+		},
+	})
+
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, "model2", w.Header().Get(headerRoutedModel))
+		assert.Equal(t, "model2", gjson.Get(w.Body.String(), "responseMessage").String())
+	}
+}
+
+func TestProxyManager_MirrorToShadow(t *testing.T) {
+	modelConfig := getTestSimpleResponderConfig("model1")
+	modelConfig.Mirror = config.MirrorConfig{Model: "model2", Percent: 100}
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": modelConfig,
+			"model2": getTestSimpleResponderConfig("model2"),
+		},
+		Groups: map[string]config.GroupConfig{
+			"shadow": {Swap: true, Exclusive: false, Members: []string{"model2"}},
+		},
+	})
+
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	if !assert.Equal(t, http.StatusOK, w.Code) {
+		return
+	}
+	assert.Equal(t, "model1", gjson.Get(w.Body.String(), "responseMessage").String())
+	assert.Empty(t, w.Header().Get(headerRoutedModel))
+
+	if !assert.Eventually(t, func() bool {
+		return len(proxy.mirrorMonitor.GetCaptures()) == 1
+	}, 5*time.Second, 50*time.Millisecond) {
+		return
+	}
+
+	capture := proxy.mirrorMonitor.GetCaptures()[0]
+	assert.Equal(t, "model1", capture.Model)
+	assert.Equal(t, "model2", capture.Shadow)
+	assert.Equal(t, http.StatusOK, capture.StatusCode)
+	assert.Equal(t, "model2", gjson.Get(capture.Response, "responseMessage").String())
+	assert.Equal(t, "model2", gjson.Get(gjson.Get(capture.Response, "request_body").String(), "model").String())
+
+	// the primary is not swapped out and both requests are in the metrics
+	assert.Equal(t, StateReady, proxy.findGroupByModelName("model1").processes["model1"].CurrentState())
+	models := []string{}
+	for _, metric := range proxy.metricsMonitor.GetMetrics() {
+		models = append(models, metric.Model)
+	}
+	assert.ElementsMatch(t, []string{"model1", "model2"}, models)
+
+	req = httptest.NewRequest("GET", "/api/mirrors?shadow=model2", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), gjson.Get(w.Body.String(), "mirrors.#").Int())
+}
+
+func TestProxyManager_MirrorSkipsSameSwapGroup(t *testing.T) {
+	modelConfig := getTestSimpleResponderConfig("model1")
+	modelConfig.Mirror = config.MirrorConfig{Model: "model2", Percent: 100}
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": modelConfig,
+			"model2": getTestSimpleResponderConfig("model2"),
+		},
+	})
+
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, proxy.mirrorMonitor.GetCaptures())
+	assert.Equal(t, StateStopped, proxy.findGroupByModelName("model2").processes["model2"].CurrentState())
+}
+
+func TestProxyManager_MirrorSkipsRunningShadowGroup(t *testing.T) {
+	modelConfig := getTestSimpleResponderConfig("model1")
+	modelConfig.Mirror = config.MirrorConfig{Model: "model2", Percent: 100}
+
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		LogLevel:           "error",
+		Models: map[string]config.ModelConfig{
+			"model1": modelConfig,
+			"model2": getTestSimpleResponderConfig("model2"),
+			"model3": getTestSimpleResponderConfig("model3"),
+		},
+		Groups: map[string]config.GroupConfig{
+			"shadow": {Swap: true, Exclusive: false, Persistent: true, Members: []string{"model2", "model3"}},
+		},
+	})
+
+	proxy := New(config)
+	t.Cleanup(proxy.Shutdown)
+
+	// a client is using model3 in the shadow's group
+	for _, model := range []string{"model3", "model1"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"`+model+`"}`))
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		if !assert.Equal(t, http.StatusOK, w.Code) {
+			return
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, proxy.mirrorMonitor.GetCaptures())
+	group := proxy.findGroupByModelName("model2")
+	assert.Equal(t, StateReady, group.processes["model3"].CurrentState())
+	assert.Equal(t, StateStopped, group.processes["model2"].CurrentState())
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+const usageDayFormat = "2006-01-02"
+
+// UsageRecord is the total usage of a user for a model on a single day (UTC)
+type UsageRecord struct {
+	Day          string `json:"day"`
+	User         string `json:"user"`
+	Model        string `json:"model"`
+	Requests     int    `json:"requests"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	CachedTokens int    `json:"cache_tokens"`
+}
+
+type usageKey struct {
+	day   string
+	user  string
+	model string
+}
+
+// UsageTracker accumulates token usage per user, per model, per day. When a file
+// is set the totals are persisted so they survive restarts and config reloads.
+type UsageTracker struct {
+	sync.Mutex
+
+	file   string
+	totals map[usageKey]*UsageRecord
+
+	// changes counts calls to Add, saved is the count written to the file and
+	// is only used with saveMu held so Save calls do not overlap
+	changes uint64
+	saved   uint64
+	saveMu  sync.Mutex
+}
+
+func NewUsageTracker(file string) (*UsageTracker, error) {
+	ut := &UsageTracker{
+		file:   file,
+		totals: make(map[usageKey]*UsageRecord),
+	}
+
+	if file == "" {
+		return ut, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return ut, nil
+	} else if err != nil {
+		return ut, err
+	}
+
+	var records []UsageRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return ut, err
+	}
+	for _, record := range records {
+		r := record
+		ut.totals[usageKey{day: r.Day, user: r.User, model: r.Model}] = &r
+	}
+
+	return ut, nil
+}
+
+// Add records the usage of a completed request
+func (ut *UsageTracker) Add(metric TokenMetrics) {
+	ut.Lock()
+	defer ut.Unlock()
+
+	key := usageKey{
+		day:   metric.Timestamp.UTC().Format(usageDayFormat),
+		user:  metric.User,
+		model: metric.Model,
+	}
+
+	record, found := ut.totals[key]
+	if !found {
+		record = &UsageRecord{Day: key.day, User: key.user, Model: key.model}
+		ut.totals[key] = record
+	}
+
+	record.Requests++
+	record.InputTokens += metric.InputTokens
+	record.OutputTokens += metric.OutputTokens
+	if metric.CachedTokens > 0 {
+		record.CachedTokens += metric.CachedTokens
+	}
+	ut.changes++
+}
+
+// UsageFilter selects records, empty values match everything. From and To are
+// inclusive days in the YYYY-MM-DD format.
+type UsageFilter struct {
+	From  string
+	To    string
+	User  string
+	Model string
+}
+
+// Records returns matching usage records sorted by day, user and model
+func (ut *UsageTracker) Records(filter UsageFilter) []UsageRecord {
+	ut.Lock()
+	defer ut.Unlock()
+
+	records := make([]UsageRecord, 0, len(ut.totals))
+	for key, record := range ut.totals {
+		if filter.From != "" && key.day < filter.From {
+			continue
+		}
+		if filter.To != "" && key.day > filter.To {
+			continue
+		}
+		if filter.User != "" && key.user != filter.User {
+			continue
+		}
+		if filter.Model != "" && key.model != filter.Model {
+			continue
+		}
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		return a.Model < b.Model
+	})
+
+	return records
+}
+
+// Save writes the totals to the file if anything has changed
+func (ut *UsageTracker) Save() error {
+	if ut.file == "" {
+		return nil
+	}
+
+	ut.saveMu.Lock()
+	defer ut.saveMu.Unlock()
+
+	ut.Lock()
+	changes := ut.changes
+	ut.Unlock()
+	if changes == ut.saved {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(ut.Records(UsageFilter{}), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := config.WriteFileAtomic(ut.file, data); err != nil {
+		return err
+	}
+
+	// a failed write is retried by the next Save
+	ut.saved = changes
+	return nil
+}
+
+// runSaveLoop periodically saves the totals until done is closed
+func (ut *UsageTracker) runSaveLoop(interval time.Duration, done <-chan struct{}, logger *LogMonitor) {
+	if ut.file == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := ut.Save(); err != nil {
+				logger.Errorf("Failed to save usage to %s: %v", ut.file, err)
+			}
+		}
+	}
+}
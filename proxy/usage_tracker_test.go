@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/llama-swap/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageTracker_TotalsAndPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "usage.json")
+	ut, err := NewUsageTracker(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	day1 := time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+
+	ut.Add(TokenMetrics{Timestamp: day1, User: "alice", Model: "m1", InputTokens: 10, OutputTokens: 5, CachedTokens: -1})
+	ut.Add(TokenMetrics{Timestamp: day1, User: "alice", Model: "m1", InputTokens: 20, OutputTokens: 5, CachedTokens: 3})
+	ut.Add(TokenMetrics{Timestamp: day1, User: "bob", Model: "m1", InputTokens: 1, OutputTokens: 1})
+	ut.Add(TokenMetrics{Timestamp: day2, User: "alice", Model: "m2", InputTokens: 7, OutputTokens: 7})
+
+	records := ut.Records(UsageFilter{User: "alice"})
+	assert.Equal(t, []UsageRecord{
+		{Day: "2025-03-01", User: "alice", Model: "m1", Requests: 2, InputTokens: 30, OutputTokens: 10, CachedTokens: 3},
+		{Day: "2025-03-02", User: "alice", Model: "m2", Requests: 1, InputTokens: 7, OutputTokens: 7},
+	}, records)
+
+	assert.Len(t, ut.Records(UsageFilter{From: "2025-03-02"}), 1)
+	assert.Len(t, ut.Records(UsageFilter{To: "2025-03-01"}), 2)
+
+	// totals survive a restart
+	assert.NoError(t, ut.Save())
+	reloaded, err := NewUsageTracker(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ut.Records(UsageFilter{}), reloaded.Records(UsageFilter{}))
+	}
+}
+
+func TestUsageTracker_SaveRetriesAfterFailure(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "usage.json")
+	ut, _ := NewUsageTracker(file)
+	ut.Add(TokenMetrics{Timestamp: time.Now(), User: "alice", Model: "m1", InputTokens: 1})
+
+	// the rename fails while a directory is in the way
+	if !assert.NoError(t, os.Mkdir(file, 0755)) {
+		return
+	}
+	assert.Error(t, ut.Save())
+
+	assert.NoError(t, os.Remove(file))
+	assert.NoError(t, ut.Save())
+	reloaded, err := NewUsageTracker(file)
+	if assert.NoError(t, err) {
+		assert.Len(t, reloaded.Records(UsageFilter{}), 1)
+	}
+}
+
+func TestProxyManager_UsageEndpoint(t *testing.T) {
+	config := config.AddDefaultGroupToConfig(config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+		LogLevel: "error",
+		Usage: config.UsageConfig{
+			KeyBy: "header:X-User",
+		},
+	})
+
+	proxy := New(config)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	for _, user := range []string{"alice", "alice", "bob"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"model1"}`))
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	metrics := proxy.metricsMonitor.GetMetrics()
+	if assert.Len(t, metrics, 3) {
+		assert.Equal(t, "bob", metrics[2].User)
+	}
+
+	req := httptest.NewRequest("GET", "/api/usage?user=alice", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Usage []UsageRecord `json:"usage"`
+	}
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response)) && assert.Len(t, response.Usage, 1) {
+		assert.Equal(t, "alice", response.Usage[0].User)
+		assert.Equal(t, 2, response.Usage[0].Requests)
+		assert.Equal(t, 50, response.Usage[0].InputTokens)
+		assert.Equal(t, 20, response.Usage[0].OutputTokens)
+	}
+
+	req = httptest.NewRequest("GET", "/api/usage?format=csv&user=bob", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	today := time.Now().UTC().Format(usageDayFormat)
+	assert.Equal(t, "day,user,model,requests,input_tokens,output_tokens,cache_tokens\n"+today+",bob,model1,1,25,10,0\n", w.Body.String())
+
+	req = httptest.NewRequest("GET", "/api/usage?from=yesterday", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves the TLS certificate (and optional client CA bundle) from disk
+// and transparently reloads them when the files are rotated. This allows certificates
+// to be renewed without restarting llama-swap and unloading models.
+type certReloader struct {
+	sync.Mutex
+
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+
+	// modification times of the loaded files, used to detect rotation
+	certModTime     time.Time
+	keyModTime      time.Time
+	clientCAModTime time.Time
+
+	// limit how often the files are stat'ed
+	lastCheck     time.Time
+	checkInterval time.Duration
+
+	// settings shared by all connections, cloned for each client
+	base *tls.Config
+}
+
+func newCertReloader(certFile, keyFile, clientCAFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		clientCAFile:  clientCAFile,
+		checkInterval: time.Second,
+	}
+	cr.base = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cr.GetCertificate,
+		// the per client config replaces the server's, so HTTP/2 is set here
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// reload loads the certificate, key and client CA files if they have changed
+func (cr *certReloader) reload() error {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return fmt.Errorf("unable to stat TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to stat TLS key: %w", err)
+	}
+
+	if cr.cert == nil || !certInfo.ModTime().Equal(cr.certModTime) || !keyInfo.ModTime().Equal(cr.keyModTime) {
+		cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load TLS key pair: %w", err)
+		}
+		cr.cert = &cert
+		cr.certModTime = certInfo.ModTime()
+		cr.keyModTime = keyInfo.ModTime()
+	}
+
+	if cr.clientCAFile != "" {
+		caInfo, err := os.Stat(cr.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("unable to stat TLS client CA: %w", err)
+		}
+
+		if cr.clientCAs == nil || !caInfo.ModTime().Equal(cr.clientCAModTime) {
+			pem, err := os.ReadFile(cr.clientCAFile)
+			if err != nil {
+				return fmt.Errorf("unable to read TLS client CA: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no valid certificates found in TLS client CA file %s", cr.clientCAFile)
+			}
+			cr.clientCAs = pool
+			cr.clientCAModTime = caInfo.ModTime()
+		}
+	}
+
+	return nil
+}
+
+// maybeReload reloads the files at most once per checkInterval. Errors are logged and
+// the previously loaded certificates continue to be used.
+func (cr *certReloader) maybeReload() {
+	if time.Since(cr.lastCheck) < cr.checkInterval {
+		return
+	}
+	cr.lastCheck = time.Now()
+
+	if err := cr.reload(); err != nil {
+		fmt.Printf("Warning, unable to reload TLS certificates: %v\n", err)
+	}
+}
+
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.Lock()
+	defer cr.Unlock()
+	cr.maybeReload()
+	return cr.cert, nil
+}
+
+// GetConfigForClient returns a per connection config so a rotated client CA
+// bundle is used for new connections
+func (cr *certReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cr.Lock()
+	defer cr.Unlock()
+	cr.maybeReload()
+
+	conf := cr.base.Clone()
+	if cr.clientCAs != nil {
+		conf.ClientCAs = cr.clientCAs
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return conf, nil
+}
+
+// TLSConfig returns a tls.Config that uses the reloader for certificates
+func (cr *certReloader) TLSConfig() *tls.Config {
+	conf := cr.base.Clone()
+	conf.GetConfigForClient = cr.GetConfigForClient
+	return conf
+}
+
+// httpsRedirectHandler redirects all plain HTTP requests to the HTTPS listener
+func httpsRedirectHandler(httpsListen string) http.Handler {
+	_, httpsPort, _ := net.SplitHostPort(httpsListen)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		// Use 308 for non-GET/HEAD requests to preserve method
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		} else {
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+		}
+	})
+}
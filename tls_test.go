@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert writes a self signed certificate and key with the common name
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func leafCommonName(t *testing.T, cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader_ReloadsRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	cr, err := newCertReloader(certFile, keyFile, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	cr.checkInterval = 0
+
+	cert, err := cr.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", leafCommonName(t, cert))
+
+	// rotate the certificate, make sure the mod time is different
+	writeTestCert(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+
+	cert, err = cr.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", leafCommonName(t, cert))
+}
+
+func TestCertReloader_ClientCARequiresClientCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTestCert(t, certFile, keyFile, "server")
+	writeTestCert(t, caFile, filepath.Join(dir, "ca-key.pem"), "client-ca")
+
+	cr, err := newCertReloader(certFile, keyFile, caFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	conf, err := cr.GetConfigForClient(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, conf.ClientAuth)
+	assert.NotNil(t, conf.ClientCAs)
+
+	_, err = newCertReloader(certFile, keyFile, filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
+
+func TestCertReloader_ServesHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server")
+
+	cr, err := newCertReloader(certFile, keyFile, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := &http.Server{
+		TLSConfig: cr.TLSConfig(),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+	}
+	go srv.ServeTLS(listener, "", "")
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "HTTP/2.0", string(body))
+}
+
+func TestHttpsRedirectHandler(t *testing.T) {
+	tests := []struct {
+		listen   string
+		method   string
+		expected string
+		code     int
+	}{
+		{":8443", "GET", "https://example.com:8443/v1/models?a=b", http.StatusMovedPermanently},
+		{":443", "GET", "https://example.com/v1/models?a=b", http.StatusMovedPermanently},
+		{":8443", "POST", "https://example.com:8443/v1/models?a=b", http.StatusPermanentRedirect},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://example.com:8080/v1/models?a=b", nil)
+		rec := httptest.NewRecorder()
+		httpsRedirectHandler(tt.listen).ServeHTTP(rec, req)
+		assert.Equal(t, tt.code, rec.Code)
+		assert.Equal(t, tt.expected, rec.Header().Get("Location"))
+	}
+}
@@ -29,6 +29,7 @@ interface Metrics {
   id: number;
   timestamp: string;
   model: string;
+  user: string;
   cache_tokens: number;
   input_tokens: number;
   output_tokens: number;
@@ -59,6 +59,7 @@ const ActivityPage = () => {
                 <th className="px-6 py-3">ID</th>
                 <th className="px-6 py-3">Time</th>
                 <th className="px-6 py-3">Model</th>
+                <th className="px-6 py-3">User</th>
                 <th className="px-6 py-3">
                   Cached <Tooltip content="prompt tokens from cache" />
                 </th>
@@ -77,6 +78,7 @@ const ActivityPage = () => {
                   <td className="px-4 py-4">{metric.id + 1 /* un-zero index */}</td>
                   <td className="px-6 py-4">{formatRelativeTime(metric.timestamp)}</td>
                   <td className="px-6 py-4">{metric.model}</td>
+                  <td className="px-6 py-4">{metric.user || "-"}</td>
                   <td className="px-6 py-4">{metric.cache_tokens > 0 ? metric.cache_tokens.toLocaleString() : "-"}</td>
                   <td className="px-6 py-4">{metric.input_tokens.toLocaleString()}</td>
                   <td className="px-6 py-4">{metric.output_tokens.toLocaleString()}</td>
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mostlygeek/llama-swap/event"
+	"github.com/mostlygeek/llama-swap/proxy"
+	"github.com/mostlygeek/llama-swap/proxy/config"
+)
+
+// watchConfigFiles emits a ConfigFileChangedEvent when the configuration file,
+// a file matching one of its include globs, or a GGUF file in a discovery
+// directory changes
+func watchConfigFiles(configPath string) {
+	absConfigPath, err := filepath.Abs(configPath)
+	if err != nil {
+		fmt.Printf("Error getting absolute path for watching config file: %v\n", err)
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Printf("Error creating file watcher: %v. File watching disabled.\n", err)
+		return
+	}
+	defer watcher.Close()
+
+	configDir := filepath.Dir(absConfigPath)
+	err = watcher.Add(configDir)
+	if err != nil {
+		fmt.Printf("Error adding config path directory (%s) to watcher: %v. File watching disabled.", configDir, err)
+		return
+	}
+	patterns := watchIncludes(watcher, absConfigPath)
+	discoveryDirs := watchDiscoveryDirs(watcher, absConfigPath)
+
+	for {
+		select {
+		case changeEvent := <-watcher.Events:
+			if configFileChanged(changeEvent, absConfigPath, patterns) || discoveryFileChanged(changeEvent, discoveryDirs) {
+				event.Emit(proxy.ConfigFileChangedEvent{
+					ReloadingState: proxy.ReloadingStateStart,
+				})
+				// the include globs and discovery directories may have changed
+				patterns = watchIncludes(watcher, absConfigPath)
+				discoveryDirs = watchDiscoveryDirs(watcher, absConfigPath)
+			}
+
+		case err := <-watcher.Errors:
+			log.Printf("File watcher error: %v", err)
+		}
+	}
+}
+
+// watchIncludes adds the directories of the include globs to watcher and
+// returns the globs
+func watchIncludes(watcher *fsnotify.Watcher, absConfigPath string) []string {
+	patterns, err := config.IncludePatterns(absConfigPath)
+	if err != nil {
+		// reported when the configuration is loaded
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		dirs := []string{filepath.Dir(pattern)}
+		if strings.ContainsAny(dirs[0], "*?[") {
+			// e.g. teams/*/models.yaml, only existing directories can be watched
+			dirs, _ = filepath.Glob(dirs[0])
+		}
+		for _, dir := range dirs {
+			if err := watcher.Add(dir); err != nil {
+				fmt.Printf("Error adding include directory (%s) to watcher: %v\n", dir, err)
+			}
+		}
+	}
+	return patterns
+}
+
+// watchDiscoveryDirs adds the directories scanned for models to watcher and
+// returns them
+func watchDiscoveryDirs(watcher *fsnotify.Watcher, absConfigPath string) []string {
+	conf, err := config.LoadConfig(absConfigPath)
+	if err != nil {
+		// reported when the configuration is loaded
+		return nil
+	}
+
+	var dirs []string
+	for _, dir := range conf.DiscoveryDirs() {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if err := watcher.Add(absDir); err != nil {
+			fmt.Printf("Error adding discovery directory (%s) to watcher: %v\n", absDir, err)
+			continue
+		}
+		dirs = append(dirs, absDir)
+	}
+	return dirs
+}
+
+// discoveryFileChanged returns true if changeEvent adds or removes a GGUF file
+// or a subdirectory in a discovery directory. Writes are ignored so copying a
+// large file only reloads once.
+func discoveryFileChanged(changeEvent fsnotify.Event, dirs []string) bool {
+	if !changeEvent.Has(fsnotify.Create) && !changeEvent.Has(fsnotify.Remove) && !changeEvent.Has(fsnotify.Rename) {
+		return false
+	}
+	if !slices.Contains(dirs, filepath.Dir(changeEvent.Name)) {
+		return false
+	}
+	if strings.EqualFold(filepath.Ext(changeEvent.Name), ".gguf") {
+		return true
+	}
+	// a new subdirectory for recursive discovery
+	info, err := os.Stat(changeEvent.Name)
+	return err == nil && info.IsDir()
+}
+
+// configFileChanged returns true if changeEvent is for the configuration file
+// or an included file
+func configFileChanged(changeEvent fsnotify.Event, absConfigPath string, patterns []string) bool {
+	// the change for k8s configmap
+	if filepath.Base(changeEvent.Name) == "..data" && changeEvent.Has(fsnotify.Create) {
+		return true
+	}
+
+	if !changeEvent.Has(fsnotify.Write) && !changeEvent.Has(fsnotify.Create) &&
+		!changeEvent.Has(fsnotify.Remove) && !changeEvent.Has(fsnotify.Rename) {
+		return false
+	}
+	if changeEvent.Name == absConfigPath {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, changeEvent.Name); matched {
+			return true
+		}
+	}
+	return false
+}
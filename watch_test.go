@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFileChanged(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	patterns := []string{filepath.Join(dir, "models.d", "*.yaml")}
+
+	tests := []struct {
+		name    string
+		file    string
+		op      fsnotify.Op
+		changed bool
+	}{
+		{"config written", configPath, fsnotify.Write, true},
+		{"config chmod", configPath, fsnotify.Chmod, false},
+		{"include created", filepath.Join(dir, "models.d", "new.yaml"), fsnotify.Create, true},
+		{"include removed", filepath.Join(dir, "models.d", "old.yaml"), fsnotify.Remove, true},
+		{"include renamed", filepath.Join(dir, "models.d", "old.yaml"), fsnotify.Rename, true},
+		{"other file in include dir", filepath.Join(dir, "models.d", "notes.txt"), fsnotify.Write, false},
+		{"other file in config dir", filepath.Join(dir, "other.yaml"), fsnotify.Write, false},
+		{"configmap update", filepath.Join(dir, "models.d", "..data"), fsnotify.Create, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changeEvent := fsnotify.Event{Name: tt.file, Op: tt.op}
+			assert.Equal(t, tt.changed, configFileChanged(changeEvent, configPath, patterns))
+		})
+	}
+}
+
+func TestDiscoveryFileChanged(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "qwen"), 0755))
+	dirs := []string{dir}
+
+	tests := []struct {
+		name    string
+		file    string
+		op      fsnotify.Op
+		changed bool
+	}{
+		{"model added", filepath.Join(dir, "model.gguf"), fsnotify.Create, true},
+		{"model removed", filepath.Join(dir, "model.GGUF"), fsnotify.Remove, true},
+		{"model renamed", filepath.Join(dir, "model.gguf"), fsnotify.Rename, true},
+		{"model written", filepath.Join(dir, "model.gguf"), fsnotify.Write, false},
+		{"partial download", filepath.Join(dir, "model.gguf.part"), fsnotify.Create, false},
+		{"subdirectory added", filepath.Join(dir, "qwen"), fsnotify.Create, true},
+		{"model in other directory", filepath.Join(t.TempDir(), "model.gguf"), fsnotify.Create, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changeEvent := fsnotify.Event{Name: tt.file, Op: tt.op}
+			assert.Equal(t, tt.changed, discoveryFileChanged(changeEvent, dirs))
+		})
+	}
+}